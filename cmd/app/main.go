@@ -2,24 +2,77 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 
+	"github.com/fwhyjke/golang_test/internal/events"
+	"github.com/fwhyjke/golang_test/internal/handler"
+	"github.com/fwhyjke/golang_test/internal/middleware"
 	"github.com/fwhyjke/golang_test/internal/repository"
 	"github.com/fwhyjke/golang_test/internal/router"
+	"github.com/fwhyjke/golang_test/internal/webhooks"
 )
 
 func main() {
-	db := repository.NewInMemoryDataBase()
+	dataDir := flag.String("data-dir", "", "directory for the write-ahead log and snapshots; notes are kept in memory only if empty")
+	snapshotInterval := flag.Duration("snapshot-interval", 5*time.Minute, "how often to snapshot the storage and compact the log")
+	trashRetention := flag.Duration("trash-retention", 30*24*time.Hour, "how long deleted notes stay in the trash; 0 keeps them until purged by hand")
+	revisionLimit := flag.Int("revision-limit", repository.DefaultRevisionLimit, "how many versions of every note to keep in its history")
+	eventHistory := flag.Int("event-history", events.DefaultHistory, "how many of the last note changes to keep for event streams that reconnect")
+	webhookAttempts := flag.Int("webhook-attempts", webhooks.DefaultMaxAttempts, "how many times to try a webhook delivery before moving it to the dead letters")
+	webhookPrivate := flag.Bool("webhook-allow-private", false, "let webhooks point to loopback, private and link-local addresses")
+	tenantTokens := flag.String("tenant-tokens", "", "file with a \"<tenant> <token>\" pair on every line; requests must carry one of the tokens as a bearer token")
+	adminToken := flag.String("admin-token", "", "bearer token for POST /admin/compact; the route is off if empty")
+	wsOrigins := flag.String("ws-origins", "", "comma separated origins, such as https://app.example.com, whose pages may open /todos/ws besides those of this host")
+	idempotencyTTL := flag.Duration("idempotency-ttl", handler.DefaultIdempotencyTTL, "how long to remember POST /todos responses for retries with the same Idempotency-Key; 0 ignores the header")
+	flag.Parse()
+
+	if *tenantTokens == "" {
+		log.Fatal("-tenant-tokens is required")
+	}
+	tokens, err := middleware.LoadTenantTokens(*tenantTokens)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	bus := events.NewBus(*eventHistory)
+	hookOpts := []webhooks.Option{webhooks.WithMaxAttempts(*webhookAttempts)}
+	if *webhookPrivate {
+		hookOpts = append(hookOpts, webhooks.WithPrivateNetworks())
+	}
+	hooks := webhooks.NewDispatcher(bus, hookOpts...)
+	opts := []repository.Option{repository.WithRevisionLimit(*revisionLimit), repository.WithPublisher(bus)}
+	db := repository.NewInMemoryDataBase(opts...)
+	if *dataDir != "" {
+		db, err = repository.OpenInMemoryDataBase(*dataDir, opts...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *snapshotInterval > 0 {
+			go compactPeriodically(db, *snapshotInterval)
+		}
+	}
+
+	if *trashRetention > 0 {
+		go purgeTrashPeriodically(db, *trashRetention)
+	}
+
+	handlerOpts := []handler.Option{handler.WithIdempotencyTTL(*idempotencyTTL)}
+	if *wsOrigins != "" {
+		handlerOpts = append(handlerOpts, handler.WithAllowedOrigins(strings.Split(*wsOrigins, ",")...))
+	}
 
 	srv := &http.Server{
 		Addr:         ":8080",
-		Handler:      router.NewToDoServerMux(db),
+		Handler:      router.NewToDoServerMux(db, bus, hooks, tokens, *adminToken, handlerOpts...),
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
@@ -40,9 +93,45 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	bus.Close()
+	hooks.Close()
+
 	if err := srv.Shutdown(ctx); err != nil {
 		fmt.Println("Error with shutting down: ", err)
 	}
 
+	if err := db.Close(); err != nil {
+		fmt.Println("Error with closing storage: ", err)
+	}
+
 	fmt.Println("The server shutdown was successful")
 }
+
+func compactPeriodically(db *repository.InMemoryDataBase, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := db.Compact(context.Background()); err != nil {
+			log.Printf("compaction failed: %v", err)
+		}
+	}
+}
+
+// purgeTrashPeriodically empties the trash of notes deleted more than
+// retention ago, checking at least once an hour.
+func purgeTrashPeriodically(db *repository.InMemoryDataBase, retention time.Duration) {
+	ticker := time.NewTicker(min(retention, time.Hour))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		n, err := db.PurgeTrashOlderThan(context.Background(), retention)
+		if err != nil {
+			log.Printf("trash purge failed: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("purged %d notes from the trash", n)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package events fans the change events of the repository out to
+// subscribers.
+package events
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+var ErrSlowConsumer error = errors.New("subscriber fell behind and was dropped")
+var ErrClosed error = errors.New("event bus closed")
+
+// DefaultBuffer is how many events a subscriber may lag behind unless it asks
+// for another buffer size.
+const DefaultBuffer = 256
+
+// DefaultHistory is how many of the last events a Bus keeps for subscribers
+// that resume after a break.
+const DefaultHistory = 1000
+
+// Bus numbers the events it is given and delivers them to every interested
+// subscriber. It implements repository.Publisher.
+//
+// Publish never blocks. Every subscriber has a buffer of its own; a
+// subscriber whose buffer is full when an event arrives is dropped: its
+// channel is closed and Err reports ErrSlowConsumer. It has missed events
+// from then on and has to subscribe again and catch up by other means, for
+// example by reading the notes, or resume with SubscribeFrom while the missed
+// events are still kept.
+type Bus struct {
+	mu      sync.Mutex
+	seq     uint64
+	subs    map[*Subscription]struct{}
+	closed  bool
+	history []repository.Event
+	retain  int
+}
+
+// NewBus returns a bus that keeps the last retain events for SubscribeFrom,
+// DefaultHistory if retain is negative.
+func NewBus(retain int) *Bus {
+	if retain < 0 {
+		retain = DefaultHistory
+	}
+	return &Bus{subs: make(map[*Subscription]struct{}), retain: retain}
+}
+
+// Subscription receives events from a Bus until it is closed or dropped.
+type Subscription struct {
+	bus    *Bus
+	ch     chan repository.Event
+	filter func(repository.Event) bool
+	start  uint64
+	err    error
+}
+
+// Subscribe starts receiving the events published from now on for which
+// filter returns true; a nil filter accepts all events. buffer is how many
+// events may wait for the subscriber, DefaultBuffer if it is not positive.
+func (b *Bus) Subscribe(buffer int, filter func(repository.Event) bool) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.subscribe(buffer, filter, nil)
+}
+
+// SubscribeFrom is like Subscribe, but the subscription first receives the
+// kept events published after the event numbered after. It reports false if
+// some of those events are no longer kept, or after is not a number the bus
+// has given out; the subscription then starts with the events published from
+// now on, as if made by Subscribe.
+func (b *Bus) SubscribeFrom(after uint64, buffer int, filter func(repository.Event) bool) (*Subscription, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	oldest := b.seq + 1 - uint64(len(b.history))
+	if after > b.seq || after+1 < oldest {
+		return b.subscribe(buffer, filter, nil), false
+	}
+
+	var missed []repository.Event
+	for _, ev := range b.history[after+1-oldest:] {
+		if filter == nil || filter(ev) {
+			missed = append(missed, ev)
+		}
+	}
+	return b.subscribe(buffer, filter, missed), true
+}
+
+// subscribe registers a subscriber that receives missed before anything else.
+// Callers must hold b.mu.
+func (b *Bus) subscribe(buffer int, filter func(repository.Event) bool, missed []repository.Event) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultBuffer
+	}
+	s := &Subscription{bus: b, ch: make(chan repository.Event, buffer+len(missed)), filter: filter, start: b.seq}
+	for _, ev := range missed {
+		s.ch <- ev
+	}
+
+	if b.closed {
+		s.err = ErrClosed
+		close(s.ch)
+		return s
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Publish numbers events and hands them to the subscribers.
+func (b *Bus) Publish(events ...repository.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ev := range events {
+		b.seq++
+		ev.Seq = b.seq
+		if b.retain > 0 {
+			if len(b.history) == b.retain {
+				b.history = b.history[1:]
+			}
+			b.history = append(b.history, ev)
+		}
+		for s := range b.subs {
+			if s.filter != nil && !s.filter(ev) {
+				continue
+			}
+			select {
+			case s.ch <- ev:
+			default:
+				b.drop(s, ErrSlowConsumer)
+			}
+		}
+	}
+}
+
+// Seq returns the number of the last published event.
+func (b *Bus) Seq() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.seq
+}
+
+// Close drops all subscribers with ErrClosed. Events published later are
+// numbered but delivered to nobody.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for s := range b.subs {
+		b.drop(s, ErrClosed)
+	}
+}
+
+// drop unsubscribes s and closes its channel. Callers must hold b.mu.
+func (b *Bus) drop(s *Subscription, err error) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	s.err = err
+	close(s.ch)
+}
+
+// Start returns the number of the last event published before the
+// subscription started; later events are delivered to it.
+func (s *Subscription) Start() uint64 {
+	return s.start
+}
+
+// Events returns the channel the events arrive on. It is closed when the
+// subscription ends; buffered events can still be read after that.
+func (s *Subscription) Events() <-chan repository.Event {
+	return s.ch
+}
+
+// Err tells why the subscription ended: ErrSlowConsumer, ErrClosed, or nil
+// if it is still active or was closed by its owner.
+func (s *Subscription) Err() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	return s.err
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	s.bus.drop(s, nil)
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+func receive(s *Subscription) []uint64 {
+	var res []uint64
+	for {
+		select {
+		case ev, ok := <-s.Events():
+			if !ok {
+				return res
+			}
+			res = append(res, ev.Seq)
+		default:
+			return res
+		}
+	}
+}
+
+func TestBus(t *testing.T) {
+	bus := NewBus(0)
+	all := bus.Subscribe(10, nil)
+	acme := bus.Subscribe(10, func(ev repository.Event) bool { return ev.Tenant == "acme" })
+	slow := bus.Subscribe(1, nil)
+
+	bus.Publish(repository.Event{Tenant: "acme"}, repository.Event{Tenant: "default"})
+	bus.Publish(repository.Event{Tenant: "acme"})
+
+	if got := receive(all); len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Errorf("all: expected seq [1 2 3], got %v", got)
+	}
+	if got := receive(acme); len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("filtered: expected seq [1 3], got %v", got)
+	}
+
+	if got := receive(slow); len(got) != 1 {
+		t.Errorf("slow: expected the one buffered event, got %v", got)
+	}
+	if _, ok := <-slow.Events(); ok {
+		t.Errorf("slow: expected closed channel")
+	}
+	if err := slow.Err(); !errors.Is(err, ErrSlowConsumer) {
+		t.Errorf("slow: expected %v, got %v", ErrSlowConsumer, err)
+	}
+
+	acme.Close()
+	if err := acme.Err(); err != nil {
+		t.Errorf("closed by owner: expected nil, got %v", err)
+	}
+
+	bus.Close()
+	if err := all.Err(); !errors.Is(err, ErrClosed) {
+		t.Errorf("bus closed: expected %v, got %v", ErrClosed, err)
+	}
+	if err := bus.Subscribe(1, nil).Err(); !errors.Is(err, ErrClosed) {
+		t.Errorf("subscribe after close: expected %v, got %v", ErrClosed, err)
+	}
+	if seq := bus.Seq(); seq != 3 {
+		t.Errorf("seq: expected 3, got %d", seq)
+	}
+}
+
+func TestSubscribeFrom(t *testing.T) {
+	bus := NewBus(3)
+	for range 5 {
+		bus.Publish(repository.Event{})
+	}
+
+	testTable := []struct {
+		name    string
+		after   uint64
+		expOK   bool
+		expSeqs int
+	}{
+		{name: "kept", after: 3, expOK: true, expSeqs: 2},
+		{name: "oldest kept", after: 2, expOK: true, expSeqs: 3},
+		{name: "up to date", after: 5, expOK: true, expSeqs: 0},
+		{name: "no longer kept", after: 1, expOK: false, expSeqs: 0},
+		{name: "never given out", after: 9, expOK: false, expSeqs: 0},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			sub, ok := bus.SubscribeFrom(testCase.after, 1, nil)
+			defer sub.Close()
+
+			if ok != testCase.expOK {
+				t.Errorf("ok: expected %v, got %v", testCase.expOK, ok)
+			}
+			got := receive(sub)
+			if len(got) != testCase.expSeqs || (len(got) > 0 && got[0] != testCase.after+1) {
+				t.Errorf("events: expected %d from %d, got %v", testCase.expSeqs, testCase.after+1, got)
+			}
+			if sub.Start() != 5 {
+				t.Errorf("start: expected 5, got %d", sub.Start())
+			}
+		})
+	}
+}
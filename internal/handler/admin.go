@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+type AdminHandler struct {
+	storage repository.Compactor
+}
+
+func NewAdminHandler(storage repository.Compactor) *AdminHandler {
+	return &AdminHandler{
+		storage: storage,
+	}
+}
+
+func (h *AdminHandler) HandleCompact() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", "POST")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			if err := h.storage.Compact(r.Context()); err != nil {
+				handleError(w, err)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		},
+	)
+}
@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+type MockCompactor struct {
+	CompactFunc func(ctx context.Context) error
+}
+
+func (m *MockCompactor) Compact(ctx context.Context) error {
+	if m.CompactFunc != nil {
+		return m.CompactFunc(ctx)
+	}
+	return nil
+}
+
+func TestHandleCompact(t *testing.T) {
+	testTable := []struct {
+		name        string
+		method      string
+		mockCompact func(ctx context.Context) error
+		expStatus   int
+	}{
+		{
+			name:      "success",
+			method:    http.MethodPost,
+			expStatus: http.StatusNoContent,
+		},
+		{
+			name:   "not persistent",
+			method: http.MethodPost,
+			mockCompact: func(ctx context.Context) error {
+				return repository.ErrNotPersistent
+			},
+			expStatus: http.StatusConflict,
+		},
+		{
+			name:      "wrong method",
+			method:    http.MethodGet,
+			expStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := NewAdminHandler(&MockCompactor{CompactFunc: testCase.mockCompact})
+
+			req := httptest.NewRequest(testCase.method, "/admin/compact", nil)
+			rec := httptest.NewRecorder()
+
+			handler.HandleCompact().ServeHTTP(rec, req)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+		})
+	}
+}
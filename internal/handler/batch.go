@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+// maxBatchOps limits how many operations one batch request may carry.
+const maxBatchOps = 1000
+
+const (
+	batchAtomic   = "atomic"
+	batchContinue = "continue"
+)
+
+type batchRequest struct {
+	Mode string               `json:"mode"`
+	Ops  []repository.BatchOp `json:"ops"`
+}
+
+// batchResult is the outcome of one operation as sent to the client.
+type batchResult struct {
+	Status int              `json:"status"`
+	Note   *repository.Note `json:"note,omitempty"`
+	Error  string           `json:"error,omitempty"`
+}
+
+func (h *Handler) HandleBatch() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", "POST")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			h.postBatch(w, r)
+		},
+	)
+}
+
+// postBatch runs several creates, updates and deletes in one request. In the
+// atomic mode a failed operation undoes the whole batch and its status becomes
+// the status of the response; in the continue mode the response is 200 and
+// every operation reports its own status.
+func (h *Handler) postBatch(w http.ResponseWriter, r *http.Request) {
+	ctx, err := forceContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !(r.Header.Get("Content-Type") == "application/json") {
+		http.Error(w, "invalid media-type, must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var req batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, decodeError(err).Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := checkBatch(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.repo.Batch(ctx, req.Ops, req.Mode != batchContinue)
+	if err != nil && !errors.Is(err, repository.ErrBatchRolledBack) {
+		handleError(w, err)
+		return
+	}
+
+	statusCode := http.StatusOK
+	res := make([]batchResult, len(results))
+	for i, result := range results {
+		res[i] = newBatchResult(req.Ops[i].Op, result)
+		if result.Err != nil && !errors.Is(result.Err, repository.ErrBatchRolledBack) {
+			log.Printf("error: batch operation %d: code %d: %s", i, res[i].Status, result.Err)
+			if err != nil {
+				statusCode = res[i].Status
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(res)
+}
+
+// checkBatch rejects a batch that cannot run before it reaches the repository.
+func checkBatch(req batchRequest) error {
+	if req.Mode != "" && req.Mode != batchAtomic && req.Mode != batchContinue {
+		return errors.New("mode must be \"atomic\" or \"continue\"")
+	}
+	if len(req.Ops) == 0 || len(req.Ops) > maxBatchOps {
+		return fmt.Errorf("batch must have from 1 to %d operations", maxBatchOps)
+	}
+
+	for i, op := range req.Ops {
+		switch op.Op {
+		case repository.BatchCreate, repository.BatchUpdate:
+			if err := checkNote(op.Note); err != nil {
+				return fmt.Errorf("operation %d: %w", i, err)
+			}
+		case repository.BatchDelete:
+			if err := checkDeleteMode(op.Children); err != nil {
+				return fmt.Errorf("operation %d: %w", i, err)
+			}
+		default:
+			return fmt.Errorf("operation %d: op must be create, update or delete", i)
+		}
+		if op.Op != repository.BatchCreate && op.ID == 0 {
+			return fmt.Errorf("operation %d: id is required", i)
+		}
+	}
+	return nil
+}
+
+func newBatchResult(op repository.BatchOpKind, result repository.BatchResult) batchResult {
+	if result.Err != nil {
+		statusCode, message, _ := errorStatus(result.Err)
+		return batchResult{Status: statusCode, Error: message}
+	}
+
+	switch op {
+	case repository.BatchCreate:
+		return batchResult{Status: http.StatusCreated, Note: &result.Note}
+	case repository.BatchDelete:
+		return batchResult{Status: http.StatusNoContent}
+	default:
+		return batchResult{Status: http.StatusOK, Note: &result.Note}
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+func TestPostBatch(t *testing.T) {
+	mockRepo := &MockRepository{
+		BatchFunc: func(ctx context.Context, ops []repository.BatchOp, atomic bool) ([]repository.BatchResult, error) {
+			results := make([]repository.BatchResult, len(ops))
+			for i, op := range ops {
+				switch {
+				case op.Op != repository.BatchDelete:
+					results[i].Note = repository.Note{ID: uint64(i + 1), Title: op.Note.Title, Version: 1}
+				case op.ID != 1:
+					results[i].Err = repository.ErrNotFoundID
+				}
+			}
+			if !atomic {
+				return results, nil
+			}
+			for i, result := range results {
+				if result.Err != nil {
+					for j := range results {
+						results[j] = repository.BatchResult{Err: repository.ErrBatchRolledBack}
+					}
+					results[i].Err = result.Err
+					return results, repository.ErrBatchRolledBack
+				}
+			}
+			return results, nil
+		},
+	}
+
+	testTable := []struct {
+		name        string
+		req         string
+		contentType string
+		expStatus   int
+		expBody     string
+	}{
+		{
+			name:        "atomic",
+			req:         `{"ops":[{"op":"create","note":{"title":"a"}},{"op":"delete","id":1}]}`,
+			contentType: "application/json",
+			expStatus:   http.StatusOK,
+			expBody:     `[{"status":201,"note":{"id":1,"title":"a","description":"","done":false,"version":1}},{"status":204}]`,
+		},
+		{
+			name:        "atomic rolled back",
+			req:         `{"mode":"atomic","ops":[{"op":"create","note":{"title":"a"}},{"op":"delete","id":7}]}`,
+			contentType: "application/json",
+			expStatus:   http.StatusNotFound,
+			expBody:     `[{"status":424,"error":"batch rolled back"},{"status":404,"error":"note by ID not found"}]`,
+		},
+		{
+			name:        "continue",
+			req:         `{"mode":"continue","ops":[{"op":"delete","id":7},{"op":"update","id":1,"note":{"title":"b"}}]}`,
+			contentType: "application/json",
+			expStatus:   http.StatusOK,
+			expBody:     `[{"status":404,"error":"note by ID not found"},{"status":200,"note":{"id":2,"title":"b","description":"","done":false,"version":1}}]`,
+		},
+		{
+			name:        "unknown mode",
+			req:         `{"mode":"maybe","ops":[{"op":"create","note":{"title":"a"}}]}`,
+			contentType: "application/json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     `mode must be "atomic" or "continue"`,
+		},
+		{
+			name:        "empty batch",
+			req:         `{"ops":[]}`,
+			contentType: "application/json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "batch must have from 1 to 1000 operations",
+		},
+		{
+			name:        "unknown op",
+			req:         `{"ops":[{"op":"create","note":{"title":"a"}},{"op":"move","id":1}]}`,
+			contentType: "application/json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "operation 1: op must be create, update or delete",
+		},
+		{
+			name:        "update without id",
+			req:         `{"ops":[{"op":"update","note":{"title":"a"}}]}`,
+			contentType: "application/json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "operation 0: id is required",
+		},
+		{
+			name:        "blank title",
+			req:         `{"ops":[{"op":"create","note":{"title":"a"}},{"op":"update","id":1,"note":{"title":"   "}}]}`,
+			contentType: "application/json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "operation 1: note must have a title",
+		},
+		{
+			name:        "invalid json",
+			req:         `{"ops":`,
+			contentType: "application/json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "invalid json",
+		},
+		{
+			name:        "wrong content type",
+			req:         `{"ops":[]}`,
+			contentType: "text/plain",
+			expStatus:   http.StatusUnsupportedMediaType,
+			expBody:     "invalid media-type, must be application/json",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := NewHandler(mockRepo)
+
+			req := httptest.NewRequest(http.MethodPost, "/todos/batch", strings.NewReader(testCase.req))
+			req.Header.Set("Content-Type", testCase.contentType)
+			rec := httptest.NewRecorder()
+
+			handler.HandleBatch().ServeHTTP(rec, req)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
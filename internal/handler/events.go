@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fwhyjke/golang_test/internal/events"
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+// heartbeatInterval is how often an idle event stream gets a comment line, so
+// that proxies and clients do not take it for dead.
+const heartbeatInterval = 15 * time.Second
+
+// reconnectDelay is the delay the client is told to wait before reconnecting.
+const reconnectDelay = 3 * time.Second
+
+type EventsHandler struct {
+	bus       *events.Bus
+	heartbeat time.Duration
+}
+
+func NewEventsHandler(bus *events.Bus) *EventsHandler {
+	return &EventsHandler{
+		bus:       bus,
+		heartbeat: heartbeatInterval,
+	}
+}
+
+func (h *EventsHandler) HandleEvents() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			h.streamEvents(w, r)
+		},
+	)
+}
+
+// streamEvents sends the changes of the notes of the tenant as Server-Sent
+// Events until the client goes away. A client that reconnects with
+// Last-Event-ID first gets the events it missed; if they are no longer kept it
+// gets a "reset" event and should reload the notes.
+func (h *EventsHandler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		http.Error(w, "Accept must include text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+
+	tenant := repository.TenantFrom(r.Context())
+	filter := func(ev repository.Event) bool {
+		return ev.Tenant == tenant
+	}
+
+	var sub *events.Subscription
+	resumed := true
+	if lastID == "" {
+		sub = h.bus.Subscribe(events.DefaultBuffer, filter)
+	} else {
+		after, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			http.Error(w, "Last-Event-ID must be an event number", http.StatusBadRequest)
+			return
+		}
+		sub, resumed = h.bus.SubscribeFrom(after, events.DefaultBuffer, filter)
+	}
+	defer sub.Close()
+
+	// The stream outlives the write timeout of the server.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", reconnectDelay.Milliseconds())
+	if !resumed {
+		fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", sub.Start())
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, ok := <-sub.Events():
+			// A dropped subscriber ends the stream; the client reconnects
+			// with Last-Event-ID and catches up from the kept events.
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Seq, ev.Type, data)
+		case <-ticker.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
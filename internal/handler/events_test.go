@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwhyjke/golang_test/internal/events"
+	"github.com/fwhyjke/golang_test/internal/middleware"
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+// nextEvent returns the next event of an SSE stream without its data line,
+// skipping heartbeats and the retry hint.
+func nextEvent(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && len(lines) > 0:
+			return strings.Join(lines, " ")
+		case line == "", strings.HasPrefix(line, ":"), strings.HasPrefix(line, "retry:"), strings.HasPrefix(line, "data:"):
+		default:
+			lines = append(lines, line)
+		}
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	bus := events.NewBus(10)
+	handler := NewEventsHandler(bus)
+	handler.heartbeat = 10 * time.Millisecond
+	tokens := middleware.TenantTokens{}
+	tokens.Add("default-token", repository.DefaultTenant)
+	tokens.Add("acme-token", "acme")
+	srv := httptest.NewServer(middleware.Chain(handler.HandleEvents(), middleware.TenantMiddleware(tokens)))
+	t.Cleanup(srv.Close)
+
+	bus.Publish(
+		repository.Event{Type: repository.NoteCreated, Tenant: repository.DefaultTenant, NoteID: 1},
+		repository.Event{Type: repository.NoteCreated, Tenant: "acme", NoteID: 1},
+		repository.Event{Type: repository.NoteUpdated, Tenant: repository.DefaultTenant, NoteID: 1},
+	)
+
+	open := func(header http.Header) *http.Response {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		t.Cleanup(cancel)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		req.Header = header
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+		return res
+	}
+
+	res := open(http.Header{"Accept": {"text/event-stream"}, "Authorization": {"Bearer default-token"}, "Last-Event-Id": {"1"}})
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("content type: expected text/event-stream, got %v", ct)
+	}
+	stream := bufio.NewReader(res.Body)
+	if ev := nextEvent(t, stream); ev != "id: 3 event: note.updated" {
+		t.Errorf("resumed event: expected id 3, got %q", ev)
+	}
+	bus.Publish(repository.Event{Type: repository.NoteDeleted, Tenant: repository.DefaultTenant, NoteID: 1})
+	if ev := nextEvent(t, stream); ev != "id: 4 event: note.deleted" {
+		t.Errorf("live event: expected id 4, got %q", ev)
+	}
+
+	res = open(http.Header{"Accept": {"text/event-stream"}, "Authorization": {"Bearer acme-token"}, "Last-Event-Id": {"99"}})
+	if ev := nextEvent(t, bufio.NewReader(res.Body)); ev != "id: 4 event: reset" {
+		t.Errorf("unknown id: expected reset at 4, got %q", ev)
+	}
+
+	testTable := []struct {
+		name      string
+		header    http.Header
+		expStatus int
+	}{
+		{
+			name:      "not an event stream",
+			header:    http.Header{"Accept": {"application/json"}, "Authorization": {"Bearer default-token"}},
+			expStatus: http.StatusNotAcceptable,
+		},
+		{
+			name:      "invalid last event id",
+			header:    http.Header{"Accept": {"text/event-stream"}, "Authorization": {"Bearer default-token"}, "Last-Event-Id": {"abc"}},
+			expStatus: http.StatusBadRequest,
+		},
+		{
+			name:      "no token",
+			header:    http.Header{"Accept": {"text/event-stream"}},
+			expStatus: http.StatusUnauthorized,
+		},
+		{
+			name:      "unknown token",
+			header:    http.Header{"Accept": {"text/event-stream"}, "Authorization": {"Bearer other-token"}},
+			expStatus: http.StatusUnauthorized,
+		},
+		{
+			name:      "tenant header instead of token",
+			header:    http.Header{"Accept": {"text/event-stream"}, "X-Tenant-Id": {"acme"}},
+			expStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			if status := open(testCase.header).StatusCode; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+		})
+	}
+}
@@ -1,47 +1,81 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fwhyjke/golang_test/internal/repository"
 )
 
 type Handler struct {
-	repo repository.NoteRepository
+	repo        repository.NoteRepository
+	idempotency *idempotencyStore
+	origins     []string
 }
 
-func NewHandler(repo repository.NoteRepository) *Handler {
-	return &Handler{
-		repo: repo,
+func NewHandler(repo repository.NoteRepository, opts ...Option) *Handler {
+	h := &Handler{
+		repo:        repo,
+		idempotency: newIdempotencyStore(),
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *Handler) postNote(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	h.idempotent(w, r, func(w http.ResponseWriter, r *http.Request) {
+		h.createNote(w, r, nil)
+	})
+}
+
+// createNote creates a note from the request body. A non-nil listID overrides
+// the list given in the body.
+func (h *Handler) createNote(w http.ResponseWriter, r *http.Request, listID *uint64) {
+	ctx, err := forceContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if !(r.Header.Get("Content-Type") == "application/json") {
 		http.Error(w, "invalid media-type, must be application/json", http.StatusUnsupportedMediaType)
 		return
 	}
 
 	var dto repository.NoteDTO
-	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxNoteBody)).Decode(&dto); err != nil {
+		if bodyTooLarge(err) {
+			http.Error(w, errBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, decodeError(err).Error(), http.StatusBadRequest)
 		return
 	}
 
-	if strings.TrimSpace(dto.Title) == "" {
-		http.Error(w, "note must have a title", http.StatusBadRequest)
+	if err := checkNote(dto); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
+	if listID != nil {
+		dto.ListID = listID
+	}
+
 	note, err := h.repo.Create(ctx, dto)
 	if err != nil {
 		handleError(w, err)
 		return
 	}
 
+	setETag(w, note)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(note)
@@ -50,7 +84,90 @@ func (h *Handler) postNote(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) getNotes(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	notes, err := h.repo.GetAll(ctx)
+	q, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	page, err := h.repo.List(ctx, q)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if page.NextCursor != "" {
+		setNextPage(w, r, page.NextCursor)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page.Notes)
+}
+
+func (h *Handler) searchNotes(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	q := repository.SearchQuery{
+		Text:  r.URL.Query().Get("q"),
+		Limit: defaultSearchLimit,
+	}
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			http.Error(w, fmt.Sprintf("limit must be an integer from 1 to %d", maxPageLimit), http.StatusBadRequest)
+			return
+		}
+		q.Limit = limit
+	}
+
+	hits, err := h.repo.Search(ctx, q)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hits)
+}
+
+func (h *Handler) getAgenda(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	loc := time.UTC
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			http.Error(w, fmt.Sprintf("unknown time zone %q", tz), http.StatusBadRequest)
+			return
+		}
+	}
+
+	agenda, err := h.repo.Agenda(ctx, loc)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agenda)
+}
+
+func (h *Handler) getExecutionOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	notes, err := h.repo.ExecutionOrder(ctx)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notes)
+}
+
+func (h *Handler) getUnblocked(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	notes, err := h.repo.Unblocked(ctx)
 	if err != nil {
 		handleError(w, err)
 		return
@@ -69,34 +186,250 @@ func (h *Handler) getNoteByID(w http.ResponseWriter, r *http.Request, id uint64)
 		return
 	}
 
+	setETag(w, note)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(note)
 }
 
-func (h *Handler) putNoteByID(w http.ResponseWriter, r *http.Request, id uint64) {
+func (h *Handler) getChildren(w http.ResponseWriter, r *http.Request, id uint64) {
 	ctx := r.Context()
+
+	notes, err := h.repo.Children(ctx, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notes)
+}
+
+func (h *Handler) getTree(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+
+	tree, err := h.repo.Tree(ctx, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tree)
+}
+
+func (h *Handler) getRevisions(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+
+	revisions, err := h.repo.Revisions(ctx, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+func (h *Handler) getRevision(w http.ResponseWriter, r *http.Request, id uint64, rev uint64) {
+	ctx := r.Context()
+
+	revision, err := h.repo.Revision(ctx, id, rev)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revision)
+}
+
+// revertNote handles POST /todos/{id}/revert?to=rev. It honors If-Match and
+// ?force like the other writes.
+func (h *Handler) revertNote(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx, err := forceContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rev, err := strconv.ParseUint(r.URL.Query().Get("to"), 10, 64)
+	if err != nil {
+		http.Error(w, "to must be a revision number", http.StatusBadRequest)
+		return
+	}
+
+	version, _, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	note, err := h.repo.Revert(ctx, id, version, rev)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	setETag(w, note)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
+
+func (h *Handler) putNoteByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx, err := forceContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	if !(r.Header.Get("Content-Type") == "application/json") {
 		http.Error(w, "invalid media-type, must be application/json", http.StatusUnsupportedMediaType)
 	}
 
 	var dto repository.NoteDTO
 	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		http.Error(w, decodeError(err).Error(), http.StatusBadRequest)
 		return
 	}
 
-	if strings.TrimSpace(dto.Title) == "" {
+	if err := checkNote(dto); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	version, conditional, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	note, err := h.updateNote(ctx, id, version, conditional, dto)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	setETag(w, note)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(note)
+}
+
+func (h *Handler) patchNoteByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	switch r.Header.Get("Content-Type") {
+	case "application/merge-patch+json":
+		h.mergePatchNoteByID(w, r, id)
+	case "application/json-patch+json":
+		h.jsonPatchNoteByID(w, r, id)
+	default:
+		http.Error(w, "invalid media-type, must be application/merge-patch+json or application/json-patch+json", http.StatusUnsupportedMediaType)
+	}
+}
+
+func (h *Handler) mergePatchNoteByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx, err := forceContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	patch, err := decodeMergePatch(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if patch.Title != nil && strings.TrimSpace(*patch.Title) == "" {
 		http.Error(w, "note must have a title", http.StatusBadRequest)
 		return
 	}
 
-	note, err := h.repo.Update(ctx, id, dto)
+	if patch.Recurrence != nil {
+		if err := checkRecurrence(*patch.Recurrence); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	version, _, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	note, err := h.repo.Patch(ctx, id, version, patch)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	setETag(w, note)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(note)
+}
+
+func (h *Handler) jsonPatchNoteByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx, err := forceContext(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ops, err := decodeJSONPatch(r.Body)
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	version, _, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The note is read, checked and updated in one transaction, so "test"
+	// ops and If-Match see the same state the update is applied to.
+	var note repository.Note
+	var patchErr error
+	err = h.repo.WithTx(ctx, func(tx repository.NoteTx) error {
+		current, err := tx.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if version != repository.AnyVersion && current.Version != version {
+			return repository.ErrVersionMismatch
+		}
+
+		dto, err := applyJSONPatchToNote(current, ops)
+		if err == nil && strings.TrimSpace(dto.Title) == "" {
+			err = errTitleRemoved
+		}
+		if err == nil {
+			err = checkRecurrence(dto.Recurrence)
+		}
+		if err != nil {
+			patchErr = err
+			return err
+		}
+
+		note, err = tx.UpdateIfMatch(ctx, id, current.Version, dto)
+		return err
+	})
+	switch {
+	case errors.Is(patchErr, errPatchTestFailed):
+		http.Error(w, patchErr.Error(), http.StatusConflict)
+		return
+	case patchErr != nil:
+		http.Error(w, patchErr.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
 		handleError(w, err)
 		return
 	}
 
+	setETag(w, note)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(note)
@@ -105,10 +438,43 @@ func (h *Handler) putNoteByID(w http.ResponseWriter, r *http.Request, id uint64)
 func (h *Handler) deleteNoteByID(w http.ResponseWriter, r *http.Request, id uint64) {
 	ctx := r.Context()
 
-	if err := h.repo.Delete(ctx, id); err != nil {
+	version, conditional, err := parseIfMatch(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mode := repository.DeleteMode(r.URL.Query().Get("children"))
+	if err := checkDeleteMode(mode); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.deleteNote(ctx, id, version, conditional, mode); err != nil {
 		handleError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// updateNote replaces a note, checking its version only if conditional is set.
+func (h *Handler) updateNote(ctx context.Context, id uint64, version uint64, conditional bool, dto repository.NoteDTO) (repository.Note, error) {
+	if conditional {
+		return h.repo.UpdateIfMatch(ctx, id, version, dto)
+	}
+	return h.repo.Update(ctx, id, dto)
+}
+
+// deleteNote moves a note to the trash, checking its version only if
+// conditional is set. An empty mode refuses to delete a note with subtasks.
+func (h *Handler) deleteNote(ctx context.Context, id uint64, version uint64, conditional bool, mode repository.DeleteMode) error {
+	switch {
+	case mode != "":
+		return h.repo.DeleteWithChildren(ctx, id, version, mode)
+	case conditional:
+		return h.repo.DeleteIfMatch(ctx, id, version)
+	default:
+		return h.repo.Delete(ctx, id)
+	}
+}
@@ -3,20 +3,39 @@ package handler
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/fwhyjke/golang_test/internal/repository"
 )
 
 type MockRepository struct {
-	CreateFunc  func(ctx context.Context, dto repository.NoteDTO) (repository.Note, error)
-	GetByIDFunc func(ctx context.Context, id uint64) (repository.Note, error)
-	GetAllFunc  func(ctx context.Context) ([]repository.Note, error)
-	UpdateFunc  func(ctx context.Context, id uint64, dto repository.NoteDTO) (repository.Note, error)
-	DeleteFunc  func(ctx context.Context, id uint64) error
+	CreateFunc             func(ctx context.Context, dto repository.NoteDTO) (repository.Note, error)
+	GetByIDFunc            func(ctx context.Context, id uint64) (repository.Note, error)
+	GetAllFunc             func(ctx context.Context) ([]repository.Note, error)
+	UpdateFunc             func(ctx context.Context, id uint64, dto repository.NoteDTO) (repository.Note, error)
+	DeleteFunc             func(ctx context.Context, id uint64) error
+	UpdateIfMatchFunc      func(ctx context.Context, id uint64, version uint64, dto repository.NoteDTO) (repository.Note, error)
+	DeleteIfMatchFunc      func(ctx context.Context, id uint64, version uint64) error
+	PatchFunc              func(ctx context.Context, id uint64, version uint64, patch repository.NotePatch) (repository.Note, error)
+	ListFunc               func(ctx context.Context, q repository.ListQuery) (repository.NotePage, error)
+	SearchFunc             func(ctx context.Context, q repository.SearchQuery) ([]repository.SearchHit, error)
+	AgendaFunc             func(ctx context.Context, loc *time.Location) (repository.Agenda, error)
+	ChildrenFunc           func(ctx context.Context, id uint64) ([]repository.Note, error)
+	TreeFunc               func(ctx context.Context, id uint64) (repository.NoteTree, error)
+	DeleteWithChildrenFunc func(ctx context.Context, id uint64, version uint64, mode repository.DeleteMode) error
+	ExecutionOrderFunc     func(ctx context.Context) ([]repository.Note, error)
+	UnblockedFunc          func(ctx context.Context) ([]repository.Note, error)
+	RevisionsFunc          func(ctx context.Context, id uint64) ([]repository.Revision, error)
+	RevisionFunc           func(ctx context.Context, id uint64, rev uint64) (repository.Revision, error)
+	RevertFunc             func(ctx context.Context, id uint64, version uint64, rev uint64) (repository.Note, error)
+	BatchFunc              func(ctx context.Context, ops []repository.BatchOp, atomic bool) ([]repository.BatchResult, error)
+	WithTxFunc             func(ctx context.Context, fn func(tx repository.NoteTx) error) error
 }
 
 func (m *MockRepository) Create(ctx context.Context, dto repository.NoteDTO) (repository.Note, error) {
@@ -54,6 +73,118 @@ func (m *MockRepository) Delete(ctx context.Context, id uint64) error {
 	return nil
 }
 
+func (m *MockRepository) UpdateIfMatch(ctx context.Context, id uint64, version uint64, dto repository.NoteDTO) (repository.Note, error) {
+	if m.UpdateIfMatchFunc != nil {
+		return m.UpdateIfMatchFunc(ctx, id, version, dto)
+	}
+	return repository.Note{}, nil
+}
+
+func (m *MockRepository) DeleteIfMatch(ctx context.Context, id uint64, version uint64) error {
+	if m.DeleteIfMatchFunc != nil {
+		return m.DeleteIfMatchFunc(ctx, id, version)
+	}
+	return nil
+}
+
+func (m *MockRepository) Patch(ctx context.Context, id uint64, version uint64, patch repository.NotePatch) (repository.Note, error) {
+	if m.PatchFunc != nil {
+		return m.PatchFunc(ctx, id, version, patch)
+	}
+	return repository.Note{}, nil
+}
+
+func (m *MockRepository) List(ctx context.Context, q repository.ListQuery) (repository.NotePage, error) {
+	if m.ListFunc != nil {
+		return m.ListFunc(ctx, q)
+	}
+	return repository.NotePage{Notes: []repository.Note{}}, nil
+}
+
+func (m *MockRepository) Search(ctx context.Context, q repository.SearchQuery) ([]repository.SearchHit, error) {
+	if m.SearchFunc != nil {
+		return m.SearchFunc(ctx, q)
+	}
+	return []repository.SearchHit{}, nil
+}
+
+func (m *MockRepository) Agenda(ctx context.Context, loc *time.Location) (repository.Agenda, error) {
+	if m.AgendaFunc != nil {
+		return m.AgendaFunc(ctx, loc)
+	}
+	return repository.Agenda{}, nil
+}
+
+func (m *MockRepository) Children(ctx context.Context, id uint64) ([]repository.Note, error) {
+	if m.ChildrenFunc != nil {
+		return m.ChildrenFunc(ctx, id)
+	}
+	return []repository.Note{}, nil
+}
+
+func (m *MockRepository) Tree(ctx context.Context, id uint64) (repository.NoteTree, error) {
+	if m.TreeFunc != nil {
+		return m.TreeFunc(ctx, id)
+	}
+	return repository.NoteTree{}, nil
+}
+
+func (m *MockRepository) DeleteWithChildren(ctx context.Context, id uint64, version uint64, mode repository.DeleteMode) error {
+	if m.DeleteWithChildrenFunc != nil {
+		return m.DeleteWithChildrenFunc(ctx, id, version, mode)
+	}
+	return nil
+}
+
+func (m *MockRepository) ExecutionOrder(ctx context.Context) ([]repository.Note, error) {
+	if m.ExecutionOrderFunc != nil {
+		return m.ExecutionOrderFunc(ctx)
+	}
+	return []repository.Note{}, nil
+}
+
+func (m *MockRepository) Unblocked(ctx context.Context) ([]repository.Note, error) {
+	if m.UnblockedFunc != nil {
+		return m.UnblockedFunc(ctx)
+	}
+	return []repository.Note{}, nil
+}
+
+func (m *MockRepository) Revisions(ctx context.Context, id uint64) ([]repository.Revision, error) {
+	if m.RevisionsFunc != nil {
+		return m.RevisionsFunc(ctx, id)
+	}
+	return []repository.Revision{}, nil
+}
+
+func (m *MockRepository) Revision(ctx context.Context, id uint64, rev uint64) (repository.Revision, error) {
+	if m.RevisionFunc != nil {
+		return m.RevisionFunc(ctx, id, rev)
+	}
+	return repository.Revision{}, nil
+}
+
+func (m *MockRepository) Revert(ctx context.Context, id uint64, version uint64, rev uint64) (repository.Note, error) {
+	if m.RevertFunc != nil {
+		return m.RevertFunc(ctx, id, version, rev)
+	}
+	return repository.Note{}, nil
+}
+
+func (m *MockRepository) Batch(ctx context.Context, ops []repository.BatchOp, atomic bool) ([]repository.BatchResult, error) {
+	if m.BatchFunc != nil {
+		return m.BatchFunc(ctx, ops, atomic)
+	}
+	return []repository.BatchResult{}, nil
+}
+
+func (m *MockRepository) WithTx(ctx context.Context, fn func(tx repository.NoteTx) error) error {
+	if m.WithTxFunc != nil {
+		return m.WithTxFunc(ctx, fn)
+	}
+	return fn(m)
+}
+
 func TestPostNote(t *testing.T) {
 	testTable := []struct {
 		name        string
@@ -76,7 +207,7 @@ func TestPostNote(t *testing.T) {
 				}, nil
 			},
 			expStatus: http.StatusCreated,
-			expBody:   `{"id":1,"title":"123","description":"qwe","done":true}`,
+			expBody:   `{"id":1,"title":"123","description":"qwe","done":true,"version":0}`,
 		},
 		{
 			name:        "empty title",
@@ -92,6 +223,20 @@ func TestPostNote(t *testing.T) {
 			expStatus:   http.StatusBadRequest,
 			expBody:     "invalid json",
 		},
+		{
+			name:        "invalid due date",
+			req:         `{"title": "123", "due_at": "tomorrow"}`,
+			contentType: "application/json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "due_at must be an RFC 3339 time",
+		},
+		{
+			name:        "unsupported recurrence",
+			req:         `{"title": "123", "due_at": "2025-01-31T09:30:00Z", "recurrence": "FREQ=YEARLY"}`,
+			contentType: "application/json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "invalid recurrence rule: FREQ=YEARLY is not supported, use DAILY, WEEKLY or MONTHLY",
+		},
 		{
 			name:        "wrong content type",
 			req:         `{"title": "123"}`,
@@ -158,34 +303,111 @@ func TestPostNote(t *testing.T) {
 
 func TestGetNotes(t *testing.T) {
 	testTable := []struct {
-		name       string
-		mockGetAll func(ctx context.Context) ([]repository.Note, error)
-		expStatus  int
-		expBody    string
+		name      string
+		url       string
+		mockList  func(ctx context.Context, q repository.ListQuery) (repository.NotePage, error)
+		expStatus int
+		expBody   string
+		expLink   string
 	}{
 		{
 			name: "success couple",
-			mockGetAll: func(ctx context.Context) ([]repository.Note, error) {
-				return []repository.Note{
+			url:  "/todos",
+			mockList: func(ctx context.Context, q repository.ListQuery) (repository.NotePage, error) {
+				return repository.NotePage{Notes: []repository.Note{
 					{ID: 1, Title: "t1", Description: "d1", Done: false},
 					{ID: 2, Title: "n2", Description: "d2", Done: true},
-				}, nil
+				}}, nil
 			},
 			expStatus: http.StatusOK,
-			expBody:   `[{"id":1,"title":"t1","description":"d1","done":false},{"id":2,"title":"n2","description":"d2","done":true}]`,
+			expBody:   `[{"id":1,"title":"t1","description":"d1","done":false,"version":0},{"id":2,"title":"n2","description":"d2","done":true,"version":0}]`,
 		},
 		{
 			name: "success empty",
-			mockGetAll: func(ctx context.Context) ([]repository.Note, error) {
-				return []repository.Note{}, nil
+			url:  "/todos",
+			mockList: func(ctx context.Context, q repository.ListQuery) (repository.NotePage, error) {
+				return repository.NotePage{Notes: []repository.Note{}}, nil
+			},
+			expStatus: http.StatusOK,
+			expBody:   "[]",
+		},
+		{
+			name: "next page",
+			url:  "/todos?limit=1&cursor=abc",
+			mockList: func(ctx context.Context, q repository.ListQuery) (repository.NotePage, error) {
+				if q.Limit != 1 || q.Cursor != "abc" {
+					return repository.NotePage{}, errors.New("unexpected query")
+				}
+				return repository.NotePage{
+					Notes:      []repository.Note{{ID: 2, Title: "n2"}},
+					NextCursor: "def",
+				}, nil
+			},
+			expStatus: http.StatusOK,
+			expBody:   `[{"id":2,"title":"n2","description":"","done":false,"version":0}]`,
+			expLink:   `</todos?cursor=def&limit=1>; rel="next"`,
+		},
+		{
+			name: "filter and sort",
+			url:  "/todos?done=false&title[contains]=milk&id[gte]=2&sort=-id",
+			mockList: func(ctx context.Context, q repository.ListQuery) (repository.NotePage, error) {
+				expFilters := []repository.Filter{
+					{Field: "done", Op: repository.OpEq, Value: false},
+					{Field: "id", Op: repository.OpGte, Value: uint64(2)},
+					{Field: "title", Op: repository.OpContains, Value: "milk"},
+				}
+				expSort := []repository.SortKey{{Field: "id", Desc: true}}
+				if !slices.Equal(q.Filters, expFilters) || !slices.Equal(q.Sort, expSort) {
+					return repository.NotePage{}, fmt.Errorf("unexpected query %+v", q)
+				}
+				return repository.NotePage{Notes: []repository.Note{}}, nil
 			},
 			expStatus: http.StatusOK,
 			expBody:   "[]",
 		},
+		{
+			name: "tags",
+			url:  "/todos?tag=Backend,frontend&tag=urgent",
+			mockList: func(ctx context.Context, q repository.ListQuery) (repository.NotePage, error) {
+				if len(q.Tags) != 2 || !slices.Equal(q.Tags[0], []string{"backend", "frontend"}) || !slices.Equal(q.Tags[1], []string{"urgent"}) {
+					return repository.NotePage{}, fmt.Errorf("unexpected query %+v", q)
+				}
+				return repository.NotePage{Notes: []repository.Note{{ID: 1, Title: "t1", Tags: []string{"backend", "urgent"}}}}, nil
+			},
+			expStatus: http.StatusOK,
+			expBody:   `[{"id":1,"title":"t1","description":"","done":false,"version":0,"tags":["backend","urgent"]}]`,
+		},
+		{
+			name:      "empty tag",
+			url:       "/todos?tag=backend,",
+			expStatus: http.StatusBadRequest,
+			expBody:   `{"error":"invalid query","details":[{"param":"tag","message":"tag names must not be empty"}]}`,
+		},
+		{
+			name:      "invalid query",
+			url:       "/todos?limit=0&priority=1&done[gt]=true&id=abc&sort=-priority",
+			expStatus: http.StatusBadRequest,
+			expBody: `{"error":"invalid query","details":[` +
+				`{"param":"done[gt]","message":"operator \"gt\" is not supported for field \"done\""},` +
+				`{"param":"id","message":"\"abc\" is not a non-negative integer"},` +
+				`{"param":"limit","message":"must be an integer from 1 to 1000"},` +
+				`{"param":"priority","message":"unknown field \"priority\""},` +
+				`{"param":"sort","message":"unknown sort field \"priority\""}]}`,
+		},
+		{
+			name: "invalid cursor",
+			url:  "/todos?cursor=abc",
+			mockList: func(ctx context.Context, q repository.ListQuery) (repository.NotePage, error) {
+				return repository.NotePage{}, repository.ErrInvalidCursor
+			},
+			expStatus: http.StatusBadRequest,
+			expBody:   "bad request: invalid cursor",
+		},
 		{
 			name: "context cancelled",
-			mockGetAll: func(ctx context.Context) ([]repository.Note, error) {
-				return nil, context.Canceled
+			url:  "/todos",
+			mockList: func(ctx context.Context, q repository.ListQuery) (repository.NotePage, error) {
+				return repository.NotePage{}, context.Canceled
 			},
 			expStatus: http.StatusGatewayTimeout,
 			expBody:   "time is out",
@@ -194,10 +416,10 @@ func TestGetNotes(t *testing.T) {
 
 	for _, testCase := range testTable {
 		t.Run(testCase.name, func(t *testing.T) {
-			mockRepo := &MockRepository{GetAllFunc: testCase.mockGetAll}
+			mockRepo := &MockRepository{ListFunc: testCase.mockList}
 			handler := NewHandler(mockRepo)
 
-			req := httptest.NewRequest("GET", "/todos", nil)
+			req := httptest.NewRequest("GET", testCase.url, nil)
 			rec := httptest.NewRecorder()
 
 			handler.getNotes(rec, req)
@@ -212,175 +434,1023 @@ func TestGetNotes(t *testing.T) {
 				t.Errorf("body: expected %v, got %v", expectedBody, body)
 			}
 
+			if link := rec.Header().Get("Link"); link != testCase.expLink {
+				t.Errorf("link: expected %v, got %v", testCase.expLink, link)
+			}
 		})
 	}
 }
 
-func TestGetNoteByID(t *testing.T) {
+func TestSearchNotes(t *testing.T) {
 	testTable := []struct {
-		name        string
-		id          uint64
-		mockGetByID func(ctx context.Context, id uint64) (repository.Note, error)
-		expStatus   int
-		expBody     string
+		name       string
+		url        string
+		mockSearch func(ctx context.Context, q repository.SearchQuery) ([]repository.SearchHit, error)
+		expStatus  int
+		expBody    string
 	}{
 		{
 			name: "success",
-			id:   1,
-			mockGetByID: func(ctx context.Context, id uint64) (repository.Note, error) {
-				return repository.Note{
-					ID:          id,
-					Title:       "qwe",
-					Description: "qwe",
-					Done:        false,
-				}, nil
+			url:  "/todos/search?q=%D0%BC%D0%BE%D0%BB%D0%BE%D0%BA*&limit=5",
+			mockSearch: func(ctx context.Context, q repository.SearchQuery) ([]repository.SearchHit, error) {
+				if q.Text != "молок*" || q.Limit != 5 {
+					return nil, fmt.Errorf("unexpected query %+v", q)
+				}
+				return []repository.SearchHit{{
+					Note:       repository.Note{ID: 1, Title: "Купить молоко", Version: 1},
+					Score:      1.5,
+					Highlights: map[string]string{"title": "Купить <mark>молоко</mark>"},
+				}}, nil
 			},
 			expStatus: http.StatusOK,
-			expBody:   `{"id":1,"title":"qwe","description":"qwe","done":false}`,
+			expBody:   `[{"note":{"id":1,"title":"Купить молоко","description":"","done":false,"version":1},"score":1.5,"highlights":{"title":"Купить \u003cmark\u003eмолоко\u003c/mark\u003e"}}]`,
 		},
 		{
-			name: "invalid id",
-			id:   12345,
-			mockGetByID: func(ctx context.Context, id uint64) (repository.Note, error) {
-				return repository.Note{}, repository.ErrNotFoundID
+			name: "empty query",
+			url:  "/todos/search?q=%20",
+			mockSearch: func(ctx context.Context, q repository.SearchQuery) ([]repository.SearchHit, error) {
+				return nil, repository.ErrEmptySearch
 			},
-			expStatus: http.StatusNotFound,
-			expBody:   "note by ID not found",
+			expStatus: http.StatusBadRequest,
+			expBody:   "bad request: search query has no words",
+		},
+		{
+			name:      "invalid limit",
+			url:       "/todos/search?q=a&limit=-1",
+			expStatus: http.StatusBadRequest,
+			expBody:   "limit must be an integer from 1 to 1000",
 		},
 	}
 
 	for _, testCase := range testTable {
 		t.Run(testCase.name, func(t *testing.T) {
-			mockRepo := &MockRepository{GetByIDFunc: testCase.mockGetByID}
+			mockRepo := &MockRepository{SearchFunc: testCase.mockSearch}
 			handler := NewHandler(mockRepo)
 
-			req := httptest.NewRequest("GET", "/todos/1", nil)
+			req := httptest.NewRequest("GET", testCase.url, nil)
 			rec := httptest.NewRecorder()
 
-			handler.getNoteByID(rec, req, testCase.id)
+			handler.searchNotes(rec, req)
 
 			if status := rec.Code; status != testCase.expStatus {
 				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
 			}
 
 			body := strings.TrimSpace(rec.Body.String())
-			expectedBody := strings.TrimSpace(testCase.expBody)
-			if body != expectedBody {
-				t.Errorf("body: expected %v, got %v", expectedBody, body)
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
 			}
 		})
 	}
 }
 
-func TestPutNoteByID(t *testing.T) {
+func TestGetAgenda(t *testing.T) {
+	due := time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC)
+
 	testTable := []struct {
-		name        string
-		id          uint64
-		req         string
-		contentType string
-		mockUpdate  func(ctx context.Context, id uint64, dto repository.NoteDTO) (repository.Note, error)
-		expStatus   int
-		expBody     string
+		name       string
+		url        string
+		mockAgenda func(ctx context.Context, loc *time.Location) (repository.Agenda, error)
+		expStatus  int
+		expBody    string
 	}{
 		{
-			name:        "success",
-			id:          1,
-			req:         `{"title": "t", "description": "d", "done": true}`,
-			contentType: "application/json",
-			mockUpdate: func(ctx context.Context, id uint64, dto repository.NoteDTO) (repository.Note, error) {
-				return repository.Note{
-					ID:          id,
-					Title:       dto.Title,
-					Description: dto.Description,
-					Done:        dto.Done,
+			name: "success",
+			url:  "/todos/agenda?tz=Europe/Moscow",
+			mockAgenda: func(ctx context.Context, loc *time.Location) (repository.Agenda, error) {
+				if loc.String() != "Europe/Moscow" {
+					return repository.Agenda{}, fmt.Errorf("unexpected location %v", loc)
+				}
+				return repository.Agenda{
+					Overdue:  []repository.Note{{ID: 1, Title: "qwe", Version: 1, DueAt: &due, Overdue: true}},
+					Today:    []repository.Note{},
+					ThisWeek: []repository.Note{},
+					Later:    []repository.Note{},
 				}, nil
 			},
 			expStatus: http.StatusOK,
-			expBody:   `{"id":1,"title":"t","description":"d","done":true}`,
+			expBody:   `{"overdue":[{"id":1,"title":"qwe","description":"","done":false,"version":1,"due_at":"2025-03-10T09:00:00Z","overdue":true}],"today":[],"this_week":[],"later":[]}`,
 		},
 		{
-			name:        "empty title",
-			id:          1,
-			req:         `{"title": ""}`,
-			contentType: "application/json",
-			expStatus:   http.StatusBadRequest,
-			expBody:     "note must have a title",
+			name: "default time zone",
+			url:  "/todos/agenda",
+			mockAgenda: func(ctx context.Context, loc *time.Location) (repository.Agenda, error) {
+				if loc != time.UTC {
+					return repository.Agenda{}, fmt.Errorf("unexpected location %v", loc)
+				}
+				return repository.Agenda{Overdue: []repository.Note{}, Today: []repository.Note{}, ThisWeek: []repository.Note{}, Later: []repository.Note{}}, nil
+			},
+			expStatus: http.StatusOK,
+			expBody:   `{"overdue":[],"today":[],"this_week":[],"later":[]}`,
 		},
 		{
-			name:        "invalid id",
-			id:          527892,
-			req:         `{"title": "qwe"}`,
-			contentType: "application/json",
-			mockUpdate: func(ctx context.Context, id uint64, dto repository.NoteDTO) (repository.Note, error) {
-				return repository.Note{}, repository.ErrNotFoundID
+			name:      "unknown time zone",
+			url:       "/todos/agenda?tz=Mars/Olympus",
+			expStatus: http.StatusBadRequest,
+			expBody:   `unknown time zone "Mars/Olympus"`,
+		},
+		{
+			name: "context timeout",
+			url:  "/todos/agenda",
+			mockAgenda: func(ctx context.Context, loc *time.Location) (repository.Agenda, error) {
+				return repository.Agenda{}, context.DeadlineExceeded
 			},
-			expStatus: http.StatusNotFound,
-			expBody:   "note by ID not found",
+			expStatus: http.StatusGatewayTimeout,
+			expBody:   "time is out",
 		},
 	}
 
 	for _, testCase := range testTable {
 		t.Run(testCase.name, func(t *testing.T) {
-			mockRepo := &MockRepository{UpdateFunc: testCase.mockUpdate}
+			mockRepo := &MockRepository{AgendaFunc: testCase.mockAgenda}
 			handler := NewHandler(mockRepo)
 
-			req := httptest.NewRequest("PUT", "/todos/1", strings.NewReader(testCase.req))
-			req.Header.Set("Content-Type", testCase.contentType)
+			req := httptest.NewRequest("GET", testCase.url, nil)
 			rec := httptest.NewRecorder()
 
-			handler.putNoteByID(rec, req, testCase.id)
+			handler.getAgenda(rec, req)
 
 			if status := rec.Code; status != testCase.expStatus {
 				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
 			}
 
 			body := strings.TrimSpace(rec.Body.String())
-			expectedBody := strings.TrimSpace(testCase.expBody)
-			if body != expectedBody {
-				t.Errorf("body: expected %v, got %v", expectedBody, body)
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
 			}
 		})
 	}
 }
 
-func TestDeleteNoteByID(t *testing.T) {
+func TestGetSubtasks(t *testing.T) {
+	parent := uint64(1)
+	mockRepo := &MockRepository{
+		ChildrenFunc: func(ctx context.Context, id uint64) ([]repository.Note, error) {
+			if id != 1 {
+				return nil, repository.ErrNotFoundID
+			}
+			return []repository.Note{{ID: 2, Title: "child", Version: 1, ParentID: &parent}}, nil
+		},
+		TreeFunc: func(ctx context.Context, id uint64) (repository.NoteTree, error) {
+			if id != 1 {
+				return repository.NoteTree{}, repository.ErrNotFoundID
+			}
+			return repository.NoteTree{
+				Note: repository.Note{ID: 1, Title: "parent", Version: 1, Progress: &repository.Progress{Done: 1, Total: 1}},
+				Children: []repository.NoteTree{{
+					Note:     repository.Note{ID: 2, Title: "child", Done: true, Version: 1, ParentID: &parent},
+					Children: []repository.NoteTree{},
+				}},
+			}, nil
+		},
+	}
+
 	testTable := []struct {
-		name       string
-		id         uint64
-		mockDelete func(ctx context.Context, id uint64) error
-		expStatus  int
+		name      string
+		method    string
+		url       string
+		expStatus int
+		expBody   string
 	}{
 		{
-			name: "success",
-			id:   1,
-			mockDelete: func(ctx context.Context, id uint64) error {
-				return nil
-			},
-			expStatus: http.StatusNoContent,
+			name:      "children",
+			method:    http.MethodGet,
+			url:       "/todos/1/children",
+			expStatus: http.StatusOK,
+			expBody:   `[{"id":2,"title":"child","description":"","done":false,"version":1,"parent_id":1}]`,
 		},
 		{
-			name: "invalid id",
-			id:   12345,
-			mockDelete: func(ctx context.Context, id uint64) error {
-				return repository.ErrNotFoundID
-			},
+			name:      "tree",
+			method:    http.MethodGet,
+			url:       "/todos/1/tree",
+			expStatus: http.StatusOK,
+			expBody: `{"id":1,"title":"parent","description":"","done":false,"version":1,"progress":{"done":1,"total":1},"children":[` +
+				`{"id":2,"title":"child","description":"","done":true,"version":1,"parent_id":1,"children":[]}]}`,
+		},
+		{
+			name:      "missing note",
+			method:    http.MethodGet,
+			url:       "/todos/7/tree",
+			expStatus: http.StatusNotFound,
+			expBody:   "note by ID not found",
+		},
+		{
+			name:      "wrong method",
+			method:    http.MethodPost,
+			url:       "/todos/1/children",
+			expStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:      "unknown subresource",
+			method:    http.MethodGet,
+			url:       "/todos/1/parents",
 			expStatus: http.StatusNotFound,
+			expBody:   "404 page not found",
 		},
 	}
 
 	for _, testCase := range testTable {
 		t.Run(testCase.name, func(t *testing.T) {
-			mockRepo := &MockRepository{DeleteFunc: testCase.mockDelete}
 			handler := NewHandler(mockRepo)
 
-			req := httptest.NewRequest("DELETE", "/todos/1", nil)
+			req := httptest.NewRequest(testCase.method, testCase.url, nil)
 			rec := httptest.NewRecorder()
 
-			handler.deleteNoteByID(rec, req, testCase.id)
+			handler.HandleToDoByID().ServeHTTP(rec, req)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
+
+func TestGetDependencyViews(t *testing.T) {
+	mockRepo := &MockRepository{
+		ExecutionOrderFunc: func(ctx context.Context) ([]repository.Note, error) {
+			return []repository.Note{{ID: 2, Title: "t2"}, {ID: 1, Title: "t1", BlockedBy: []uint64{2}, Blocked: true}}, nil
+		},
+		UnblockedFunc: func(ctx context.Context) ([]repository.Note, error) {
+			return []repository.Note{{ID: 2, Title: "t2"}}, nil
+		},
+	}
+	handler := NewHandler(mockRepo)
+
+	testTable := []struct {
+		name      string
+		handler   http.Handler
+		method    string
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:      "execution order",
+			handler:   handler.HandleExecutionOrder(),
+			method:    http.MethodGet,
+			expStatus: http.StatusOK,
+			expBody:   `[{"id":2,"title":"t2","description":"","done":false,"version":0},{"id":1,"title":"t1","description":"","done":false,"version":0,"blocked_by":[2],"blocked":true}]`,
+		},
+		{
+			name:      "unblocked",
+			handler:   handler.HandleUnblocked(),
+			method:    http.MethodGet,
+			expStatus: http.StatusOK,
+			expBody:   `[{"id":2,"title":"t2","description":"","done":false,"version":0}]`,
+		},
+		{
+			name:      "wrong method",
+			handler:   handler.HandleUnblocked(),
+			method:    http.MethodPost,
+			expStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testCase.method, "/todos/order", nil)
+			rec := httptest.NewRecorder()
+
+			testCase.handler.ServeHTTP(rec, req)
 
 			if status := rec.Code; status != testCase.expStatus {
 				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
 			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
+
+func TestForceDone(t *testing.T) {
+	mockRepo := &MockRepository{
+		PatchFunc: func(ctx context.Context, id uint64, version uint64, patch repository.NotePatch) (repository.Note, error) {
+			if !repository.Forced(ctx) {
+				return repository.Note{}, repository.ErrBlocked
+			}
+			return repository.Note{ID: id, Title: "t", Done: true, Version: 2}, nil
+		},
+	}
+
+	testTable := []struct {
+		name      string
+		url       string
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:      "blocked",
+			url:       "/todos/1",
+			expStatus: http.StatusConflict,
+			expBody:   "note is blocked by unfinished notes",
+		},
+		{
+			name:      "forced",
+			url:       "/todos/1?force=true",
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"title":"t","description":"","done":true,"version":2}`,
+		},
+		{
+			name:      "invalid force",
+			url:       "/todos/1?force=please",
+			expStatus: http.StatusBadRequest,
+			expBody:   "force must be a boolean",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := NewHandler(mockRepo)
+
+			req := httptest.NewRequest("PATCH", testCase.url, strings.NewReader(`{"done": true}`))
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+			rec := httptest.NewRecorder()
+
+			handler.patchNoteByID(rec, req, 1)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
+
+func TestGetNoteByID(t *testing.T) {
+	testTable := []struct {
+		name        string
+		id          uint64
+		mockGetByID func(ctx context.Context, id uint64) (repository.Note, error)
+		expStatus   int
+		expBody     string
+	}{
+		{
+			name: "success",
+			id:   1,
+			mockGetByID: func(ctx context.Context, id uint64) (repository.Note, error) {
+				return repository.Note{
+					ID:          id,
+					Title:       "qwe",
+					Description: "qwe",
+					Done:        false,
+					Version:     1,
+				}, nil
+			},
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"title":"qwe","description":"qwe","done":false,"version":1}`,
+		},
+		{
+			name: "invalid id",
+			id:   12345,
+			mockGetByID: func(ctx context.Context, id uint64) (repository.Note, error) {
+				return repository.Note{}, repository.ErrNotFoundID
+			},
+			expStatus: http.StatusNotFound,
+			expBody:   "note by ID not found",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			mockRepo := &MockRepository{GetByIDFunc: testCase.mockGetByID}
+			handler := NewHandler(mockRepo)
+
+			req := httptest.NewRequest("GET", "/todos/1", nil)
+			rec := httptest.NewRecorder()
+
+			handler.getNoteByID(rec, req, testCase.id)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			expectedBody := strings.TrimSpace(testCase.expBody)
+			if body != expectedBody {
+				t.Errorf("body: expected %v, got %v", expectedBody, body)
+			}
+		})
+	}
+}
+
+func TestPutNoteByID(t *testing.T) {
+	testTable := []struct {
+		name              string
+		id                uint64
+		req               string
+		contentType       string
+		ifMatch           string
+		mockUpdate        func(ctx context.Context, id uint64, dto repository.NoteDTO) (repository.Note, error)
+		mockUpdateIfMatch func(ctx context.Context, id uint64, version uint64, dto repository.NoteDTO) (repository.Note, error)
+		expStatus         int
+		expBody           string
+		expETag           string
+	}{
+		{
+			name:        "success",
+			id:          1,
+			req:         `{"title": "t", "description": "d", "done": true}`,
+			contentType: "application/json",
+			mockUpdate: func(ctx context.Context, id uint64, dto repository.NoteDTO) (repository.Note, error) {
+				return repository.Note{
+					ID:          id,
+					Title:       dto.Title,
+					Description: dto.Description,
+					Done:        dto.Done,
+					Version:     2,
+				}, nil
+			},
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"title":"t","description":"d","done":true,"version":2}`,
+			expETag:   `"2"`,
+		},
+		{
+			name:        "empty title",
+			id:          1,
+			req:         `{"title": ""}`,
+			contentType: "application/json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "note must have a title",
+		},
+		{
+			name:        "invalid id",
+			id:          527892,
+			req:         `{"title": "qwe"}`,
+			contentType: "application/json",
+			mockUpdate: func(ctx context.Context, id uint64, dto repository.NoteDTO) (repository.Note, error) {
+				return repository.Note{}, repository.ErrNotFoundID
+			},
+			expStatus: http.StatusNotFound,
+			expBody:   "note by ID not found",
+		},
+		{
+			name:        "if-match success",
+			id:          1,
+			req:         `{"title": "t"}`,
+			contentType: "application/json",
+			ifMatch:     `"3"`,
+			mockUpdateIfMatch: func(ctx context.Context, id uint64, version uint64, dto repository.NoteDTO) (repository.Note, error) {
+				if version != 3 {
+					return repository.Note{}, repository.ErrVersionMismatch
+				}
+				return repository.Note{ID: id, Title: dto.Title, Version: 4}, nil
+			},
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"title":"t","description":"","done":false,"version":4}`,
+			expETag:   `"4"`,
+		},
+		{
+			name:        "if-match mismatch",
+			id:          1,
+			req:         `{"title": "t"}`,
+			contentType: "application/json",
+			ifMatch:     `"2"`,
+			mockUpdateIfMatch: func(ctx context.Context, id uint64, version uint64, dto repository.NoteDTO) (repository.Note, error) {
+				return repository.Note{}, repository.ErrVersionMismatch
+			},
+			expStatus: http.StatusPreconditionFailed,
+			expBody:   "note version does not match",
+		},
+		{
+			name:        "if-match weak etag",
+			id:          1,
+			req:         `{"title": "t"}`,
+			contentType: "application/json",
+			ifMatch:     `W/"2"`,
+			expStatus:   http.StatusBadRequest,
+			expBody:     `If-Match must be "*" or a single strong ETag`,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			mockRepo := &MockRepository{
+				UpdateFunc:        testCase.mockUpdate,
+				UpdateIfMatchFunc: testCase.mockUpdateIfMatch,
+			}
+			handler := NewHandler(mockRepo)
+
+			req := httptest.NewRequest("PUT", "/todos/1", strings.NewReader(testCase.req))
+			req.Header.Set("Content-Type", testCase.contentType)
+			if testCase.ifMatch != "" {
+				req.Header.Set("If-Match", testCase.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.putNoteByID(rec, req, testCase.id)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			expectedBody := strings.TrimSpace(testCase.expBody)
+			if body != expectedBody {
+				t.Errorf("body: expected %v, got %v", expectedBody, body)
+			}
+
+			if etag := rec.Header().Get("ETag"); etag != testCase.expETag {
+				t.Errorf("etag: expected %v, got %v", testCase.expETag, etag)
+			}
+		})
+	}
+}
+
+func TestPatchNoteByID(t *testing.T) {
+	stored := repository.Note{ID: 1, Title: "t", Description: "d", Done: false, Version: 1}
+	applyPatch := func(ctx context.Context, id uint64, version uint64, patch repository.NotePatch) (repository.Note, error) {
+		if version != repository.AnyVersion && version != stored.Version {
+			return repository.Note{}, repository.ErrVersionMismatch
+		}
+		n := stored
+		if patch.Title != nil {
+			n.Title = *patch.Title
+		}
+		if patch.Description != nil {
+			n.Description = *patch.Description
+		}
+		if patch.Done != nil {
+			n.Done = *patch.Done
+		}
+		if patch.DueAt != nil {
+			n.DueAt = *patch.DueAt
+		}
+		n.Version++
+		return n, nil
+	}
+
+	testTable := []struct {
+		name        string
+		req         string
+		contentType string
+		ifMatch     string
+		expStatus   int
+		expBody     string
+	}{
+		{
+			name:        "flip done",
+			req:         `{"done": true}`,
+			contentType: "application/merge-patch+json",
+			expStatus:   http.StatusOK,
+			expBody:     `{"id":1,"title":"t","description":"d","done":true,"version":2}`,
+		},
+		{
+			name:        "remove description",
+			req:         `{"description": null, "title": "new"}`,
+			contentType: "application/merge-patch+json",
+			expStatus:   http.StatusOK,
+			expBody:     `{"id":1,"title":"new","description":"","done":false,"version":2}`,
+		},
+		{
+			name:        "remove title",
+			req:         `{"title": null}`,
+			contentType: "application/merge-patch+json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "note must have a title",
+		},
+		{
+			name:        "blank title",
+			req:         `{"title": "  "}`,
+			contentType: "application/merge-patch+json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "note must have a title",
+		},
+		{
+			name:        "read-only field",
+			req:         `{"id": 5}`,
+			contentType: "application/merge-patch+json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     `field "id" cannot be patched`,
+		},
+		{
+			name:        "set due date",
+			req:         `{"due_at": "2025-03-10T12:00:00+03:00"}`,
+			contentType: "application/merge-patch+json",
+			expStatus:   http.StatusOK,
+			expBody:     `{"id":1,"title":"t","description":"d","done":false,"version":2,"due_at":"2025-03-10T12:00:00+03:00"}`,
+		},
+		{
+			name:        "remove due date",
+			req:         `{"due_at": null}`,
+			contentType: "application/merge-patch+json",
+			expStatus:   http.StatusOK,
+			expBody:     `{"id":1,"title":"t","description":"d","done":false,"version":2}`,
+		},
+		{
+			name:        "invalid due date",
+			req:         `{"due_at": "2025-03-10"}`,
+			contentType: "application/merge-patch+json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "due_at must be an RFC 3339 time",
+		},
+		{
+			name:        "invalid recurrence",
+			req:         `{"recurrence": "FREQ=WEEKLY;BYDAY=1MO"}`,
+			contentType: "application/merge-patch+json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "invalid recurrence rule: BYDAY=1MO is not supported, use two-letter day codes without ordinals",
+		},
+		{
+			name:        "wrong type",
+			req:         `{"done": "yes"}`,
+			contentType: "application/merge-patch+json",
+			expStatus:   http.StatusBadRequest,
+			expBody:     "invalid json",
+		},
+		{
+			name:        "wrong content type",
+			req:         `{"done": true}`,
+			contentType: "application/json",
+			expStatus:   http.StatusUnsupportedMediaType,
+			expBody:     "invalid media-type, must be application/merge-patch+json or application/json-patch+json",
+		},
+		{
+			name:        "if-match mismatch",
+			req:         `{"done": true}`,
+			contentType: "application/merge-patch+json",
+			ifMatch:     `"7"`,
+			expStatus:   http.StatusPreconditionFailed,
+			expBody:     "note version does not match",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			mockRepo := &MockRepository{PatchFunc: applyPatch}
+			handler := NewHandler(mockRepo)
+
+			req := httptest.NewRequest("PATCH", "/todos/1", strings.NewReader(testCase.req))
+			req.Header.Set("Content-Type", testCase.contentType)
+			if testCase.ifMatch != "" {
+				req.Header.Set("If-Match", testCase.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.patchNoteByID(rec, req, 1)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
+
+func TestJSONPatchNoteByID(t *testing.T) {
+	stored := repository.Note{ID: 1, Title: "t", Description: "d", Done: false, Version: 3}
+
+	testTable := []struct {
+		name       string
+		req        string
+		ifMatch    string
+		mockUpdate func(ctx context.Context, id uint64, version uint64, dto repository.NoteDTO) (repository.Note, error)
+		mockTx     func(ctx context.Context, fn func(tx repository.NoteTx) error) error
+		expStatus  int
+		expBody    string
+	}{
+		{
+			name:      "conditional edit",
+			req:       `[{"op":"test","path":"/done","value":false},{"op":"replace","path":"/done","value":true},{"op":"remove","path":"/description"}]`,
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"title":"t","description":"","done":true,"version":4}`,
+		},
+		{
+			name:      "failed test",
+			req:       `[{"op":"test","path":"/title","value":"other"},{"op":"replace","path":"/done","value":true}]`,
+			expStatus: http.StatusConflict,
+			expBody:   `json patch test failed: operation 0: value at "/title" differs`,
+		},
+		{
+			name:      "remove title",
+			req:       `[{"op":"remove","path":"/title"}]`,
+			expStatus: http.StatusBadRequest,
+			expBody:   "note must have a title",
+		},
+		{
+			name:      "change id",
+			req:       `[{"op":"replace","path":"/id","value":7}]`,
+			expStatus: http.StatusBadRequest,
+			expBody:   `invalid json patch: field "id" is read-only`,
+		},
+		{
+			name:      "unknown field",
+			req:       `[{"op":"add","path":"/priority","value":1}]`,
+			expStatus: http.StatusBadRequest,
+			expBody:   "invalid json patch",
+		},
+		{
+			name:      "wrong type",
+			req:       `[{"op":"replace","path":"/done","value":"yes"}]`,
+			expStatus: http.StatusBadRequest,
+			expBody:   "invalid json patch",
+		},
+		{
+			name:      "if-match mismatch",
+			req:       `[{"op":"replace","path":"/done","value":true}]`,
+			ifMatch:   `"2"`,
+			expStatus: http.StatusPreconditionFailed,
+			expBody:   "note version does not match",
+		},
+		{
+			name: "commit fails",
+			req:  `[{"op":"replace","path":"/done","value":true}]`,
+			mockTx: func(ctx context.Context, fn func(tx repository.NoteTx) error) error {
+				return errors.New("disk full")
+			},
+			expStatus: http.StatusInternalServerError,
+			expBody:   "internal server error",
+		},
+		{
+			name:      "invalid patch document",
+			req:       `[{"op":"inc","path":"/done"}]`,
+			expStatus: http.StatusBadRequest,
+			expBody:   `invalid json patch: operation 0: unknown op "inc"`,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			mockUpdate := testCase.mockUpdate
+			if mockUpdate == nil {
+				mockUpdate = func(ctx context.Context, id uint64, version uint64, dto repository.NoteDTO) (repository.Note, error) {
+					if version != stored.Version {
+						return repository.Note{}, repository.ErrVersionMismatch
+					}
+					return repository.Note{ID: id, Title: dto.Title, Description: dto.Description, Done: dto.Done, Version: version + 1}, nil
+				}
+			}
+			mockRepo := &MockRepository{
+				GetByIDFunc: func(ctx context.Context, id uint64) (repository.Note, error) {
+					return stored, nil
+				},
+				UpdateIfMatchFunc: mockUpdate,
+				WithTxFunc:        testCase.mockTx,
+			}
+			handler := NewHandler(mockRepo)
+
+			req := httptest.NewRequest("PATCH", "/todos/1", strings.NewReader(testCase.req))
+			req.Header.Set("Content-Type", "application/json-patch+json")
+			if testCase.ifMatch != "" {
+				req.Header.Set("If-Match", testCase.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.patchNoteByID(rec, req, 1)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if !strings.HasPrefix(body, testCase.expBody) {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
+
+func TestDeleteNoteByID(t *testing.T) {
+	testTable := []struct {
+		name              string
+		id                uint64
+		ifMatch           string
+		mockDelete        func(ctx context.Context, id uint64) error
+		mockDeleteIfMatch func(ctx context.Context, id uint64, version uint64) error
+		query             string
+		mockDeleteTree    func(ctx context.Context, id uint64, version uint64, mode repository.DeleteMode) error
+		expStatus         int
+	}{
+		{
+			name: "success",
+			id:   1,
+			mockDelete: func(ctx context.Context, id uint64) error {
+				return nil
+			},
+			expStatus: http.StatusNoContent,
+		},
+		{
+			name: "invalid id",
+			id:   12345,
+			mockDelete: func(ctx context.Context, id uint64) error {
+				return repository.ErrNotFoundID
+			},
+			expStatus: http.StatusNotFound,
+		},
+		{
+			name:    "if-match success",
+			id:      1,
+			ifMatch: `"5"`,
+			mockDeleteIfMatch: func(ctx context.Context, id uint64, version uint64) error {
+				if version != 5 {
+					return repository.ErrVersionMismatch
+				}
+				return nil
+			},
+			expStatus: http.StatusNoContent,
+		},
+		{
+			name:    "if-match mismatch",
+			id:      1,
+			ifMatch: `"4"`,
+			mockDeleteIfMatch: func(ctx context.Context, id uint64, version uint64) error {
+				return repository.ErrVersionMismatch
+			},
+			expStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name: "has children",
+			id:   1,
+			mockDelete: func(ctx context.Context, id uint64) error {
+				return repository.ErrHasChildren
+			},
+			expStatus: http.StatusConflict,
+		},
+		{
+			name:    "cascade",
+			id:      1,
+			ifMatch: `"2"`,
+			query:   "?children=cascade",
+			mockDeleteTree: func(ctx context.Context, id uint64, version uint64, mode repository.DeleteMode) error {
+				if version != 2 || mode != repository.DeleteCascade {
+					return errors.New("unexpected arguments")
+				}
+				return nil
+			},
+			expStatus: http.StatusNoContent,
+		},
+		{
+			name:  "orphan",
+			id:    1,
+			query: "?children=orphan",
+			mockDeleteTree: func(ctx context.Context, id uint64, version uint64, mode repository.DeleteMode) error {
+				if version != repository.AnyVersion || mode != repository.DeleteOrphan {
+					return errors.New("unexpected arguments")
+				}
+				return nil
+			},
+			expStatus: http.StatusNoContent,
+		},
+		{
+			name:      "unknown mode",
+			id:        1,
+			query:     "?children=keep",
+			expStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			mockRepo := &MockRepository{
+				DeleteFunc:             testCase.mockDelete,
+				DeleteIfMatchFunc:      testCase.mockDeleteIfMatch,
+				DeleteWithChildrenFunc: testCase.mockDeleteTree,
+			}
+			handler := NewHandler(mockRepo)
+
+			req := httptest.NewRequest("DELETE", "/todos/1"+testCase.query, nil)
+			if testCase.ifMatch != "" {
+				req.Header.Set("If-Match", testCase.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.deleteNoteByID(rec, req, testCase.id)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+		})
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	changedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	mockRepo := &MockRepository{
+		RevisionsFunc: func(ctx context.Context, id uint64) ([]repository.Revision, error) {
+			return []repository.Revision{{Rev: 1, ChangedAt: changedAt, Note: repository.Note{ID: id, Title: "v1", Version: 1}}}, nil
+		},
+		RevisionFunc: func(ctx context.Context, id uint64, rev uint64) (repository.Revision, error) {
+			if rev != 1 {
+				return repository.Revision{}, repository.ErrRevisionNotFound
+			}
+			return repository.Revision{Rev: 1, ChangedAt: changedAt, ChangedBy: "alice", Note: repository.Note{ID: id, Title: "v1", Version: 1}}, nil
+		},
+		RevertFunc: func(ctx context.Context, id uint64, version uint64, rev uint64) (repository.Note, error) {
+			if version != repository.AnyVersion && version != 3 {
+				return repository.Note{}, repository.ErrVersionMismatch
+			}
+			return repository.Note{ID: id, Title: "v1", Version: 4}, nil
+		},
+	}
+
+	testTable := []struct {
+		name      string
+		method    string
+		url       string
+		ifMatch   string
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:      "list",
+			method:    http.MethodGet,
+			url:       "/todos/1/revisions",
+			expStatus: http.StatusOK,
+			expBody:   `[{"rev":1,"changed_at":"2025-03-01T12:00:00Z","note":{"id":1,"title":"v1","description":"","done":false,"version":1}}]`,
+		},
+		{
+			name:      "get",
+			method:    http.MethodGet,
+			url:       "/todos/1/revisions/1",
+			expStatus: http.StatusOK,
+			expBody:   `{"rev":1,"changed_at":"2025-03-01T12:00:00Z","changed_by":"alice","note":{"id":1,"title":"v1","description":"","done":false,"version":1}}`,
+		},
+		{
+			name:      "get missing revision",
+			method:    http.MethodGet,
+			url:       "/todos/1/revisions/9",
+			expStatus: http.StatusNotFound,
+			expBody:   "revision not found",
+		},
+		{
+			name:      "invalid revision",
+			method:    http.MethodGet,
+			url:       "/todos/1/revisions/abc",
+			expStatus: http.StatusBadRequest,
+			expBody:   "Invalid revision in url",
+		},
+		{
+			name:      "revert",
+			method:    http.MethodPost,
+			url:       "/todos/1/revert?to=1",
+			ifMatch:   `"3"`,
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"title":"v1","description":"","done":false,"version":4}`,
+		},
+		{
+			name:      "revert stale",
+			method:    http.MethodPost,
+			url:       "/todos/1/revert?to=1",
+			ifMatch:   `"2"`,
+			expStatus: http.StatusPreconditionFailed,
+			expBody:   "note version does not match",
+		},
+		{
+			name:      "revert without target",
+			method:    http.MethodPost,
+			url:       "/todos/1/revert",
+			expStatus: http.StatusBadRequest,
+			expBody:   "to must be a revision number",
+		},
+		{
+			name:      "revert wrong method",
+			method:    http.MethodGet,
+			url:       "/todos/1/revert?to=1",
+			expStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:      "nested path under other subresource",
+			method:    http.MethodGet,
+			url:       "/todos/1/children/2",
+			expStatus: http.StatusNotFound,
+			expBody:   "404 page not found",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := NewHandler(mockRepo)
+
+			req := httptest.NewRequest(testCase.method, testCase.url, nil)
+			if testCase.ifMatch != "" {
+				req.Header.Set("If-Match", testCase.ifMatch)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.HandleToDoByID().ServeHTTP(rec, req)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
 		})
 	}
 }
@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+// DefaultIdempotencyTTL is how long a POST /todos response is kept for
+// retries with the same Idempotency-Key.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// maxIdempotencyKey is the longest Idempotency-Key accepted.
+const maxIdempotencyKey = 255
+
+// DefaultIdempotencyKeys is how many keys every tenant may have at once; the
+// oldest are forgotten first.
+const DefaultIdempotencyKeys = 10000
+
+// maxIdempotencyBody is the largest response body kept for a replay.
+const maxIdempotencyBody = 64 << 10
+
+var errInvalidIdempotencyKey error = errors.New("Idempotency-Key must be 1 to 255 characters")
+var errIdempotencyKeyReused error = errors.New("Idempotency-Key was already used with a different request")
+var errIdempotentResponseTooLarge error = errors.New("request with this Idempotency-Key was already processed, but its response was too large to keep")
+
+type Option func(h *Handler)
+
+// WithIdempotencyTTL sets how long the responses to requests with an
+// Idempotency-Key are kept. Zero or less turns the header off.
+func WithIdempotencyTTL(ttl time.Duration) Option {
+	return func(h *Handler) {
+		h.idempotency.ttl = ttl
+	}
+}
+
+// idempotencyStore remembers the responses to POST /todos by tenant and
+// Idempotency-Key. Every tenant keeps at most maxKeys of them; order lists
+// the keys of a tenant oldest first and may still hold removed entries.
+type idempotencyStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	maxKeys   int
+	maxBody   int
+	now       func() time.Time
+	entries   map[idempotencyKey]*idempotencyEntry
+	order     map[string][]queuedKey
+	counts    map[string]int
+	lastSweep time.Time
+}
+
+type queuedKey struct {
+	key idempotencyKey
+	e   *idempotencyEntry
+}
+
+type idempotencyKey struct {
+	tenant string
+	key    string
+}
+
+// idempotencyEntry is a request with a key. done is closed once the first
+// request is answered; res stays nil if the answer was not a success, and the
+// entry is then dropped so the request may be retried.
+type idempotencyEntry struct {
+	fingerprint [sha256.Size]byte
+	done        chan struct{}
+	res         *recordedResponse
+	expires     time.Time
+}
+
+// recordedResponse is a saved response. A body too large to keep is dropped
+// and its replays are refused.
+type recordedResponse struct {
+	status   int
+	header   http.Header
+	body     []byte
+	tooLarge bool
+}
+
+func newIdempotencyStore() *idempotencyStore {
+	return &idempotencyStore{
+		ttl:     DefaultIdempotencyTTL,
+		maxKeys: DefaultIdempotencyKeys,
+		maxBody: maxIdempotencyBody,
+		now:     time.Now,
+		entries: make(map[idempotencyKey]*idempotencyEntry),
+		order:   make(map[string][]queuedKey),
+		counts:  make(map[string]int),
+	}
+}
+
+// acquire returns the entry of key and whether the caller owns it and has to
+// run the request. Callers that do not own the entry wait for its done.
+func (s *idempotencyStore) acquire(key idempotencyKey, fingerprint [sha256.Size]byte) (*idempotencyEntry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if ok && e.res != nil && !now.Before(e.expires) {
+		s.remove(key, e)
+		ok = false
+	}
+	if ok {
+		if e.fingerprint != fingerprint {
+			return nil, false, errIdempotencyKeyReused
+		}
+		return e, false, nil
+	}
+
+	s.evict(key.tenant)
+	e = &idempotencyEntry{fingerprint: fingerprint, done: make(chan struct{})}
+	s.entries[key] = e
+	s.order[key.tenant] = append(s.order[key.tenant], queuedKey{key, e})
+	s.counts[key.tenant]++
+	return e, true, nil
+}
+
+// evict forgets the oldest keys of tenant until there is room for one more.
+// A request still running keeps working; it just cannot be replayed. Callers
+// must hold s.mu.
+func (s *idempotencyStore) evict(tenant string) {
+	queue := s.order[tenant]
+	for s.counts[tenant] >= s.maxKeys && len(queue) > 0 {
+		s.remove(queue[0].key, queue[0].e)
+		queue = queue[1:]
+	}
+	s.order[tenant] = queue
+}
+
+// remove drops e if it is still the entry of key. Callers must hold s.mu.
+func (s *idempotencyStore) remove(key idempotencyKey, e *idempotencyEntry) {
+	if s.entries[key] != e {
+		return
+	}
+	delete(s.entries, key)
+	s.counts[key.tenant]--
+	if s.counts[key.tenant] == 0 {
+		delete(s.counts, key.tenant)
+		delete(s.order, key.tenant)
+	}
+}
+
+// finish stores the response of the owner of e, or drops e if res is nil, and
+// wakes the requests waiting for it.
+func (s *idempotencyStore) finish(key idempotencyKey, e *idempotencyEntry, res *recordedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if res == nil {
+		s.remove(key, e)
+	} else {
+		e.res = res
+		e.expires = s.now().Add(s.ttl)
+	}
+	close(e.done)
+}
+
+// sweep drops the expired responses, at most once a minute. Callers must hold
+// s.mu.
+func (s *idempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < min(s.ttl, time.Minute) {
+		return
+	}
+	s.lastSweep = now
+	for key, e := range s.entries {
+		if e.res != nil && !now.Before(e.expires) {
+			s.remove(key, e)
+		}
+	}
+	for tenant, queue := range s.order {
+		s.order[tenant] = slices.DeleteFunc(queue, func(q queuedKey) bool {
+			return s.entries[q.key] != q.e
+		})
+	}
+}
+
+// responseRecorder passes a response through and keeps a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// idempotent runs create once for every tenant and Idempotency-Key. A retry
+// with the same body and query gets the saved response with
+// Idempotent-Replayed set; a retry sent while the first request still runs
+// waits for it. Only successful responses are saved, so a failed request may
+// be retried with the same key.
+func (h *Handler) idempotent(w http.ResponseWriter, r *http.Request, create http.HandlerFunc) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" || h.idempotency.ttl <= 0 {
+		create(w, r)
+		return
+	}
+	if len(key) > maxIdempotencyKey {
+		http.Error(w, errInvalidIdempotencyKey.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxNoteBody))
+	if bodyTooLarge(err) {
+		http.Error(w, errBodyTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, errInvalidJSON.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	sum := sha256.New()
+	io.WriteString(sum, r.URL.RawQuery+"\n")
+	sum.Write(body)
+	var fingerprint [sha256.Size]byte
+	sum.Sum(fingerprint[:0])
+
+	ik := idempotencyKey{tenant: repository.TenantFrom(r.Context()), key: key}
+	for {
+		e, owner, err := h.idempotency.acquire(ik, fingerprint)
+		if err != nil {
+			log.Printf("error: code %d: %s", http.StatusUnprocessableEntity, err)
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		if owner {
+			rec := &responseRecorder{ResponseWriter: w}
+			var res *recordedResponse
+			defer func() { h.idempotency.finish(ik, e, res) }()
+
+			create(rec, r)
+			if rec.status >= 200 && rec.status <= 299 {
+				res = &recordedResponse{status: rec.status, header: w.Header().Clone(), body: rec.body.Bytes()}
+				if len(res.body) > h.idempotency.maxBody {
+					res = &recordedResponse{tooLarge: true}
+				}
+			}
+			return
+		}
+
+		select {
+		case <-e.done:
+		case <-r.Context().Done():
+			handleError(w, r.Context().Err())
+			return
+		}
+		if e.res != nil && e.res.tooLarge {
+			http.Error(w, errIdempotentResponseTooLarge.Error(), http.StatusConflict)
+			return
+		}
+		if e.res != nil {
+			for name, values := range e.res.header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(e.res.status)
+			w.Write(e.res.body)
+			return
+		}
+	}
+}
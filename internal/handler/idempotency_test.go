@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	var created atomic.Uint64
+	var fail atomic.Bool
+	mockRepo := &MockRepository{CreateFunc: func(ctx context.Context, dto repository.NoteDTO) (repository.Note, error) {
+		if fail.Swap(false) {
+			return repository.Note{}, errors.New("disk is full")
+		}
+		return repository.Note{ID: created.Add(1), Title: dto.Title, Version: 1}, nil
+	}}
+	handler := NewHandler(mockRepo, WithIdempotencyTTL(time.Hour))
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	handler.idempotency.now = func() time.Time { return now }
+
+	testTable := []struct {
+		name      string
+		key       string
+		tenant    string
+		req       string
+		fail      bool
+		after     time.Duration
+		expStatus int
+		expBody   string
+		expReplay bool
+	}{
+		{
+			name:      "first request",
+			key:       "k1",
+			req:       `{"title": "t1"}`,
+			expStatus: http.StatusCreated,
+			expBody:   `{"id":1,"title":"t1","description":"","done":false,"version":1}`,
+		},
+		{
+			name:      "retry",
+			key:       "k1",
+			req:       `{"title": "t1"}`,
+			expStatus: http.StatusCreated,
+			expBody:   `{"id":1,"title":"t1","description":"","done":false,"version":1}`,
+			expReplay: true,
+		},
+		{
+			name:      "same key with other body",
+			key:       "k1",
+			req:       `{"title": "t2"}`,
+			expStatus: http.StatusUnprocessableEntity,
+			expBody:   "Idempotency-Key was already used with a different request",
+		},
+		{
+			name:      "same key in other tenant",
+			key:       "k1",
+			tenant:    "acme",
+			req:       `{"title": "t1"}`,
+			expStatus: http.StatusCreated,
+			expBody:   `{"id":2,"title":"t1","description":"","done":false,"version":1}`,
+		},
+		{
+			name:      "without key",
+			req:       `{"title": "t1"}`,
+			expStatus: http.StatusCreated,
+			expBody:   `{"id":3,"title":"t1","description":"","done":false,"version":1}`,
+		},
+		{
+			name:      "validation error is not kept",
+			key:       "k2",
+			req:       `{"title": ""}`,
+			expStatus: http.StatusBadRequest,
+			expBody:   "note must have a title",
+		},
+		{
+			name:      "fixed request with the same key",
+			key:       "k2",
+			req:       `{"title": "t4"}`,
+			expStatus: http.StatusCreated,
+			expBody:   `{"id":4,"title":"t4","description":"","done":false,"version":1}`,
+		},
+		{
+			name:      "failure is not kept",
+			key:       "k3",
+			req:       `{"title": "t5"}`,
+			fail:      true,
+			expStatus: http.StatusInternalServerError,
+			expBody:   "internal server error",
+		},
+		{
+			name:      "retry after failure",
+			key:       "k3",
+			req:       `{"title": "t5"}`,
+			expStatus: http.StatusCreated,
+			expBody:   `{"id":5,"title":"t5","description":"","done":false,"version":1}`,
+		},
+		{
+			name:      "retry after ttl",
+			key:       "k1",
+			req:       `{"title": "t2"}`,
+			after:     time.Hour,
+			expStatus: http.StatusCreated,
+			expBody:   `{"id":6,"title":"t2","description":"","done":false,"version":1}`,
+		},
+		{
+			name:      "key too long",
+			key:       strings.Repeat("k", 256),
+			req:       `{"title": "t1"}`,
+			expStatus: http.StatusBadRequest,
+			expBody:   "Idempotency-Key must be 1 to 255 characters",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			now = now.Add(testCase.after)
+			fail.Store(testCase.fail)
+
+			req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(testCase.req))
+			req.Header.Set("Content-Type", "application/json")
+			if testCase.key != "" {
+				req.Header.Set("Idempotency-Key", testCase.key)
+			}
+			if testCase.tenant != "" {
+				req = req.WithContext(repository.WithTenant(req.Context(), testCase.tenant))
+			}
+			rec := httptest.NewRecorder()
+
+			handler.HandleToDo().ServeHTTP(rec, req)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+
+			if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != testCase.expReplay {
+				t.Errorf("Idempotent-Replayed: expected %v, got %v", testCase.expReplay, replayed)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeyConcurrent(t *testing.T) {
+	var created atomic.Uint64
+	release := make(chan struct{})
+	mockRepo := &MockRepository{CreateFunc: func(ctx context.Context, dto repository.NoteDTO) (repository.Note, error) {
+		<-release
+		return repository.Note{ID: created.Add(1), Title: dto.Title, Version: 1}, nil
+	}}
+	handler := NewHandler(mockRepo)
+
+	const n = 10
+	var wg sync.WaitGroup
+	recs := make([]*httptest.ResponseRecorder, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(`{"title": "t1"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Idempotency-Key", "k1")
+			recs[i] = httptest.NewRecorder()
+			handler.HandleToDo().ServeHTTP(recs[i], req)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := created.Load(); n != 1 {
+		t.Errorf("create: expected 1 call, got %d", n)
+	}
+	for _, rec := range recs {
+		if rec.Code != http.StatusCreated || strings.TrimSpace(rec.Body.String()) != `{"id":1,"title":"t1","description":"","done":false,"version":1}` {
+			t.Errorf("response: expected the first note, got %v %v", rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestIdempotencyKeyLimits(t *testing.T) {
+	var created atomic.Uint64
+	mockRepo := &MockRepository{CreateFunc: func(ctx context.Context, dto repository.NoteDTO) (repository.Note, error) {
+		return repository.Note{ID: created.Add(1), Title: dto.Title, Description: dto.Description, Version: 1}, nil
+	}}
+	handler := NewHandler(mockRepo)
+	handler.idempotency.maxKeys = 3
+	handler.idempotency.maxBody = 200
+
+	post := func(key string, tenant string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/todos", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		req = req.WithContext(repository.WithTenant(req.Context(), tenant))
+		rec := httptest.NewRecorder()
+		handler.HandleToDo().ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		post(key, "acme", `{"title": "t"}`)
+	}
+	post("k1", "other", `{"title": "t"}`)
+
+	if n := len(handler.idempotency.entries); n != 4 {
+		t.Errorf("entries: expected 3 of acme and 1 of other, got %d", n)
+	}
+	if rec := post("k5", "acme", `{"title": "t"}`); rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("newest key: expected a replay")
+	}
+	if rec := post("k1", "acme", `{"title": "t"}`); rec.Header().Get("Idempotent-Replayed") == "true" {
+		t.Errorf("oldest key: expected it to be evicted")
+	}
+	if rec := post("k1", "other", `{"title": "t"}`); rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("other tenant: expected its key to be kept")
+	}
+
+	large := `{"title": "t", "description": "` + strings.Repeat("d", 300) + `"}`
+	if rec := post("big", "acme", large); rec.Code != http.StatusCreated {
+		t.Errorf("large response: expected %v, got %v", http.StatusCreated, rec.Code)
+	}
+	before := created.Load()
+	if rec := post("big", "acme", large); rec.Code != http.StatusConflict {
+		t.Errorf("large response replay: expected %v, got %v", http.StatusConflict, rec.Code)
+	}
+	if created.Load() != before {
+		t.Errorf("large response replay: expected no new note")
+	}
+
+	huge := `{"title": "t", "description": "` + strings.Repeat("d", maxNoteBody) + `"}`
+	for _, key := range []string{"huge", ""} {
+		if rec := post(key, "acme", huge); rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("body over the limit with key %q: expected %v, got %v", key, http.StatusRequestEntityTooLarge, rec.Code)
+		}
+	}
+	if created.Load() != before {
+		t.Errorf("body over the limit: expected no new note")
+	}
+}
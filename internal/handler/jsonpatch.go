@@ -0,0 +1,332 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+var errInvalidPatch error = errors.New("invalid json patch")
+var errPatchTestFailed error = errors.New("json patch test failed")
+
+// readOnlyFields are the members of a Note that a patch may test but not change.
+var readOnlyFields = []string{"id", "version", "created_at", "updated_at", "completed_at", "overdue", "progress", "blocked", "occurrence", "next_id", "deleted_at"}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+func decodeJSONPatch(r io.Reader) ([]patchOperation, error) {
+	var ops []patchOperation
+	if err := json.NewDecoder(r).Decode(&ops); err != nil {
+		return nil, errInvalidJSON
+	}
+
+	for i, op := range ops {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("%w: operation %d: missing value", errInvalidPatch, i)
+			}
+		case "move", "copy":
+			if _, err := parsePointer(op.From); err != nil {
+				return nil, fmt.Errorf("%w: operation %d: %v", errInvalidPatch, i, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("%w: operation %d: unknown op %q", errInvalidPatch, i, op.Op)
+		}
+
+		if _, err := parsePointer(op.Path); err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %v", errInvalidPatch, i, err)
+		}
+	}
+
+	return ops, nil
+}
+
+// applyJSONPatchToNote applies ops to the JSON form of note and returns the
+// result as a full replacement for the note.
+func applyJSONPatchToNote(note repository.Note, ops []patchOperation) (repository.NoteDTO, error) {
+	var dto repository.NoteDTO
+
+	raw, err := json.Marshal(note)
+	if err != nil {
+		return dto, err
+	}
+	var original, doc map[string]any
+	json.Unmarshal(raw, &original)
+	json.Unmarshal(raw, &doc)
+
+	patched, err := applyJSONPatch(doc, ops)
+	if err != nil {
+		return dto, err
+	}
+
+	result, ok := patched.(map[string]any)
+	if !ok {
+		return dto, fmt.Errorf("%w: note must stay an object", errInvalidPatch)
+	}
+	for _, field := range readOnlyFields {
+		if !reflect.DeepEqual(result[field], original[field]) {
+			return dto, fmt.Errorf("%w: field %q is read-only", errInvalidPatch, field)
+		}
+		delete(result, field)
+	}
+
+	raw, err = json.Marshal(result)
+	if err != nil {
+		return dto, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&dto); err != nil {
+		if errors.Is(decodeError(err), errInvalidDueAt) {
+			return dto, fmt.Errorf("%w: %v", errInvalidPatch, errInvalidDueAt)
+		}
+		return dto, fmt.Errorf("%w: %v", errInvalidPatch, err)
+	}
+
+	return dto, nil
+}
+
+// applyJSONPatch applies ops to a document decoded with encoding/json. The
+// document is modified in place, so callers pass a fresh copy.
+func applyJSONPatch(doc any, ops []patchOperation) (any, error) {
+	for i, op := range ops {
+		path, _ := parsePointer(op.Path)
+
+		var err error
+		switch op.Op {
+		case "add":
+			var value any
+			if err = json.Unmarshal(op.Value, &value); err == nil {
+				doc, err = pointerAdd(doc, path, value)
+			}
+		case "remove":
+			doc, _, err = pointerRemove(doc, path)
+		case "replace":
+			var value any
+			if err = json.Unmarshal(op.Value, &value); err == nil {
+				if doc, _, err = pointerRemove(doc, path); err == nil {
+					doc, err = pointerAdd(doc, path, value)
+				}
+			}
+		case "move":
+			from, _ := parsePointer(op.From)
+			if isProperPrefix(from, path) {
+				err = errors.New("cannot move a value into itself")
+				break
+			}
+			var value any
+			if doc, value, err = pointerRemove(doc, from); err == nil {
+				doc, err = pointerAdd(doc, path, value)
+			}
+		case "copy":
+			from, _ := parsePointer(op.From)
+			var value any
+			if value, err = pointerGet(doc, from); err == nil {
+				doc, err = pointerAdd(doc, path, deepCopy(value))
+			}
+		case "test":
+			var expected any
+			if err = json.Unmarshal(op.Value, &expected); err == nil {
+				actual, getErr := pointerGet(doc, path)
+				if getErr != nil || !reflect.DeepEqual(actual, expected) {
+					return nil, fmt.Errorf("%w: operation %d: value at %q differs", errPatchTestFailed, i, op.Path)
+				}
+			}
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %v", errInvalidPatch, i, err)
+		}
+	}
+
+	return doc, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path %q must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func isProperPrefix(prefix, path []string) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	limit := length - 1
+	if allowEnd {
+		limit = length
+	}
+	if i > limit {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func pointerGet(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("cannot descend into %q", token)
+		}
+	}
+	return doc, nil
+}
+
+func pointerAdd(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = value
+		return doc, nil
+	case []any:
+		i, err := arrayIndex(last, len(node), true)
+		if err != nil {
+			return nil, err
+		}
+		node = append(node[:i], append([]any{value}, node[i:]...)...)
+		return pointerReplaceContainer(doc, path[:len(path)-1], node)
+	default:
+		return nil, fmt.Errorf("cannot add to %q", last)
+	}
+}
+
+func pointerRemove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		value, ok := node[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q not found", last)
+		}
+		delete(node, last)
+		return doc, value, nil
+	case []any:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		value := node[i]
+		node = append(node[:i:i], node[i+1:]...)
+		doc, err = pointerReplaceContainer(doc, path[:len(path)-1], node)
+		return doc, value, err
+	default:
+		return nil, nil, fmt.Errorf("cannot remove from %q", last)
+	}
+}
+
+// pointerReplaceContainer stores a resized array back into its parent, since
+// appending to a slice may reallocate it.
+func pointerReplaceContainer(doc any, path []string, container []any) (any, error) {
+	if len(path) == 0 {
+		return container, nil
+	}
+
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]any:
+		node[last] = container
+	case []any:
+		i, err := arrayIndex(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = container
+	}
+	return doc, nil
+}
+
+func deepCopy(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for key, item := range v {
+			res[key] = deepCopy(item)
+		}
+		return res
+	case []any:
+		res := make([]any, len(v))
+		for i, item := range v {
+			res[i] = deepCopy(item)
+		}
+		return res
+	default:
+		return v
+	}
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	testTable := []struct {
+		name   string
+		doc    string
+		patch  string
+		expDoc string
+		expErr error
+	}{
+		{
+			name:   "add member",
+			doc:    `{"foo":"bar"}`,
+			patch:  `[{"op":"add","path":"/baz","value":"qux"}]`,
+			expDoc: `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			name:   "add array element",
+			doc:    `{"foo":["bar","baz"]}`,
+			patch:  `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			expDoc: `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:   "append array element",
+			doc:    `{"foo":["bar"]}`,
+			patch:  `[{"op":"add","path":"/foo/-","value":"qux"}]`,
+			expDoc: `{"foo":["bar","qux"]}`,
+		},
+		{
+			name:   "remove array element",
+			doc:    `{"foo":["bar","qux","baz"]}`,
+			patch:  `[{"op":"remove","path":"/foo/1"}]`,
+			expDoc: `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:   "replace",
+			doc:    `{"baz":"qux","foo":"bar"}`,
+			patch:  `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			expDoc: `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			name:   "move",
+			doc:    `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch:  `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			expDoc: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:   "copy",
+			doc:    `{"a":{"b":1}}`,
+			patch:  `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`,
+			expDoc: `{"a":{"b":1},"c":{"b":2}}`,
+		},
+		{
+			name:   "escaped pointer",
+			doc:    `{"a/b":1,"m~n":2}`,
+			patch:  `[{"op":"test","path":"/a~1b","value":1},{"op":"remove","path":"/m~0n"}]`,
+			expDoc: `{"a/b":1}`,
+		},
+		{
+			name:   "test success",
+			doc:    `{"baz":"qux","foo":["a",2,"c"]}`,
+			patch:  `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			expDoc: `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			name:   "test failure",
+			doc:    `{"baz":"qux"}`,
+			patch:  `[{"op":"test","path":"/baz","value":"bar"}]`,
+			expErr: errPatchTestFailed,
+		},
+		{
+			name:   "remove missing member",
+			doc:    `{"foo":"bar"}`,
+			patch:  `[{"op":"remove","path":"/baz"}]`,
+			expErr: errInvalidPatch,
+		},
+		{
+			name:   "add to missing parent",
+			doc:    `{"foo":"bar"}`,
+			patch:  `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			expErr: errInvalidPatch,
+		},
+		{
+			name:   "move into own child",
+			doc:    `{"a":{"b":{}}}`,
+			patch:  `[{"op":"move","from":"/a","path":"/a/b/c"}]`,
+			expErr: errInvalidPatch,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			var doc any
+			if err := json.Unmarshal([]byte(testCase.doc), &doc); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			ops, err := decodeJSONPatch(strings.NewReader(testCase.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			res, err := applyJSONPatch(doc, ops)
+
+			if !errors.Is(err, testCase.expErr) {
+				t.Fatalf("expected error %v, got %v", testCase.expErr, err)
+			}
+
+			if testCase.expErr != nil {
+				return
+			}
+
+			got, _ := json.Marshal(res)
+			if string(got) != testCase.expDoc {
+				t.Errorf("document: expected %s, got %s", testCase.expDoc, got)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONPatch(t *testing.T) {
+	testTable := []struct {
+		name   string
+		patch  string
+		expErr error
+	}{
+		{
+			name:  "valid",
+			patch: `[{"op":"replace","path":"/title","value":"x"},{"op":"remove","path":"/description"}]`,
+		},
+		{
+			name:   "not an array",
+			patch:  `{"op":"remove","path":"/title"}`,
+			expErr: errInvalidJSON,
+		},
+		{
+			name:   "unknown op",
+			patch:  `[{"op":"increment","path":"/title"}]`,
+			expErr: errInvalidPatch,
+		},
+		{
+			name:   "missing value",
+			patch:  `[{"op":"add","path":"/title"}]`,
+			expErr: errInvalidPatch,
+		},
+		{
+			name:   "relative path",
+			patch:  `[{"op":"remove","path":"title"}]`,
+			expErr: errInvalidPatch,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, err := decodeJSONPatch(strings.NewReader(testCase.patch))
+
+			if !errors.Is(err, testCase.expErr) {
+				t.Fatalf("expected error %v, got %v", testCase.expErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+// ListHandler serves /lists and the notes nested under each list. Notes are
+// created and listed through the note handler.
+type ListHandler struct {
+	repo  repository.ListRepository
+	notes *Handler
+}
+
+func NewListHandler(repo repository.ListRepository, notes *Handler) *ListHandler {
+	return &ListHandler{
+		repo:  repo,
+		notes: notes,
+	}
+}
+
+func (h *ListHandler) HandleLists() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				h.postList(w, r)
+			case http.MethodGet:
+				h.getLists(w, r)
+			default:
+				w.Header().Set("Allow", "GET, POST")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		},
+	)
+}
+
+// HandleListByID serves /lists/{id}, /lists/{id}/todos and
+// /lists/{id}/todos/{noteID}.
+func (h *ListHandler) HandleListByID() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/lists/"), "/")
+			id, err := strconv.ParseUint(parts[0], 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid id in url", http.StatusBadRequest)
+				return
+			}
+
+			switch {
+			case len(parts) == 1:
+				switch r.Method {
+				case http.MethodGet:
+					h.getListByID(w, r, id)
+				case http.MethodPut:
+					h.putListByID(w, r, id)
+				case http.MethodDelete:
+					h.deleteListByID(w, r, id)
+				default:
+					w.Header().Set("Allow", "GET, PUT, DELETE")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+				}
+			case len(parts) == 2 && parts[1] == "todos":
+				switch r.Method {
+				case http.MethodGet:
+					h.getListNotes(w, r, id)
+				case http.MethodPost:
+					h.postListNote(w, r, id)
+				default:
+					w.Header().Set("Allow", "GET, POST")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+				}
+			case len(parts) == 3 && parts[1] == "todos":
+				noteID, err := strconv.ParseUint(parts[2], 10, 64)
+				if err != nil {
+					http.Error(w, "Invalid id in url", http.StatusBadRequest)
+					return
+				}
+				if r.Method != http.MethodPut {
+					w.Header().Set("Allow", "PUT")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				h.moveNote(w, r, id, noteID)
+			default:
+				http.NotFound(w, r)
+			}
+		},
+	)
+}
+
+func (h *ListHandler) postList(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !(r.Header.Get("Content-Type") == "application/json") {
+		http.Error(w, "invalid media-type, must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var dto repository.ListDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.repo.CreateList(ctx, dto)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *ListHandler) getLists(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	lists, err := h.repo.GetLists(ctx)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lists)
+}
+
+func (h *ListHandler) getListByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+
+	list, err := h.repo.GetList(ctx, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *ListHandler) putListByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+	if !(r.Header.Get("Content-Type") == "application/json") {
+		http.Error(w, "invalid media-type, must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var dto repository.ListDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	list, err := h.repo.UpdateList(ctx, id, dto)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (h *ListHandler) deleteListByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+
+	var how repository.ListDelete
+	if s := r.URL.Query().Get("cascade"); s != "" {
+		cascade, err := strconv.ParseBool(s)
+		if err != nil {
+			http.Error(w, "cascade must be a boolean", http.StatusBadRequest)
+			return
+		}
+		how.Cascade = cascade
+	}
+	if s := r.URL.Query().Get("move_to"); s != "" {
+		moveTo, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || moveTo == 0 {
+			http.Error(w, "move_to must be a list id", http.StatusBadRequest)
+			return
+		}
+		how.MoveTo = moveTo
+	}
+
+	if err := h.repo.DeleteList(ctx, id, how); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ListHandler) getListNotes(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+
+	if _, err := h.repo.GetList(ctx, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	q, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+	q.Filters = append(q.Filters, repository.Filter{Field: "list_id", Op: repository.OpEq, Value: id})
+
+	page, err := h.notes.repo.List(ctx, q)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	if page.NextCursor != "" {
+		setNextPage(w, r, page.NextCursor)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page.Notes)
+}
+
+func (h *ListHandler) postListNote(w http.ResponseWriter, r *http.Request, id uint64) {
+	h.notes.createNote(w, r, &id)
+}
+
+func (h *ListHandler) moveNote(w http.ResponseWriter, r *http.Request, listID uint64, noteID uint64) {
+	ctx := r.Context()
+
+	note, err := h.repo.MoveNote(ctx, noteID, listID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	setETag(w, note)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
@@ -0,0 +1,304 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+type MockListRepository struct {
+	CreateListFunc func(ctx context.Context, dto repository.ListDTO) (repository.List, error)
+	GetListFunc    func(ctx context.Context, id uint64) (repository.List, error)
+	GetListsFunc   func(ctx context.Context) ([]repository.List, error)
+	UpdateListFunc func(ctx context.Context, id uint64, dto repository.ListDTO) (repository.List, error)
+	DeleteListFunc func(ctx context.Context, id uint64, how repository.ListDelete) error
+	MoveNoteFunc   func(ctx context.Context, noteID uint64, listID uint64) (repository.Note, error)
+}
+
+func (m *MockListRepository) CreateList(ctx context.Context, dto repository.ListDTO) (repository.List, error) {
+	if m.CreateListFunc != nil {
+		return m.CreateListFunc(ctx, dto)
+	}
+	return repository.List{}, nil
+}
+
+func (m *MockListRepository) GetList(ctx context.Context, id uint64) (repository.List, error) {
+	if m.GetListFunc != nil {
+		return m.GetListFunc(ctx, id)
+	}
+	return repository.List{}, nil
+}
+
+func (m *MockListRepository) GetLists(ctx context.Context) ([]repository.List, error) {
+	if m.GetListsFunc != nil {
+		return m.GetListsFunc(ctx)
+	}
+	return []repository.List{}, nil
+}
+
+func (m *MockListRepository) UpdateList(ctx context.Context, id uint64, dto repository.ListDTO) (repository.List, error) {
+	if m.UpdateListFunc != nil {
+		return m.UpdateListFunc(ctx, id, dto)
+	}
+	return repository.List{}, nil
+}
+
+func (m *MockListRepository) DeleteList(ctx context.Context, id uint64, how repository.ListDelete) error {
+	if m.DeleteListFunc != nil {
+		return m.DeleteListFunc(ctx, id, how)
+	}
+	return nil
+}
+
+func (m *MockListRepository) MoveNote(ctx context.Context, noteID uint64, listID uint64) (repository.Note, error) {
+	if m.MoveNoteFunc != nil {
+		return m.MoveNoteFunc(ctx, noteID, listID)
+	}
+	return repository.Note{}, nil
+}
+
+func TestHandleLists(t *testing.T) {
+	testTable := []struct {
+		name      string
+		method    string
+		req       string
+		mockRepo  *MockListRepository
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:   "create",
+			method: http.MethodPost,
+			req:    `{"name": "work", "description": "job"}`,
+			mockRepo: &MockListRepository{CreateListFunc: func(ctx context.Context, dto repository.ListDTO) (repository.List, error) {
+				return repository.List{ID: 1, Name: dto.Name, Description: dto.Description}, nil
+			}},
+			expStatus: http.StatusCreated,
+			expBody:   `{"id":1,"name":"work","description":"job","notes":0}`,
+		},
+		{
+			name:   "create without name",
+			method: http.MethodPost,
+			req:    `{"name": ""}`,
+			mockRepo: &MockListRepository{CreateListFunc: func(ctx context.Context, dto repository.ListDTO) (repository.List, error) {
+				return repository.List{}, repository.ErrListNameRequired
+			}},
+			expStatus: http.StatusBadRequest,
+			expBody:   "bad request: list must have a name",
+		},
+		{
+			name:   "get all",
+			method: http.MethodGet,
+			mockRepo: &MockListRepository{GetListsFunc: func(ctx context.Context) ([]repository.List, error) {
+				return []repository.List{{ID: 1, Name: "work", Notes: 2}}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `[{"id":1,"name":"work","description":"","notes":2}]`,
+		},
+		{
+			name:      "wrong method",
+			method:    http.MethodDelete,
+			mockRepo:  &MockListRepository{},
+			expStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := NewListHandler(testCase.mockRepo, NewHandler(&MockRepository{}))
+
+			req := httptest.NewRequest(testCase.method, "/lists", strings.NewReader(testCase.req))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.HandleLists().ServeHTTP(rec, req)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
+
+func TestHandleListByID(t *testing.T) {
+	testTable := []struct {
+		name      string
+		method    string
+		url       string
+		req       string
+		mockRepo  *MockListRepository
+		mockNotes *MockRepository
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:   "get missing",
+			method: http.MethodGet,
+			url:    "/lists/7",
+			mockRepo: &MockListRepository{GetListFunc: func(ctx context.Context, id uint64) (repository.List, error) {
+				return repository.List{}, repository.ErrListNotFound
+			}},
+			expStatus: http.StatusNotFound,
+			expBody:   "list not found",
+		},
+		{
+			name:   "update",
+			method: http.MethodPut,
+			url:    "/lists/1",
+			req:    `{"name": "home"}`,
+			mockRepo: &MockListRepository{UpdateListFunc: func(ctx context.Context, id uint64, dto repository.ListDTO) (repository.List, error) {
+				return repository.List{ID: id, Name: dto.Name}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"name":"home","description":"","notes":0}`,
+		},
+		{
+			name:   "delete not empty",
+			method: http.MethodDelete,
+			url:    "/lists/1",
+			mockRepo: &MockListRepository{DeleteListFunc: func(ctx context.Context, id uint64, how repository.ListDelete) error {
+				if how != (repository.ListDelete{}) {
+					t.Errorf("delete: unexpected mode %+v", how)
+				}
+				return repository.ErrListNotEmpty
+			}},
+			expStatus: http.StatusConflict,
+			expBody:   "list has notes, delete them with cascade or move them with move_to",
+		},
+		{
+			name:   "delete with cascade",
+			method: http.MethodDelete,
+			url:    "/lists/1?cascade=true",
+			mockRepo: &MockListRepository{DeleteListFunc: func(ctx context.Context, id uint64, how repository.ListDelete) error {
+				if !how.Cascade {
+					t.Errorf("delete: expected cascade")
+				}
+				return nil
+			}},
+			expStatus: http.StatusNoContent,
+		},
+		{
+			name:   "delete moving notes",
+			method: http.MethodDelete,
+			url:    "/lists/1?move_to=2",
+			mockRepo: &MockListRepository{DeleteListFunc: func(ctx context.Context, id uint64, how repository.ListDelete) error {
+				if how.MoveTo != 2 {
+					t.Errorf("delete: expected move to 2, got %d", how.MoveTo)
+				}
+				return nil
+			}},
+			expStatus: http.StatusNoContent,
+		},
+		{
+			name:      "delete with invalid move_to",
+			method:    http.MethodDelete,
+			url:       "/lists/1?move_to=abc",
+			mockRepo:  &MockListRepository{},
+			expStatus: http.StatusBadRequest,
+			expBody:   "move_to must be a list id",
+		},
+		{
+			name:     "list notes",
+			method:   http.MethodGet,
+			url:      "/lists/1/todos?sort=-id",
+			mockRepo: &MockListRepository{},
+			mockNotes: &MockRepository{ListFunc: func(ctx context.Context, q repository.ListQuery) (repository.NotePage, error) {
+				if len(q.Filters) != 1 || q.Filters[0] != (repository.Filter{Field: "list_id", Op: repository.OpEq, Value: uint64(1)}) {
+					t.Errorf("filters: unexpected %+v", q.Filters)
+				}
+				return repository.NotePage{Notes: []repository.Note{{ID: 2, Title: "t2", Version: 1}}}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `[{"id":2,"title":"t2","description":"","done":false,"version":1}]`,
+		},
+		{
+			name:   "list notes of missing list",
+			method: http.MethodGet,
+			url:    "/lists/7/todos",
+			mockRepo: &MockListRepository{GetListFunc: func(ctx context.Context, id uint64) (repository.List, error) {
+				return repository.List{}, repository.ErrListNotFound
+			}},
+			expStatus: http.StatusNotFound,
+			expBody:   "list not found",
+		},
+		{
+			name:     "create note in list",
+			method:   http.MethodPost,
+			url:      "/lists/3/todos",
+			req:      `{"title": "t1", "list_id": 5}`,
+			mockRepo: &MockListRepository{},
+			mockNotes: &MockRepository{CreateFunc: func(ctx context.Context, dto repository.NoteDTO) (repository.Note, error) {
+				return repository.Note{ID: 1, Title: dto.Title, Version: 1, ListID: dto.ListID}, nil
+			}},
+			expStatus: http.StatusCreated,
+			expBody:   `{"id":1,"title":"t1","description":"","done":false,"version":1,"list_id":3}`,
+		},
+		{
+			name:   "move note",
+			method: http.MethodPut,
+			url:    "/lists/2/todos/5",
+			mockRepo: &MockListRepository{MoveNoteFunc: func(ctx context.Context, noteID uint64, listID uint64) (repository.Note, error) {
+				return repository.Note{ID: noteID, Title: "t5", Version: 2, ListID: &listID}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `{"id":5,"title":"t5","description":"","done":false,"version":2,"list_id":2}`,
+		},
+		{
+			name:      "move note wrong method",
+			method:    http.MethodDelete,
+			url:       "/lists/2/todos/5",
+			mockRepo:  &MockListRepository{},
+			expStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:      "unknown sub-path",
+			method:    http.MethodGet,
+			url:       "/lists/1/tags",
+			mockRepo:  &MockListRepository{},
+			expStatus: http.StatusNotFound,
+			expBody:   "404 page not found",
+		},
+		{
+			name:      "invalid id",
+			method:    http.MethodGet,
+			url:       "/lists/abc",
+			mockRepo:  &MockListRepository{},
+			expStatus: http.StatusBadRequest,
+			expBody:   "Invalid id in url",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			notes := testCase.mockNotes
+			if notes == nil {
+				notes = &MockRepository{}
+			}
+			handler := NewListHandler(testCase.mockRepo, NewHandler(notes))
+
+			req := httptest.NewRequest(testCase.method, testCase.url, strings.NewReader(testCase.req))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.HandleListByID().ServeHTTP(rec, req)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
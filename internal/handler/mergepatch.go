@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+var errTitleRemoved error = errors.New("note must have a title")
+
+// decodeMergePatch turns an RFC 7396 document into a NotePatch. A null member
+// resets the field to its zero value; the title cannot be reset.
+func decodeMergePatch(r io.Reader) (repository.NotePatch, error) {
+	var patch repository.NotePatch
+
+	var doc map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return patch, errInvalidJSON
+	}
+
+	for field, raw := range doc {
+		isNull := string(raw) == "null"
+
+		switch field {
+		case "title":
+			if isNull {
+				return patch, errTitleRemoved
+			}
+			patch.Title = new(string)
+			if err := json.Unmarshal(raw, patch.Title); err != nil {
+				return patch, errInvalidJSON
+			}
+		case "description":
+			patch.Description = new(string)
+			if isNull {
+				continue
+			}
+			if err := json.Unmarshal(raw, patch.Description); err != nil {
+				return patch, errInvalidJSON
+			}
+		case "done":
+			patch.Done = new(bool)
+			if isNull {
+				continue
+			}
+			if err := json.Unmarshal(raw, patch.Done); err != nil {
+				return patch, errInvalidJSON
+			}
+		case "due_at":
+			patch.DueAt = new(*time.Time)
+			if isNull {
+				continue
+			}
+			*patch.DueAt = new(time.Time)
+			if err := json.Unmarshal(raw, *patch.DueAt); err != nil {
+				return patch, decodeError(err)
+			}
+		case "tags":
+			patch.Tags = new([]string)
+			if isNull {
+				continue
+			}
+			if err := json.Unmarshal(raw, patch.Tags); err != nil {
+				return patch, errInvalidJSON
+			}
+		case "parent_id":
+			patch.ParentID = new(*uint64)
+			if isNull {
+				continue
+			}
+			*patch.ParentID = new(uint64)
+			if err := json.Unmarshal(raw, *patch.ParentID); err != nil {
+				return patch, errInvalidJSON
+			}
+		case "blocked_by":
+			patch.BlockedBy = new([]uint64)
+			if isNull {
+				continue
+			}
+			if err := json.Unmarshal(raw, patch.BlockedBy); err != nil {
+				return patch, errInvalidJSON
+			}
+		case "list_id":
+			patch.ListID = new(*uint64)
+			if isNull {
+				continue
+			}
+			*patch.ListID = new(uint64)
+			if err := json.Unmarshal(raw, *patch.ListID); err != nil {
+				return patch, errInvalidJSON
+			}
+		case "recurrence":
+			patch.Recurrence = new(string)
+			if isNull {
+				continue
+			}
+			if err := json.Unmarshal(raw, patch.Recurrence); err != nil {
+				return patch, errInvalidJSON
+			}
+		default:
+			return patch, fmt.Errorf("field %q cannot be patched", field)
+		}
+	}
+
+	return patch, nil
+}
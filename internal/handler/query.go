@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+const (
+	defaultPageLimit   = 100
+	defaultSearchLimit = 20
+	maxPageLimit       = 1000
+)
+
+// queryErrors collects every problem found in a list query so the client can
+// fix them all at once.
+type queryErrors []*repository.QueryError
+
+func (e queryErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, qe := range e {
+		msgs[i] = qe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// parseListQuery reads limit, cursor, sort, tag and filters. Every other
+// parameter is a filter written as field=value or field[op]=value.
+func parseListQuery(values url.Values) (repository.ListQuery, error) {
+	q := repository.ListQuery{
+		Limit:  defaultPageLimit,
+		Cursor: values.Get("cursor"),
+	}
+	var errs queryErrors
+
+	params := make([]string, 0, len(values))
+	for param := range values {
+		params = append(params, param)
+	}
+	slices.Sort(params)
+
+	for _, param := range params {
+		switch param {
+		case "cursor":
+		case "limit":
+			limit, err := strconv.Atoi(values.Get(param))
+			if err != nil || limit < 1 || limit > maxPageLimit {
+				errs = append(errs, &repository.QueryError{
+					Param:   param,
+					Message: fmt.Sprintf("must be an integer from 1 to %d", maxPageLimit),
+				})
+				continue
+			}
+			q.Limit = limit
+		case "tag":
+			for _, raw := range values[param] {
+				group, err := repository.ParseTagFilter(param, raw)
+				if err != nil {
+					errs = append(errs, err.(*repository.QueryError))
+					break
+				}
+				q.Tags = append(q.Tags, group)
+			}
+		case "sort":
+			for _, spec := range values[param] {
+				keys, err := repository.ParseSort(param, spec)
+				if err != nil {
+					errs = append(errs, err.(*repository.QueryError))
+					continue
+				}
+				q.Sort = append(q.Sort, keys...)
+			}
+		default:
+			field, op := param, repository.OpEq
+			if name, rest, ok := strings.Cut(param, "["); ok && strings.HasSuffix(rest, "]") {
+				field, op = name, repository.FilterOp(strings.TrimSuffix(rest, "]"))
+			}
+
+			for _, raw := range values[param] {
+				f, err := repository.ParseFilter(param, field, op, raw)
+				if err != nil {
+					errs = append(errs, err.(*repository.QueryError))
+					break
+				}
+				q.Filters = append(q.Filters, f)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return q, errs
+	}
+	return q, nil
+}
+
+func writeQueryErrors(w http.ResponseWriter, errs queryErrors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(struct {
+		Error   string                   `json:"error"`
+		Details []*repository.QueryError `json:"details"`
+	}{
+		Error:   repository.ErrInvalidQuery.Error(),
+		Details: errs,
+	})
+}
+
+// setNextPage advertises the next page both as a bare cursor and as an
+// RFC 8288 Link that repeats the current query with the new cursor.
+func setNextPage(w http.ResponseWriter, r *http.Request, cursor string) {
+	values := r.URL.Query()
+	values.Set("cursor", cursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: values.Encode()}
+
+	w.Header().Set("X-Next-Cursor", cursor)
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+}
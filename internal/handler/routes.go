@@ -22,25 +22,133 @@ func (h *Handler) HandleToDo() http.Handler {
 	)
 }
 
+func (h *Handler) HandleSearch() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			h.searchNotes(w, r)
+		},
+	)
+}
+
+func (h *Handler) HandleAgenda() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			h.getAgenda(w, r)
+		},
+	)
+}
+
+func (h *Handler) HandleExecutionOrder() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			h.getExecutionOrder(w, r)
+		},
+	)
+}
+
+func (h *Handler) HandleUnblocked() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			h.getUnblocked(w, r)
+		},
+	)
+}
+
 func (h *Handler) HandleToDoByID() http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			idStr := strings.TrimPrefix(r.URL.Path, "/todos/")
+			idStr, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/todos/"), "/")
 			id, err := strconv.ParseUint(idStr, 10, 64)
 			if err != nil {
 				http.Error(w, "Invalid id in url", http.StatusBadRequest)
 				return
 			}
 
+			sub, revStr, hasRev := strings.Cut(sub, "/")
+			if hasRev && sub != "revisions" {
+				http.NotFound(w, r)
+				return
+			}
+
+			switch sub {
+			case "":
+			case "children", "tree":
+				if r.Method != http.MethodGet {
+					w.Header().Set("Allow", "GET")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				if sub == "children" {
+					h.getChildren(w, r, id)
+				} else {
+					h.getTree(w, r, id)
+				}
+				return
+			case "revert":
+				if r.Method != http.MethodPost {
+					w.Header().Set("Allow", "POST")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				h.revertNote(w, r, id)
+				return
+			case "revisions":
+				if r.Method != http.MethodGet {
+					w.Header().Set("Allow", "GET")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				if !hasRev {
+					h.getRevisions(w, r, id)
+					return
+				}
+				rev, err := strconv.ParseUint(revStr, 10, 64)
+				if err != nil {
+					http.Error(w, "Invalid revision in url", http.StatusBadRequest)
+					return
+				}
+				h.getRevision(w, r, id, rev)
+				return
+			default:
+				http.NotFound(w, r)
+				return
+			}
+
 			switch r.Method {
 			case http.MethodGet:
 				h.getNoteByID(w, r, id)
 			case http.MethodPut:
 				h.putNoteByID(w, r, id)
+			case http.MethodPatch:
+				h.patchNoteByID(w, r, id)
 			case http.MethodDelete:
 				h.deleteNoteByID(w, r, id)
 			default:
-				w.Header().Set("Allow", "GET, PUT, DELETE")
+				w.Header().Set("Allow", "GET, PUT, PATCH, DELETE")
 				w.WriteHeader(http.StatusMethodNotAllowed)
 			}
 		},
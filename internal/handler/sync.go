@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/fwhyjke/golang_test/internal/events"
+	"github.com/fwhyjke/golang_test/internal/repository"
+	"github.com/fwhyjke/golang_test/internal/websocket"
+)
+
+// pingInterval is how often the server pings a sync client. A client that
+// sends nothing, pongs included, for two intervals is disconnected.
+const pingInterval = 30 * time.Second
+
+// commandTimeout limits every command the same way TimeoutMiddleware limits a
+// request.
+const commandTimeout = 5 * time.Second
+
+// syncCommand is a message from a sync client. ID is echoed in the reply.
+type syncCommand struct {
+	ID       string                `json:"id"`
+	Type     string                `json:"type"`
+	NoteID   uint64                `json:"note_id,omitempty"`
+	Version  uint64                `json:"version,omitempty"`
+	Note     repository.NoteDTO    `json:"note"`
+	Children repository.DeleteMode `json:"children,omitempty"`
+	Force    bool                  `json:"force,omitempty"`
+	After    *uint64               `json:"after,omitempty"`
+}
+
+// syncMessage is a message to a sync client: the reply to a command or a
+// change event.
+type syncMessage struct {
+	ID     string            `json:"id,omitempty"`
+	Type   string            `json:"type"`
+	Status int               `json:"status,omitempty"`
+	Note   *repository.Note  `json:"note,omitempty"`
+	Seq    *uint64           `json:"seq,omitempty"`
+	Reset  bool              `json:"reset,omitempty"`
+	Event  *repository.Event `json:"event,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// WithAllowedOrigins lets browser pages from origins, besides those served by
+// this host, open /todos/ws.
+func WithAllowedOrigins(origins ...string) Option {
+	return func(h *Handler) {
+		h.origins = origins
+	}
+}
+
+type SyncHandler struct {
+	notes        *Handler
+	bus          *events.Bus
+	pingInterval time.Duration
+}
+
+func NewSyncHandler(notes *Handler, bus *events.Bus) *SyncHandler {
+	return &SyncHandler{
+		notes:        notes,
+		bus:          bus,
+		pingInterval: pingInterval,
+	}
+}
+
+func (h *SyncHandler) HandleSync() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			conn, err := websocket.Upgrade(w, r, h.notes.origins...)
+			if err != nil {
+				log.Printf("error: websocket upgrade: %s", err)
+				return
+			}
+
+			s := &syncSession{h: h, conn: conn, ctx: r.Context()}
+			s.serve()
+		},
+	)
+}
+
+// syncSession is one connected sync client. Commands are read and run one at
+// a time; events are forwarded by a goroutine of their own.
+type syncSession struct {
+	h    *SyncHandler
+	conn *websocket.Conn
+	ctx  context.Context
+	sub  *events.Subscription
+
+	// started is set by subscribe; forwarding starts once the reply is sent.
+	started bool
+}
+
+func (s *syncSession) serve() {
+	defer s.conn.Close(websocket.CloseNormal, "")
+	defer s.unsubscribe()
+
+	s.conn.SetReadTimeout(2 * s.h.pingInterval)
+	done := make(chan struct{})
+	defer close(done)
+	go s.ping(done)
+
+	for {
+		op, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if op != websocket.OpText {
+			s.conn.Close(websocket.CloseUnsupportedData, "only text messages are accepted")
+			return
+		}
+
+		var cmd syncCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			s.send(syncError("", http.StatusBadRequest, decodeError(err).Error()))
+			continue
+		}
+		s.send(s.run(cmd))
+		if s.started {
+			s.started = false
+			go s.forward(s.sub)
+		}
+	}
+}
+
+func (s *syncSession) ping(done <-chan struct{}) {
+	ticker := time.NewTicker(s.h.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := s.conn.Ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// run carries out cmd with the same checks and repository calls as the HTTP
+// handlers and returns the reply.
+func (s *syncSession) run(cmd syncCommand) syncMessage {
+	ctx, cancel := context.WithTimeout(s.ctx, commandTimeout)
+	defer cancel()
+	if cmd.Force {
+		ctx = repository.WithForce(ctx)
+	}
+
+	reply := syncMessage{ID: cmd.ID, Type: "result"}
+	var note repository.Note
+	var err error
+	switch cmd.Type {
+	case "subscribe":
+		s.subscribe(cmd.After, &reply)
+		return reply
+	case "unsubscribe":
+		s.unsubscribe()
+		reply.Status = http.StatusOK
+		return reply
+	case "create":
+		if err := checkNote(cmd.Note); err != nil {
+			return syncError(cmd.ID, http.StatusBadRequest, err.Error())
+		}
+		note, err = s.h.notes.repo.Create(ctx, cmd.Note)
+		reply.Status = http.StatusCreated
+	case "update":
+		if err := checkNote(cmd.Note); err != nil {
+			return syncError(cmd.ID, http.StatusBadRequest, err.Error())
+		}
+		note, err = s.h.notes.updateNote(ctx, cmd.NoteID, cmd.Version, cmd.Version != repository.AnyVersion, cmd.Note)
+		reply.Status = http.StatusOK
+	case "delete":
+		if err := checkDeleteMode(cmd.Children); err != nil {
+			return syncError(cmd.ID, http.StatusBadRequest, err.Error())
+		}
+		err = s.h.notes.deleteNote(ctx, cmd.NoteID, cmd.Version, cmd.Version != repository.AnyVersion, cmd.Children)
+		reply.Status = http.StatusNoContent
+	default:
+		return syncError(cmd.ID, http.StatusBadRequest, "type must be subscribe, unsubscribe, create, update or delete")
+	}
+
+	if err != nil {
+		status, message, logMessage := errorStatus(err)
+		log.Printf("error: sync command %q: code %d: %s", cmd.Type, status, logMessage)
+		return syncError(cmd.ID, status, message)
+	}
+	if cmd.Type != "delete" {
+		reply.Note = &note
+	}
+	return reply
+}
+
+// subscribe starts forwarding the changes of the notes of the tenant. With
+// after set, the kept events published after it are sent first, like with
+// Last-Event-ID on the event stream.
+func (s *syncSession) subscribe(after *uint64, reply *syncMessage) {
+	s.unsubscribe()
+
+	tenant := repository.TenantFrom(s.ctx)
+	filter := func(ev repository.Event) bool {
+		return ev.Tenant == tenant
+	}
+	resumed := true
+	if after == nil {
+		s.sub = s.h.bus.Subscribe(events.DefaultBuffer, filter)
+	} else {
+		s.sub, resumed = s.h.bus.SubscribeFrom(*after, events.DefaultBuffer, filter)
+	}
+
+	seq := s.sub.Start()
+	reply.Status = http.StatusOK
+	reply.Seq = &seq
+	reply.Reset = !resumed
+	s.started = true
+}
+
+func (s *syncSession) unsubscribe() {
+	if s.sub != nil {
+		s.sub.Close()
+		s.sub = nil
+		s.started = false
+	}
+}
+
+// forward sends the events of sub until it ends. A client dropped for being
+// too slow is told so and may subscribe again with after.
+func (s *syncSession) forward(sub *events.Subscription) {
+	for ev := range sub.Events() {
+		s.send(syncMessage{Type: "event", Event: &ev})
+	}
+	if err := sub.Err(); err != nil {
+		s.send(syncError("", http.StatusServiceUnavailable, err.Error()))
+	}
+}
+
+func syncError(id string, status int, message string) syncMessage {
+	return syncMessage{ID: id, Type: "error", Status: status, Error: message}
+}
+
+func (s *syncSession) send(msg syncMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("error: sync message: %s", err)
+		return
+	}
+	s.conn.WriteMessage(websocket.OpText, data)
+}
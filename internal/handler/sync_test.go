@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwhyjke/golang_test/internal/events"
+	"github.com/fwhyjke/golang_test/internal/middleware"
+	"github.com/fwhyjke/golang_test/internal/repository"
+	"github.com/fwhyjke/golang_test/internal/websocket"
+)
+
+func TestSync(t *testing.T) {
+	mockRepo := &MockRepository{
+		CreateFunc: func(ctx context.Context, dto repository.NoteDTO) (repository.Note, error) {
+			return repository.Note{ID: 1, Title: dto.Title, Version: 1}, nil
+		},
+		UpdateIfMatchFunc: func(ctx context.Context, id uint64, version uint64, dto repository.NoteDTO) (repository.Note, error) {
+			return repository.Note{}, repository.ErrVersionMismatch
+		},
+		DeleteFunc: func(ctx context.Context, id uint64) error {
+			if id != 1 {
+				return repository.ErrNotFoundID
+			}
+			return nil
+		},
+	}
+	bus := events.NewBus(10)
+	handler := NewSyncHandler(NewHandler(mockRepo), bus)
+	tokens := middleware.TenantTokens{}
+	tokens.Add("default-token", repository.DefaultTenant)
+	srv := httptest.NewServer(middleware.Chain(handler.HandleSync(), middleware.TenantMiddleware(tokens)))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{"Authorization": {"Bearer default-token"}})
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close(websocket.CloseNormal, "")
+	conn.SetReadTimeout(5 * time.Second)
+
+	header := http.Header{"Authorization": {"Bearer default-token"}, "Origin": {"https://evil.test"}}
+	if _, res, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), header); !errors.Is(err, websocket.ErrBadHandshake) || res.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-origin dial: expected %v with status %v, got %v", websocket.ErrBadHandshake, http.StatusForbidden, err)
+	}
+
+	roundTrip := func(msg string) string {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.OpText, []byte(msg)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		return string(data)
+	}
+
+	if reply := roundTrip(`{"id":"s","type":"subscribe"}`); reply != `{"id":"s","type":"result","status":200,"seq":0}` {
+		t.Errorf("subscribe: unexpected reply %v", reply)
+	}
+	bus.Publish(repository.Event{Type: repository.NoteCreated, Tenant: "acme", NoteID: 7})
+	bus.Publish(repository.Event{Type: repository.NoteCreated, Tenant: repository.DefaultTenant, NoteID: 1})
+	_, data, err := conn.ReadMessage()
+	var msg syncMessage
+	if err != nil || json.Unmarshal(data, &msg) != nil || msg.Type != "event" || msg.Event.Seq != 2 || msg.Event.NoteID != 1 {
+		t.Errorf("event: expected note 1 at seq 2, got %s (%v)", data, err)
+	}
+
+	testTable := []struct {
+		name     string
+		req      string
+		expReply string
+	}{
+		{
+			name:     "create",
+			req:      `{"id":"1","type":"create","note":{"title":"a"}}`,
+			expReply: `{"id":"1","type":"result","status":201,"note":{"id":1,"title":"a","description":"","done":false,"version":1}}`,
+		},
+		{
+			name:     "create without title",
+			req:      `{"id":"2","type":"create","note":{"title":" "}}`,
+			expReply: `{"id":"2","type":"error","status":400,"error":"note must have a title"}`,
+		},
+		{
+			name:     "stale update",
+			req:      `{"id":"3","type":"update","note_id":1,"version":4,"note":{"title":"b"}}`,
+			expReply: `{"id":"3","type":"error","status":412,"error":"note version does not match"}`,
+		},
+		{
+			name:     "delete",
+			req:      `{"id":"4","type":"delete","note_id":1}`,
+			expReply: `{"id":"4","type":"result","status":204}`,
+		},
+		{
+			name:     "delete missing note",
+			req:      `{"id":"5","type":"delete","note_id":9}`,
+			expReply: `{"id":"5","type":"error","status":404,"error":"note by ID not found"}`,
+		},
+		{
+			name:     "invalid children",
+			req:      `{"id":"6","type":"delete","note_id":1,"children":"all"}`,
+			expReply: `{"id":"6","type":"error","status":400,"error":"children must be one of reject, cascade, orphan"}`,
+		},
+		{
+			name:     "unknown type",
+			req:      `{"id":"7","type":"move"}`,
+			expReply: `{"id":"7","type":"error","status":400,"error":"type must be subscribe, unsubscribe, create, update or delete"}`,
+		},
+		{
+			name:     "invalid json",
+			req:      `{"id":`,
+			expReply: `{"type":"error","status":400,"error":"invalid json"}`,
+		},
+		{
+			name:     "resume with unknown event",
+			req:      `{"id":"8","type":"subscribe","after":99}`,
+			expReply: `{"id":"8","type":"result","status":200,"seq":2,"reset":true}`,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			if reply := roundTrip(testCase.req); reply != testCase.expReply {
+				t.Errorf("reply: expected %v, got %v", testCase.expReply, reply)
+			}
+		})
+	}
+}
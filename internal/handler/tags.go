@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+type TagHandler struct {
+	repo repository.TagRepository
+}
+
+func NewTagHandler(repo repository.TagRepository) *TagHandler {
+	return &TagHandler{
+		repo: repo,
+	}
+}
+
+type tagDTO struct {
+	Name string `json:"name"`
+}
+
+type mergeDTO struct {
+	Into uint64 `json:"into"`
+}
+
+func (h *TagHandler) HandleTags() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				h.postTag(w, r)
+			case http.MethodGet:
+				h.getTags(w, r)
+			default:
+				w.Header().Set("Allow", "GET, POST")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		},
+	)
+}
+
+func (h *TagHandler) HandleTagByID() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/tags/"), "/")
+			id, err := strconv.ParseUint(idStr, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid id in url", http.StatusBadRequest)
+				return
+			}
+
+			switch action {
+			case "":
+			case "merge":
+				if r.Method != http.MethodPost {
+					w.Header().Set("Allow", "POST")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				h.mergeTag(w, r, id)
+				return
+			default:
+				http.NotFound(w, r)
+				return
+			}
+
+			switch r.Method {
+			case http.MethodGet:
+				h.getTagByID(w, r, id)
+			case http.MethodPut:
+				h.putTagByID(w, r, id)
+			case http.MethodDelete:
+				h.deleteTagByID(w, r, id)
+			default:
+				w.Header().Set("Allow", "GET, PUT, DELETE")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		},
+	)
+}
+
+func (h *TagHandler) postTag(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !(r.Header.Get("Content-Type") == "application/json") {
+		http.Error(w, "invalid media-type, must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var dto tagDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.repo.CreateTag(ctx, dto.Name)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+func (h *TagHandler) getTags(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	tags, err := h.repo.ListTags(ctx)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+func (h *TagHandler) getTagByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+
+	tag, err := h.repo.GetTag(ctx, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+func (h *TagHandler) putTagByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+	if !(r.Header.Get("Content-Type") == "application/json") {
+		http.Error(w, "invalid media-type, must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var dto tagDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.repo.RenameTag(ctx, id, dto.Name)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+func (h *TagHandler) deleteTagByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+
+	if err := h.repo.DeleteTag(ctx, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TagHandler) mergeTag(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+	if !(r.Header.Get("Content-Type") == "application/json") {
+		http.Error(w, "invalid media-type, must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var dto mergeDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	tag, err := h.repo.MergeTags(ctx, id, dto.Into)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
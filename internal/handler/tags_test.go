@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+type MockTagRepository struct {
+	CreateTagFunc func(ctx context.Context, name string) (repository.Tag, error)
+	GetTagFunc    func(ctx context.Context, id uint64) (repository.Tag, error)
+	ListTagsFunc  func(ctx context.Context) ([]repository.Tag, error)
+	RenameTagFunc func(ctx context.Context, id uint64, name string) (repository.Tag, error)
+	DeleteTagFunc func(ctx context.Context, id uint64) error
+	MergeTagsFunc func(ctx context.Context, from uint64, into uint64) (repository.Tag, error)
+}
+
+func (m *MockTagRepository) CreateTag(ctx context.Context, name string) (repository.Tag, error) {
+	if m.CreateTagFunc != nil {
+		return m.CreateTagFunc(ctx, name)
+	}
+	return repository.Tag{}, nil
+}
+
+func (m *MockTagRepository) GetTag(ctx context.Context, id uint64) (repository.Tag, error) {
+	if m.GetTagFunc != nil {
+		return m.GetTagFunc(ctx, id)
+	}
+	return repository.Tag{}, nil
+}
+
+func (m *MockTagRepository) ListTags(ctx context.Context) ([]repository.Tag, error) {
+	if m.ListTagsFunc != nil {
+		return m.ListTagsFunc(ctx)
+	}
+	return []repository.Tag{}, nil
+}
+
+func (m *MockTagRepository) RenameTag(ctx context.Context, id uint64, name string) (repository.Tag, error) {
+	if m.RenameTagFunc != nil {
+		return m.RenameTagFunc(ctx, id, name)
+	}
+	return repository.Tag{}, nil
+}
+
+func (m *MockTagRepository) DeleteTag(ctx context.Context, id uint64) error {
+	if m.DeleteTagFunc != nil {
+		return m.DeleteTagFunc(ctx, id)
+	}
+	return nil
+}
+
+func (m *MockTagRepository) MergeTags(ctx context.Context, from uint64, into uint64) (repository.Tag, error) {
+	if m.MergeTagsFunc != nil {
+		return m.MergeTagsFunc(ctx, from, into)
+	}
+	return repository.Tag{}, nil
+}
+
+func TestHandleTags(t *testing.T) {
+	testTable := []struct {
+		name      string
+		method    string
+		req       string
+		mockRepo  *MockTagRepository
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:   "create",
+			method: http.MethodPost,
+			req:    `{"name": "Backend"}`,
+			mockRepo: &MockTagRepository{CreateTagFunc: func(ctx context.Context, name string) (repository.Tag, error) {
+				return repository.Tag{ID: 1, Name: strings.ToLower(name)}, nil
+			}},
+			expStatus: http.StatusCreated,
+			expBody:   `{"id":1,"name":"backend","notes":0}`,
+		},
+		{
+			name:   "create existing",
+			method: http.MethodPost,
+			req:    `{"name": "backend"}`,
+			mockRepo: &MockTagRepository{CreateTagFunc: func(ctx context.Context, name string) (repository.Tag, error) {
+				return repository.Tag{}, repository.ErrTagExists
+			}},
+			expStatus: http.StatusConflict,
+			expBody:   "tag with this name already exists",
+		},
+		{
+			name:   "create invalid",
+			method: http.MethodPost,
+			req:    `{"name": " "}`,
+			mockRepo: &MockTagRepository{CreateTagFunc: func(ctx context.Context, name string) (repository.Tag, error) {
+				return repository.Tag{}, repository.ErrInvalidTagName
+			}},
+			expStatus: http.StatusBadRequest,
+			expBody:   "bad request: tag name must not be empty or contain commas",
+		},
+		{
+			name:   "list",
+			method: http.MethodGet,
+			mockRepo: &MockTagRepository{ListTagsFunc: func(ctx context.Context) ([]repository.Tag, error) {
+				return []repository.Tag{{ID: 2, Name: "api", Notes: 3}, {ID: 1, Name: "backend", Notes: 1}}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `[{"id":2,"name":"api","notes":3},{"id":1,"name":"backend","notes":1}]`,
+		},
+		{
+			name:      "wrong method",
+			method:    http.MethodDelete,
+			mockRepo:  &MockTagRepository{},
+			expStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := NewTagHandler(testCase.mockRepo)
+
+			req := httptest.NewRequest(testCase.method, "/tags", strings.NewReader(testCase.req))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.HandleTags().ServeHTTP(rec, req)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
+
+func TestHandleTagByID(t *testing.T) {
+	testTable := []struct {
+		name      string
+		method    string
+		url       string
+		req       string
+		mockRepo  *MockTagRepository
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:   "get",
+			method: http.MethodGet,
+			url:    "/tags/1",
+			mockRepo: &MockTagRepository{GetTagFunc: func(ctx context.Context, id uint64) (repository.Tag, error) {
+				return repository.Tag{ID: id, Name: "backend", Notes: 2}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"name":"backend","notes":2}`,
+		},
+		{
+			name:   "get missing",
+			method: http.MethodGet,
+			url:    "/tags/7",
+			mockRepo: &MockTagRepository{GetTagFunc: func(ctx context.Context, id uint64) (repository.Tag, error) {
+				return repository.Tag{}, repository.ErrTagNotFound
+			}},
+			expStatus: http.StatusNotFound,
+			expBody:   "tag not found",
+		},
+		{
+			name:   "rename",
+			method: http.MethodPut,
+			url:    "/tags/1",
+			req:    `{"name": "server"}`,
+			mockRepo: &MockTagRepository{RenameTagFunc: func(ctx context.Context, id uint64, name string) (repository.Tag, error) {
+				return repository.Tag{ID: id, Name: name, Notes: 2}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"name":"server","notes":2}`,
+		},
+		{
+			name:   "delete",
+			method: http.MethodDelete,
+			url:    "/tags/1",
+			mockRepo: &MockTagRepository{DeleteTagFunc: func(ctx context.Context, id uint64) error {
+				return nil
+			}},
+			expStatus: http.StatusNoContent,
+		},
+		{
+			name:   "merge",
+			method: http.MethodPost,
+			url:    "/tags/1/merge",
+			req:    `{"into": 2}`,
+			mockRepo: &MockTagRepository{MergeTagsFunc: func(ctx context.Context, from uint64, into uint64) (repository.Tag, error) {
+				return repository.Tag{ID: into, Name: "api", Notes: 4}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `{"id":2,"name":"api","notes":4}`,
+		},
+		{
+			name:   "merge into itself",
+			method: http.MethodPost,
+			url:    "/tags/1/merge",
+			req:    `{"into": 1}`,
+			mockRepo: &MockTagRepository{MergeTagsFunc: func(ctx context.Context, from uint64, into uint64) (repository.Tag, error) {
+				return repository.Tag{}, repository.ErrMergeIntoItself
+			}},
+			expStatus: http.StatusBadRequest,
+			expBody:   "bad request: tag cannot be merged into itself",
+		},
+		{
+			name:      "merge wrong method",
+			method:    http.MethodGet,
+			url:       "/tags/1/merge",
+			mockRepo:  &MockTagRepository{},
+			expStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:      "unknown action",
+			method:    http.MethodPost,
+			url:       "/tags/1/split",
+			mockRepo:  &MockTagRepository{},
+			expStatus: http.StatusNotFound,
+			expBody:   "404 page not found",
+		},
+		{
+			name:      "invalid id",
+			method:    http.MethodGet,
+			url:       "/tags/abc",
+			mockRepo:  &MockTagRepository{},
+			expStatus: http.StatusBadRequest,
+			expBody:   "Invalid id in url",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := NewTagHandler(testCase.mockRepo)
+
+			req := httptest.NewRequest(testCase.method, testCase.url, strings.NewReader(testCase.req))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.HandleTagByID().ServeHTTP(rec, req)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+type TrashHandler struct {
+	repo repository.TrashRepository
+}
+
+func NewTrashHandler(repo repository.TrashRepository) *TrashHandler {
+	return &TrashHandler{
+		repo: repo,
+	}
+}
+
+func (h *TrashHandler) HandleTrash() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			h.getTrash(w, r)
+		},
+	)
+}
+
+// HandleTrashByID serves /trash/{id} and /trash/{id}/restore.
+func (h *TrashHandler) HandleTrashByID() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			idStr, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/trash/"), "/")
+			id, err := strconv.ParseUint(idStr, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid id in url", http.StatusBadRequest)
+				return
+			}
+
+			switch action {
+			case "":
+				if r.Method != http.MethodDelete {
+					w.Header().Set("Allow", "DELETE")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				h.purgeNote(w, r, id)
+			case "restore":
+				if r.Method != http.MethodPost {
+					w.Header().Set("Allow", "POST")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				h.restoreNote(w, r, id)
+			default:
+				http.NotFound(w, r)
+			}
+		},
+	)
+}
+
+func (h *TrashHandler) getTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	notes, err := h.repo.Trash(ctx)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notes)
+}
+
+func (h *TrashHandler) restoreNote(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+
+	note, err := h.repo.Restore(ctx, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	setETag(w, note)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
+
+func (h *TrashHandler) purgeNote(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+
+	if err := h.repo.Purge(ctx, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+type MockTrashRepository struct {
+	TrashFunc   func(ctx context.Context) ([]repository.Note, error)
+	RestoreFunc func(ctx context.Context, id uint64) (repository.Note, error)
+	PurgeFunc   func(ctx context.Context, id uint64) error
+}
+
+func (m *MockTrashRepository) Trash(ctx context.Context) ([]repository.Note, error) {
+	if m.TrashFunc != nil {
+		return m.TrashFunc(ctx)
+	}
+	return []repository.Note{}, nil
+}
+
+func (m *MockTrashRepository) Restore(ctx context.Context, id uint64) (repository.Note, error) {
+	if m.RestoreFunc != nil {
+		return m.RestoreFunc(ctx, id)
+	}
+	return repository.Note{}, nil
+}
+
+func (m *MockTrashRepository) Purge(ctx context.Context, id uint64) error {
+	if m.PurgeFunc != nil {
+		return m.PurgeFunc(ctx, id)
+	}
+	return nil
+}
+
+func TestHandleTrash(t *testing.T) {
+	deletedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	testTable := []struct {
+		name      string
+		method    string
+		url       string
+		mockRepo  *MockTrashRepository
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:   "list",
+			method: http.MethodGet,
+			url:    "/trash",
+			mockRepo: &MockTrashRepository{TrashFunc: func(ctx context.Context) ([]repository.Note, error) {
+				return []repository.Note{{ID: 2, Title: "t2", Version: 2, DeletedAt: &deletedAt}}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `[{"id":2,"title":"t2","description":"","done":false,"version":2,"deleted_at":"2025-03-01T12:00:00Z"}]`,
+		},
+		{
+			name:      "list wrong method",
+			method:    http.MethodDelete,
+			url:       "/trash",
+			mockRepo:  &MockTrashRepository{},
+			expStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "restore",
+			method: http.MethodPost,
+			url:    "/trash/2/restore",
+			mockRepo: &MockTrashRepository{RestoreFunc: func(ctx context.Context, id uint64) (repository.Note, error) {
+				return repository.Note{ID: id, Title: "t2", Version: 3}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `{"id":2,"title":"t2","description":"","done":false,"version":3}`,
+		},
+		{
+			name:   "restore missing",
+			method: http.MethodPost,
+			url:    "/trash/7/restore",
+			mockRepo: &MockTrashRepository{RestoreFunc: func(ctx context.Context, id uint64) (repository.Note, error) {
+				return repository.Note{}, repository.ErrNotFoundID
+			}},
+			expStatus: http.StatusNotFound,
+			expBody:   "note by ID not found",
+		},
+		{
+			name:      "restore wrong method",
+			method:    http.MethodGet,
+			url:       "/trash/2/restore",
+			mockRepo:  &MockTrashRepository{},
+			expStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:   "purge",
+			method: http.MethodDelete,
+			url:    "/trash/2",
+			mockRepo: &MockTrashRepository{PurgeFunc: func(ctx context.Context, id uint64) error {
+				return nil
+			}},
+			expStatus: http.StatusNoContent,
+		},
+		{
+			name:      "unknown action",
+			method:    http.MethodPost,
+			url:       "/trash/2/undo",
+			mockRepo:  &MockTrashRepository{},
+			expStatus: http.StatusNotFound,
+			expBody:   "404 page not found",
+		},
+		{
+			name:      "invalid id",
+			method:    http.MethodDelete,
+			url:       "/trash/abc",
+			mockRepo:  &MockTrashRepository{},
+			expStatus: http.StatusBadRequest,
+			expBody:   "Invalid id in url",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := NewTrashHandler(testCase.mockRepo)
+
+			req := httptest.NewRequest(testCase.method, testCase.url, nil)
+			rec := httptest.NewRecorder()
+
+			if testCase.url == "/trash" {
+				handler.HandleTrash().ServeHTTP(rec, req)
+			} else {
+				handler.HandleTrashByID().ServeHTTP(rec, req)
+			}
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
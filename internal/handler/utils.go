@@ -5,15 +5,39 @@ import (
 	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fwhyjke/golang_test/internal/repository"
+	"github.com/fwhyjke/golang_test/internal/webhooks"
 )
 
 func handleError(w http.ResponseWriter, err error) {
-	var statusCode int
-	var message string
-	var logMessage string
+	var errs queryErrors
+	var queryErr *repository.QueryError
+	switch {
+	case errors.As(err, &errs):
+	case errors.As(err, &queryErr):
+		errs = queryErrors{queryErr}
+	}
+	if errs != nil {
+		log.Printf("error: code %d: %s", http.StatusBadRequest, errs.Error())
+		writeQueryErrors(w, errs)
+		return
+	}
+
+	statusCode, message, logMessage := errorStatus(err)
+	log.Printf("error: code %d: %s", statusCode, logMessage)
 
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(statusCode)
+	w.Write([]byte(message + "\n"))
+}
+
+// errorStatus maps a repository error to the status code and message sent to
+// the client and to the message written to the log.
+func errorStatus(err error) (statusCode int, message string, logMessage string) {
 	switch {
 	case errors.Is(err, context.Canceled):
 		statusCode = http.StatusGatewayTimeout
@@ -24,25 +48,169 @@ func handleError(w http.ResponseWriter, err error) {
 		message = "time is out"
 		logMessage = "timeout:" + err.Error()
 
-	case errors.Is(err, repository.ErrNotFoundID):
+	case errors.Is(err, repository.ErrNotFoundID),
+		errors.Is(err, repository.ErrTagNotFound),
+		errors.Is(err, repository.ErrListNotFound),
+		errors.Is(err, repository.ErrRevisionNotFound),
+		errors.Is(err, webhooks.ErrWebhookNotFound),
+		errors.Is(err, webhooks.ErrDeliveryNotFound):
 		statusCode = http.StatusNotFound
 		message = err.Error()
 		logMessage = err.Error()
 
-	case errors.Is(err, repository.ErrTitleNotDefined):
+	case errors.Is(err, repository.ErrTitleNotDefined),
+		errors.Is(err, repository.ErrInvalidTagName),
+		errors.Is(err, repository.ErrMergeIntoItself),
+		errors.Is(err, repository.ErrParentNotFound),
+		errors.Is(err, repository.ErrBlockerNotFound),
+		errors.Is(err, repository.ErrInvalidRecurrence),
+		errors.Is(err, repository.ErrRecurrenceNeedsDue),
+		errors.Is(err, repository.ErrListNameRequired),
+		errors.Is(err, repository.ErrInvalidListDelete),
+		errors.Is(err, repository.ErrInvalidBatchOp),
+		errors.Is(err, webhooks.ErrInvalidURL),
+		errors.Is(err, webhooks.ErrPrivateAddress),
+		errors.Is(err, webhooks.ErrInvalidEventType):
 		statusCode = http.StatusBadRequest
 		message = "bad request: " + err.Error()
 		logMessage = err.Error()
 
+	case errors.Is(err, repository.ErrInvalidCursor), errors.Is(err, repository.ErrEmptySearch):
+		statusCode = http.StatusBadRequest
+		message = "bad request: " + err.Error()
+		logMessage = err.Error()
+
+	case errors.Is(err, repository.ErrVersionMismatch):
+		statusCode = http.StatusPreconditionFailed
+		message = err.Error()
+		logMessage = err.Error()
+
+	case errors.Is(err, repository.ErrNotPersistent),
+		errors.Is(err, repository.ErrTagExists),
+		errors.Is(err, repository.ErrParentCycle),
+		errors.Is(err, repository.ErrHasChildren),
+		errors.Is(err, repository.ErrDependencyCycle),
+		errors.Is(err, repository.ErrBlocked),
+		errors.Is(err, repository.ErrListNotEmpty),
+		errors.Is(err, webhooks.ErrDeliveryPending),
+		errors.Is(err, webhooks.ErrTooManyPending):
+		statusCode = http.StatusConflict
+		message = err.Error()
+		logMessage = err.Error()
+
+	case errors.Is(err, repository.ErrBatchRolledBack):
+		statusCode = http.StatusFailedDependency
+		message = err.Error()
+		logMessage = err.Error()
+
 	default:
 		statusCode = http.StatusInternalServerError
 		message = "internal server error"
 		logMessage = "internal error: " + err.Error()
 	}
+	return statusCode, message, logMessage
+}
 
-	log.Printf("error: code %d: %s", statusCode, logMessage)
+var errInvalidJSON error = errors.New("invalid json")
+var errBodyTooLarge error = errors.New("request body must not be larger than 1 MiB")
 
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(statusCode)
-	w.Write([]byte(message + "\n"))
+// maxNoteBody is the largest note accepted in a request body.
+const maxNoteBody = 1 << 20
+
+// bodyTooLarge tells whether err comes from reading past http.MaxBytesReader.
+func bodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+var errInvalidDueAt error = errors.New("due_at must be an RFC 3339 time")
+var errInvalidForce error = errors.New("force must be a boolean")
+var errInvalidIfMatch error = errors.New("If-Match must be \"*\" or a single strong ETag")
+
+// decodeError explains why a note body could not be decoded. Bad due dates
+// get their own message since the JSON itself is usually fine.
+func decodeError(err error) error {
+	var parseErr *time.ParseError
+	if errors.As(err, &parseErr) {
+		return errInvalidDueAt
+	}
+	return errInvalidJSON
+}
+
+// forceContext returns the request context, marked with repository.WithForce
+// when the client asked for ?force=true.
+func forceContext(r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+
+	value := r.URL.Query().Get("force")
+	if value == "" {
+		return ctx, nil
+	}
+
+	force, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errInvalidForce
+	}
+	if force {
+		ctx = repository.WithForce(ctx)
+	}
+	return ctx, nil
+}
+
+var errInvalidDeleteMode error = errors.New("children must be one of reject, cascade, orphan")
+
+// checkNote rejects a note body that the repository would refuse anyway, with
+// a message that names the problem.
+func checkNote(dto repository.NoteDTO) error {
+	if strings.TrimSpace(dto.Title) == "" {
+		return errTitleRemoved
+	}
+	return checkRecurrence(dto.Recurrence)
+}
+
+// checkDeleteMode rejects an unknown way to handle subtasks. An empty mode is
+// valid.
+func checkDeleteMode(mode repository.DeleteMode) error {
+	switch mode {
+	case "", repository.DeleteReject, repository.DeleteCascade, repository.DeleteOrphan:
+		return nil
+	}
+	return errInvalidDeleteMode
+}
+
+// checkRecurrence rejects a malformed recurrence rule before it reaches the
+// repository.
+func checkRecurrence(rule string) error {
+	if rule == "" {
+		return nil
+	}
+	_, err := repository.ParseRule(rule)
+	return err
+}
+
+func setETag(w http.ResponseWriter, note repository.Note) {
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatUint(note.Version, 10)))
+}
+
+// parseIfMatch returns the note version required by the If-Match header and
+// reports whether the request is conditional at all.
+func parseIfMatch(r *http.Request) (uint64, bool, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch value {
+	case "":
+		return repository.AnyVersion, false, nil
+	case "*":
+		return repository.AnyVersion, true, nil
+	}
+
+	unquoted, err := strconv.Unquote(value)
+	if err != nil || !strings.HasPrefix(value, `"`) {
+		return 0, false, errInvalidIfMatch
+	}
+
+	version, err := strconv.ParseUint(unquoted, 10, 64)
+	if err != nil || version == repository.AnyVersion {
+		return 0, false, errInvalidIfMatch
+	}
+
+	return version, true, nil
 }
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fwhyjke/golang_test/internal/webhooks"
+)
+
+// WebhookHandler serves /webhooks, the registrations of the tenant and the
+// log of what was sent to them.
+type WebhookHandler struct {
+	hooks webhooks.Manager
+}
+
+func NewWebhookHandler(hooks webhooks.Manager) *WebhookHandler {
+	return &WebhookHandler{
+		hooks: hooks,
+	}
+}
+
+func (h *WebhookHandler) HandleWebhooks() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost:
+				h.postWebhook(w, r)
+			case http.MethodGet:
+				h.getWebhooks(w, r)
+			default:
+				w.Header().Set("Allow", "GET, POST")
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		},
+	)
+}
+
+// HandleWebhookByID serves /webhooks/dead-letters, /webhooks/{id},
+// /webhooks/{id}/deliveries, /webhooks/{id}/deliveries/{deliveryID} and
+// /webhooks/{id}/deliveries/{deliveryID}/redeliver.
+func (h *WebhookHandler) HandleWebhookByID() http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/webhooks/"), "/")
+			if len(parts) == 1 && parts[0] == "dead-letters" {
+				if r.Method != http.MethodGet {
+					w.Header().Set("Allow", "GET")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				h.getDeadLetters(w, r)
+				return
+			}
+
+			id, err := strconv.ParseUint(parts[0], 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid id in url", http.StatusBadRequest)
+				return
+			}
+
+			switch {
+			case len(parts) == 1:
+				switch r.Method {
+				case http.MethodGet:
+					h.getWebhookByID(w, r, id)
+				case http.MethodPut:
+					h.putWebhookByID(w, r, id)
+				case http.MethodDelete:
+					h.deleteWebhookByID(w, r, id)
+				default:
+					w.Header().Set("Allow", "GET, PUT, DELETE")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+				}
+			case len(parts) == 2 && parts[1] == "deliveries":
+				if r.Method != http.MethodGet {
+					w.Header().Set("Allow", "GET")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				h.getDeliveries(w, r, id)
+			case len(parts) == 3 && parts[1] == "deliveries":
+				deliveryID, err := strconv.ParseUint(parts[2], 10, 64)
+				if err != nil {
+					http.Error(w, "Invalid id in url", http.StatusBadRequest)
+					return
+				}
+				if r.Method != http.MethodDelete {
+					w.Header().Set("Allow", "DELETE")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				h.deleteDelivery(w, r, id, deliveryID)
+			case len(parts) == 4 && parts[1] == "deliveries" && parts[3] == "redeliver":
+				deliveryID, err := strconv.ParseUint(parts[2], 10, 64)
+				if err != nil {
+					http.Error(w, "Invalid id in url", http.StatusBadRequest)
+					return
+				}
+				if r.Method != http.MethodPost {
+					w.Header().Set("Allow", "POST")
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+				h.redeliver(w, r, id, deliveryID)
+			default:
+				http.NotFound(w, r)
+			}
+		},
+	)
+}
+
+func (h *WebhookHandler) postWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !(r.Header.Get("Content-Type") == "application/json") {
+		http.Error(w, "invalid media-type, must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var dto webhooks.WebhookDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	hook, err := h.hooks.CreateWebhook(ctx, dto)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+func (h *WebhookHandler) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	hooks, err := h.hooks.ListWebhooks(ctx)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+func (h *WebhookHandler) getWebhookByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+
+	hook, err := h.hooks.GetWebhook(ctx, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+func (h *WebhookHandler) putWebhookByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+	if !(r.Header.Get("Content-Type") == "application/json") {
+		http.Error(w, "invalid media-type, must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var dto webhooks.WebhookDTO
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	hook, err := h.hooks.UpdateWebhook(ctx, id, dto)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+func (h *WebhookHandler) deleteWebhookByID(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+
+	if err := h.hooks.DeleteWebhook(ctx, id); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) getDeliveries(w http.ResponseWriter, r *http.Request, id uint64) {
+	ctx := r.Context()
+
+	deliveries, err := h.hooks.Deliveries(ctx, id)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func (h *WebhookHandler) getDeadLetters(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	deliveries, err := h.hooks.DeadLetters(ctx)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+func (h *WebhookHandler) redeliver(w http.ResponseWriter, r *http.Request, id uint64, deliveryID uint64) {
+	ctx := r.Context()
+
+	delivery, err := h.hooks.Redeliver(ctx, id, deliveryID)
+	if err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+func (h *WebhookHandler) deleteDelivery(w http.ResponseWriter, r *http.Request, id uint64, deliveryID uint64) {
+	ctx := r.Context()
+
+	if err := h.hooks.DeleteDelivery(ctx, id, deliveryID); err != nil {
+		handleError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,313 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fwhyjke/golang_test/internal/webhooks"
+)
+
+type MockWebhookManager struct {
+	CreateWebhookFunc  func(ctx context.Context, dto webhooks.WebhookDTO) (webhooks.Webhook, error)
+	GetWebhookFunc     func(ctx context.Context, id uint64) (webhooks.Webhook, error)
+	ListWebhooksFunc   func(ctx context.Context) ([]webhooks.Webhook, error)
+	UpdateWebhookFunc  func(ctx context.Context, id uint64, dto webhooks.WebhookDTO) (webhooks.Webhook, error)
+	DeleteWebhookFunc  func(ctx context.Context, id uint64) error
+	DeliveriesFunc     func(ctx context.Context, id uint64) ([]webhooks.Delivery, error)
+	DeadLettersFunc    func(ctx context.Context) ([]webhooks.Delivery, error)
+	RedeliverFunc      func(ctx context.Context, id uint64, deliveryID uint64) (webhooks.Delivery, error)
+	DeleteDeliveryFunc func(ctx context.Context, id uint64, deliveryID uint64) error
+}
+
+func (m *MockWebhookManager) CreateWebhook(ctx context.Context, dto webhooks.WebhookDTO) (webhooks.Webhook, error) {
+	if m.CreateWebhookFunc != nil {
+		return m.CreateWebhookFunc(ctx, dto)
+	}
+	return webhooks.Webhook{}, nil
+}
+
+func (m *MockWebhookManager) GetWebhook(ctx context.Context, id uint64) (webhooks.Webhook, error) {
+	if m.GetWebhookFunc != nil {
+		return m.GetWebhookFunc(ctx, id)
+	}
+	return webhooks.Webhook{}, nil
+}
+
+func (m *MockWebhookManager) ListWebhooks(ctx context.Context) ([]webhooks.Webhook, error) {
+	if m.ListWebhooksFunc != nil {
+		return m.ListWebhooksFunc(ctx)
+	}
+	return []webhooks.Webhook{}, nil
+}
+
+func (m *MockWebhookManager) UpdateWebhook(ctx context.Context, id uint64, dto webhooks.WebhookDTO) (webhooks.Webhook, error) {
+	if m.UpdateWebhookFunc != nil {
+		return m.UpdateWebhookFunc(ctx, id, dto)
+	}
+	return webhooks.Webhook{}, nil
+}
+
+func (m *MockWebhookManager) DeleteWebhook(ctx context.Context, id uint64) error {
+	if m.DeleteWebhookFunc != nil {
+		return m.DeleteWebhookFunc(ctx, id)
+	}
+	return nil
+}
+
+func (m *MockWebhookManager) Deliveries(ctx context.Context, id uint64) ([]webhooks.Delivery, error) {
+	if m.DeliveriesFunc != nil {
+		return m.DeliveriesFunc(ctx, id)
+	}
+	return []webhooks.Delivery{}, nil
+}
+
+func (m *MockWebhookManager) DeadLetters(ctx context.Context) ([]webhooks.Delivery, error) {
+	if m.DeadLettersFunc != nil {
+		return m.DeadLettersFunc(ctx)
+	}
+	return []webhooks.Delivery{}, nil
+}
+
+func (m *MockWebhookManager) Redeliver(ctx context.Context, id uint64, deliveryID uint64) (webhooks.Delivery, error) {
+	if m.RedeliverFunc != nil {
+		return m.RedeliverFunc(ctx, id, deliveryID)
+	}
+	return webhooks.Delivery{}, nil
+}
+
+func (m *MockWebhookManager) DeleteDelivery(ctx context.Context, id uint64, deliveryID uint64) error {
+	if m.DeleteDeliveryFunc != nil {
+		return m.DeleteDeliveryFunc(ctx, id, deliveryID)
+	}
+	return nil
+}
+
+func TestHandleWebhooks(t *testing.T) {
+	testTable := []struct {
+		name      string
+		method    string
+		req       string
+		mock      *MockWebhookManager
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:   "create",
+			method: http.MethodPost,
+			req:    `{"url": "https://example.com/hook", "events": ["note.created"], "secret": "s"}`,
+			mock: &MockWebhookManager{CreateWebhookFunc: func(ctx context.Context, dto webhooks.WebhookDTO) (webhooks.Webhook, error) {
+				return webhooks.Webhook{ID: 1, URL: dto.URL, Events: dto.Events, Secret: dto.Secret}, nil
+			}},
+			expStatus: http.StatusCreated,
+			expBody:   `{"id":1,"url":"https://example.com/hook","events":["note.created"],"secret":"s","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:   "create with invalid url",
+			method: http.MethodPost,
+			req:    `{"url": "example.com"}`,
+			mock: &MockWebhookManager{CreateWebhookFunc: func(ctx context.Context, dto webhooks.WebhookDTO) (webhooks.Webhook, error) {
+				return webhooks.Webhook{}, webhooks.ErrInvalidURL
+			}},
+			expStatus: http.StatusBadRequest,
+			expBody:   "bad request: url must be an absolute http or https URL",
+		},
+		{
+			name:      "create with invalid json",
+			method:    http.MethodPost,
+			req:       `{"url":`,
+			mock:      &MockWebhookManager{},
+			expStatus: http.StatusBadRequest,
+			expBody:   "invalid json",
+		},
+		{
+			name:      "get all",
+			method:    http.MethodGet,
+			mock:      &MockWebhookManager{},
+			expStatus: http.StatusOK,
+			expBody:   `[]`,
+		},
+		{
+			name:      "wrong method",
+			method:    http.MethodDelete,
+			mock:      &MockWebhookManager{},
+			expStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := NewWebhookHandler(testCase.mock)
+
+			req := httptest.NewRequest(testCase.method, "/webhooks", strings.NewReader(testCase.req))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.HandleWebhooks().ServeHTTP(rec, req)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
+
+func TestHandleWebhookByID(t *testing.T) {
+	testTable := []struct {
+		name      string
+		method    string
+		url       string
+		req       string
+		mock      *MockWebhookManager
+		expStatus int
+		expBody   string
+	}{
+		{
+			name:   "get missing",
+			method: http.MethodGet,
+			url:    "/webhooks/7",
+			mock: &MockWebhookManager{GetWebhookFunc: func(ctx context.Context, id uint64) (webhooks.Webhook, error) {
+				return webhooks.Webhook{}, webhooks.ErrWebhookNotFound
+			}},
+			expStatus: http.StatusNotFound,
+			expBody:   "webhook not found",
+		},
+		{
+			name:   "update",
+			method: http.MethodPut,
+			url:    "/webhooks/1",
+			req:    `{"url": "http://localhost:9000/"}`,
+			mock: &MockWebhookManager{UpdateWebhookFunc: func(ctx context.Context, id uint64, dto webhooks.WebhookDTO) (webhooks.Webhook, error) {
+				return webhooks.Webhook{ID: id, URL: dto.URL}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `{"id":1,"url":"http://localhost:9000/","created_at":"0001-01-01T00:00:00Z","updated_at":"0001-01-01T00:00:00Z"}`,
+		},
+		{
+			name:   "update with unknown event",
+			method: http.MethodPut,
+			url:    "/webhooks/1",
+			req:    `{"url": "http://localhost:9000/", "events": ["note.read"]}`,
+			mock: &MockWebhookManager{UpdateWebhookFunc: func(ctx context.Context, id uint64, dto webhooks.WebhookDTO) (webhooks.Webhook, error) {
+				return webhooks.Webhook{}, webhooks.ErrInvalidEventType
+			}},
+			expStatus: http.StatusBadRequest,
+			expBody:   "bad request: unknown event type",
+		},
+		{
+			name:      "delete",
+			method:    http.MethodDelete,
+			url:       "/webhooks/1",
+			mock:      &MockWebhookManager{},
+			expStatus: http.StatusNoContent,
+		},
+		{
+			name:   "deliveries",
+			method: http.MethodGet,
+			url:    "/webhooks/1/deliveries",
+			mock: &MockWebhookManager{DeliveriesFunc: func(ctx context.Context, id uint64) ([]webhooks.Delivery, error) {
+				return []webhooks.Delivery{{ID: 3, WebhookID: id, EventSeq: 9, EventType: "note.created", Status: webhooks.DeliveryDelivered, Attempts: []webhooks.Attempt{}}}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `[{"id":3,"webhook_id":1,"event_seq":9,"event_type":"note.created","status":"delivered","attempts":[]}]`,
+		},
+		{
+			name:   "dead letters",
+			method: http.MethodGet,
+			url:    "/webhooks/dead-letters",
+			mock: &MockWebhookManager{DeadLettersFunc: func(ctx context.Context) ([]webhooks.Delivery, error) {
+				return []webhooks.Delivery{{ID: 4, WebhookID: 2, EventSeq: 5, EventType: "note.deleted", Status: webhooks.DeliveryFailed, Attempts: []webhooks.Attempt{}}}, nil
+			}},
+			expStatus: http.StatusOK,
+			expBody:   `[{"id":4,"webhook_id":2,"event_seq":5,"event_type":"note.deleted","status":"failed","attempts":[]}]`,
+		},
+		{
+			name:   "redeliver",
+			method: http.MethodPost,
+			url:    "/webhooks/2/deliveries/4/redeliver",
+			mock: &MockWebhookManager{RedeliverFunc: func(ctx context.Context, id uint64, deliveryID uint64) (webhooks.Delivery, error) {
+				return webhooks.Delivery{ID: deliveryID, WebhookID: id, EventSeq: 5, EventType: "note.deleted", Status: webhooks.DeliveryPending, Attempts: []webhooks.Attempt{}}, nil
+			}},
+			expStatus: http.StatusAccepted,
+			expBody:   `{"id":4,"webhook_id":2,"event_seq":5,"event_type":"note.deleted","status":"pending","attempts":[]}`,
+		},
+		{
+			name:   "redeliver pending",
+			method: http.MethodPost,
+			url:    "/webhooks/2/deliveries/4/redeliver",
+			mock: &MockWebhookManager{RedeliverFunc: func(ctx context.Context, id uint64, deliveryID uint64) (webhooks.Delivery, error) {
+				return webhooks.Delivery{}, webhooks.ErrDeliveryPending
+			}},
+			expStatus: http.StatusConflict,
+			expBody:   "delivery is still in progress",
+		},
+		{
+			name:      "delete dead letter",
+			method:    http.MethodDelete,
+			url:       "/webhooks/2/deliveries/4",
+			mock:      &MockWebhookManager{},
+			expStatus: http.StatusNoContent,
+		},
+		{
+			name:   "delete missing delivery",
+			method: http.MethodDelete,
+			url:    "/webhooks/2/deliveries/9",
+			mock: &MockWebhookManager{DeleteDeliveryFunc: func(ctx context.Context, id uint64, deliveryID uint64) error {
+				return webhooks.ErrDeliveryNotFound
+			}},
+			expStatus: http.StatusNotFound,
+			expBody:   "delivery not found",
+		},
+		{
+			name:      "redeliver wrong method",
+			method:    http.MethodGet,
+			url:       "/webhooks/2/deliveries/4/redeliver",
+			mock:      &MockWebhookManager{},
+			expStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:      "unknown sub-path",
+			method:    http.MethodGet,
+			url:       "/webhooks/1/events",
+			mock:      &MockWebhookManager{},
+			expStatus: http.StatusNotFound,
+			expBody:   "404 page not found",
+		},
+		{
+			name:      "invalid id",
+			method:    http.MethodGet,
+			url:       "/webhooks/abc",
+			mock:      &MockWebhookManager{},
+			expStatus: http.StatusBadRequest,
+			expBody:   "Invalid id in url",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			handler := NewWebhookHandler(testCase.mock)
+
+			req := httptest.NewRequest(testCase.method, testCase.url, strings.NewReader(testCase.req))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			handler.HandleWebhookByID().ServeHTTP(rec, req)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+
+			body := strings.TrimSpace(rec.Body.String())
+			if body != testCase.expBody {
+				t.Errorf("body: expected %v, got %v", testCase.expBody, body)
+			}
+		})
+	}
+}
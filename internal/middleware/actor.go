@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+const ActorHeader = "X-Actor"
+
+const maxActorLength = 128
+
+// ActorMiddleware passes the name from the X-Actor header down to the
+// repository, which records it in the revision history of changed notes.
+// Nothing checks the name: any holder of the tenant token may send any
+// X-Actor, so the recorded author is only what the client claims.
+func ActorMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := r.Header.Get(ActorHeader)
+		if actor == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(actor) > maxActorLength {
+			http.Error(w, "X-Actor must not be longer than 128 bytes", http.StatusBadRequest)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(repository.WithActor(r.Context(), actor)))
+	})
+}
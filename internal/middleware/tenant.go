@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+var ErrInvalidTenantToken error = errors.New("invalid tenant token")
+
+var tenantID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// TenantTokens maps bearer tokens to the tenants they belong to. Tokens are
+// kept as SHA-256 sums, so a lookup takes as long for any token.
+type TenantTokens map[[sha256.Size]byte]string
+
+// Add lets token act for tenant.
+func (tokens TenantTokens) Add(token string, tenant string) error {
+	if token == "" {
+		return fmt.Errorf("%w: token of tenant %q is empty", ErrInvalidTenantToken, tenant)
+	}
+	if !tenantID.MatchString(tenant) {
+		return fmt.Errorf("%w: tenant %q must be 1 to 64 letters, digits, '-' or '_'", ErrInvalidTenantToken, tenant)
+	}
+	sum := sha256.Sum256([]byte(token))
+	if _, ok := tokens[sum]; ok {
+		return fmt.Errorf("%w: token of tenant %q is used twice", ErrInvalidTenantToken, tenant)
+	}
+	tokens[sum] = tenant
+	return nil
+}
+
+// LoadTenantTokens reads a file with a "<tenant> <token>" pair on every line.
+// Blank lines and lines starting with '#' are skipped.
+func LoadTenantTokens(path string) (TenantTokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := make(TenantTokens)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: %s:%d: expected \"<tenant> <token>\"", ErrInvalidTenantToken, path, line)
+		}
+		if err := tokens.Add(fields[1], fields[0]); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// TenantMiddleware scopes the request to the tenant of the bearer token in
+// its Authorization header. Requests without a known token get 401.
+func TenantMiddleware(tokens TenantTokens) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			tenant, ok := tokens[sha256.Sum256([]byte(strings.TrimSpace(token)))]
+			if !strings.EqualFold(scheme, "Bearer") || !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "missing or unknown bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(repository.WithTenant(r.Context(), tenant)))
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+)
+
+type Agenda struct {
+	Overdue  []Note `json:"overdue"`
+	Today    []Note `json:"today"`
+	ThisWeek []Note `json:"this_week"`
+	Later    []Note `json:"later"`
+}
+
+// Agenda groups undone notes with a due date by how soon they are due. Days
+// and weeks (starting on Monday) are counted in loc.
+func (db *InMemoryDataBase) Agenda(ctx context.Context, loc *time.Location) (Agenda, error) {
+	select {
+	case <-ctx.Done():
+		return Agenda{}, ctx.Err()
+	default:
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	now := t.now().In(loc)
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, loc)
+	daysToMonday := (8 - int(now.Weekday())) % 7
+	if daysToMonday == 0 {
+		daysToMonday = 7
+	}
+	nextWeek := time.Date(now.Year(), now.Month(), now.Day()+daysToMonday, 0, 0, 0, 0, loc)
+
+	agenda := Agenda{
+		Overdue:  []Note{},
+		Today:    []Note{},
+		ThisWeek: []Note{},
+		Later:    []Note{},
+	}
+	p := t.presenter()
+	for _, n := range t.notes {
+		if n.DueAt == nil || n.Done {
+			continue
+		}
+
+		n = p.present(n)
+		switch due := *n.DueAt; {
+		case due.Before(now):
+			agenda.Overdue = append(agenda.Overdue, n)
+		case due.Before(tomorrow):
+			agenda.Today = append(agenda.Today, n)
+		case due.Before(nextWeek):
+			agenda.ThisWeek = append(agenda.ThisWeek, n)
+		default:
+			agenda.Later = append(agenda.Later, n)
+		}
+	}
+
+	for _, group := range [][]Note{agenda.Overdue, agenda.Today, agenda.ThisWeek, agenda.Later} {
+		slices.SortFunc(group, func(a, b Note) int {
+			if c := a.DueAt.Compare(*b.DueAt); c != 0 {
+				return c
+			}
+			return cmp.Compare(a.ID, b.ID)
+		})
+	}
+
+	return agenda, nil
+}
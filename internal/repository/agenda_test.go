@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestAgenda(t *testing.T) {
+	// Wednesday evening in UTC, already Thursday in Moscow.
+	now := time.Date(2025, 3, 12, 22, 0, 0, 0, time.UTC)
+	repo := NewInMemoryDataBase(WithClock(&fakeClock{now: now}))
+
+	dues := []*time.Time{
+		ptr(now.Add(-time.Hour)),
+		ptr(now.Add(90 * time.Minute)),
+		ptr(now.Add(12 * time.Hour)),
+		ptr(time.Date(2025, 3, 16, 20, 0, 0, 0, time.UTC)),
+		ptr(time.Date(2025, 3, 16, 22, 0, 0, 0, time.UTC)),
+		nil,
+	}
+	for _, due := range dues {
+		repo.Create(context.Background(), NoteDTO{Title: "title", DueAt: due})
+	}
+	repo.Create(context.Background(), NoteDTO{Title: "done", Done: true, DueAt: ptr(now.Add(-time.Hour))})
+
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skipf("time zone database is not available: %v", err)
+	}
+
+	testTable := []struct {
+		name        string
+		loc         *time.Location
+		expOverdue  []uint64
+		expToday    []uint64
+		expThisWeek []uint64
+		expLater    []uint64
+	}{
+		{
+			name:        "utc",
+			loc:         time.UTC,
+			expOverdue:  []uint64{1},
+			expToday:    []uint64{2},
+			expThisWeek: []uint64{3, 4, 5},
+			expLater:    []uint64{},
+		},
+		{
+			name:        "moscow",
+			loc:         moscow,
+			expOverdue:  []uint64{1},
+			expToday:    []uint64{2, 3},
+			expThisWeek: []uint64{4},
+			expLater:    []uint64{5},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			agenda, err := repo.Agenda(context.Background(), testCase.loc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			groups := []struct {
+				name  string
+				notes []Note
+				exp   []uint64
+			}{
+				{"overdue", agenda.Overdue, testCase.expOverdue},
+				{"today", agenda.Today, testCase.expToday},
+				{"this week", agenda.ThisWeek, testCase.expThisWeek},
+				{"later", agenda.Later, testCase.expLater},
+			}
+			for _, g := range groups {
+				ids := []uint64{}
+				for _, n := range g.notes {
+					ids = append(ids, n.ID)
+				}
+				if !slices.Equal(ids, g.exp) {
+					t.Errorf("%s: expected %v, got %v", g.name, g.exp, ids)
+				}
+			}
+
+			if len(agenda.Overdue) > 0 && !agenda.Overdue[0].Overdue {
+				t.Errorf("overdue note is not flagged")
+			}
+		})
+	}
+}
+
+func TestOverdue(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 3, 12, 12, 0, 0, 0, time.UTC)}
+	repo := NewInMemoryDataBase(WithClock(clock))
+
+	created, _ := repo.Create(context.Background(), NoteDTO{Title: "title", DueAt: ptr(clock.now.Add(time.Hour))})
+	if created.Overdue {
+		t.Errorf("note is overdue before its due date")
+	}
+
+	clock.Advance(2 * time.Hour)
+	note, _ := repo.GetByID(context.Background(), created.ID)
+	if !note.Overdue {
+		t.Errorf("note is not overdue after its due date")
+	}
+
+	page, _ := repo.List(context.Background(), ListQuery{Filters: []Filter{{Field: "due_at", Op: OpLt, Value: clock.now}}})
+	if len(page.Notes) != 1 || !page.Notes[0].Overdue {
+		t.Errorf("list: expected one overdue note, got %v", page.Notes)
+	}
+
+	done := true
+	note, _ = repo.Patch(context.Background(), created.ID, AnyVersion, NotePatch{Done: &done})
+	if note.Overdue {
+		t.Errorf("done note is overdue")
+	}
+
+	var noDue *time.Time
+	note, _ = repo.Patch(context.Background(), created.ID, AnyVersion, NotePatch{DueAt: &noDue})
+	if note.DueAt != nil {
+		t.Errorf("due date was not removed: %v", note.DueAt)
+	}
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrBatchRolledBack error = errors.New("batch rolled back")
+var ErrInvalidBatchOp error = errors.New("unknown batch operation")
+
+// BatchOpKind tells what a batch operation does.
+type BatchOpKind string
+
+const (
+	BatchCreate BatchOpKind = "create"
+	BatchUpdate BatchOpKind = "update"
+	BatchDelete BatchOpKind = "delete"
+)
+
+// BatchOp is one operation of a batch. ID and Version are used by updates and
+// deletes, Note by creates and updates, Children by deletes only. An empty
+// Children rejects deleting a note with subtasks.
+type BatchOp struct {
+	Op       BatchOpKind `json:"op"`
+	ID       uint64      `json:"id,omitempty"`
+	Version  uint64      `json:"version,omitempty"`
+	Note     NoteDTO     `json:"note"`
+	Children DeleteMode  `json:"children,omitempty"`
+}
+
+// BatchResult is the outcome of one batch operation. Note is empty for
+// deletes and failed operations.
+type BatchResult struct {
+	Note Note
+	Err  error
+}
+
+// Batch runs ops in order, each one seeing the effects of those before it.
+//
+// If atomic is set, either all operations are committed as one log record or
+// none is: on the first failure every change of the batch is undone, the
+// failing operation keeps its error, the others get ErrBatchRolledBack, and
+// the returned error wraps both. Otherwise every operation is committed on its
+// own and a failure does not stop the rest.
+func (db *InMemoryDataBase) Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+	results := make([]BatchResult, len(ops))
+
+	if !atomic {
+		for i, op := range ops {
+			e, err := t.batchEntry(ctx, op)
+			if err == nil {
+				err = db.commit(ctx, t, e)
+			}
+			results[i] = t.batchResult(op, e, err)
+		}
+		return results, nil
+	}
+
+	tx := db.begin(t)
+	for i, op := range ops {
+		e, err := t.batchEntry(ctx, op)
+		if err != nil {
+			tx.rollback()
+			for j := range results {
+				results[j] = BatchResult{Err: ErrBatchRolledBack}
+			}
+			results[i].Err = err
+			return results, fmt.Errorf("%w: operation %d: %w", ErrBatchRolledBack, i, err)
+		}
+		tx.stage(ctx, e)
+		results[i] = t.batchResult(op, e, nil)
+	}
+
+	if err := tx.commit(ctx); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// batchEntry returns the log entry that carries out op. Callers must hold
+// db.mu.
+func (t *tenant) batchEntry(ctx context.Context, op BatchOp) (logEntry, error) {
+	switch op.Op {
+	case BatchCreate:
+		return t.createEntry(ctx, op.Note)
+	case BatchUpdate:
+		return t.modifyEntry(ctx, op.ID, op.Version, replaceWith(op.Note))
+	case BatchDelete:
+		mode := op.Children
+		if mode == "" {
+			mode = DeleteReject
+		}
+		return t.deleteEntry(op.ID, op.Version, mode)
+	default:
+		return logEntry{}, ErrInvalidBatchOp
+	}
+}
+
+// batchResult describes the outcome of op once e has been applied. Callers
+// must hold db.mu.
+func (t *tenant) batchResult(op BatchOp, e logEntry, err error) BatchResult {
+	if err != nil || op.Op == BatchDelete {
+		return BatchResult{Err: err}
+	}
+	return BatchResult{Note: t.present(e.Put[0])}
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func titles(notes []Note) []string {
+	res := make([]string, len(notes))
+	for i, n := range notes {
+		res[i] = n.Title
+	}
+	return res
+}
+
+func TestBatchAtomic(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	ctx := context.Background()
+
+	a, _ := repo.Create(ctx, NoteDTO{Title: "a"})
+	repo.Create(ctx, NoteDTO{Title: "b"})
+
+	ops := []BatchOp{
+		{Op: BatchCreate, Note: NoteDTO{Title: "c", Tags: []string{"new"}}},
+		{Op: BatchUpdate, ID: a.ID, Note: NoteDTO{Title: "a2"}},
+		{Op: BatchDelete, ID: 2},
+		{Op: BatchUpdate, ID: a.ID, Version: 1, Note: NoteDTO{Title: "a3"}},
+	}
+	results, err := repo.Batch(ctx, ops, true)
+	if !errors.Is(err, ErrBatchRolledBack) || !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("error: expected %v and %v, got %v", ErrBatchRolledBack, ErrVersionMismatch, err)
+	}
+	for i, result := range results[:3] {
+		if !errors.Is(result.Err, ErrBatchRolledBack) {
+			t.Errorf("result %d: expected %v, got %v", i, ErrBatchRolledBack, result.Err)
+		}
+	}
+	if !errors.Is(results[3].Err, ErrVersionMismatch) {
+		t.Errorf("result 3: expected %v, got %v", ErrVersionMismatch, results[3].Err)
+	}
+
+	notes, _ := repo.GetAll(ctx)
+	if got := titles(notes); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("notes after rollback: expected [a b], got %v", got)
+	}
+	if tags, _ := repo.ListTags(ctx); len(tags) != 0 {
+		t.Errorf("tags after rollback: expected none, got %v", tags)
+	}
+	if trash, _ := repo.Trash(ctx); len(trash) != 0 {
+		t.Errorf("trash after rollback: expected empty, got %v", trash)
+	}
+
+	results, err = repo.Batch(ctx, ops[:3], true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[0].Note.ID != 3 || results[1].Note.Version != 2 {
+		t.Errorf("results: expected note 3 and version 2, got %+v", results)
+	}
+	notes, _ = repo.GetAll(ctx)
+	if got := titles(notes); !slices.Equal(got, []string{"a2", "c"}) {
+		t.Errorf("notes after batch: expected [a2 c], got %v", got)
+	}
+}
+
+func TestBatchContinue(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	ctx := context.Background()
+
+	ops := []BatchOp{
+		{Op: BatchCreate, Note: NoteDTO{Title: "a"}},
+		{Op: BatchCreate, Note: NoteDTO{}},
+		{Op: BatchDelete, ID: 42},
+		{Op: BatchUpdate, ID: 1, Note: NoteDTO{Title: "a2"}},
+	}
+	results, err := repo.Batch(ctx, ops, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []error{nil, ErrTitleNotDefined, ErrNotFoundID, nil}
+	for i, result := range results {
+		if !errors.Is(result.Err, expected[i]) {
+			t.Errorf("result %d: expected %v, got %v", i, expected[i], result.Err)
+		}
+	}
+	if note, _ := repo.GetByID(ctx, 1); note.Title != "a2" {
+		t.Errorf("note 1: expected a2, got %q", note.Title)
+	}
+}
+
+func TestBatchSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	repo, err := OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parent := uint64(1)
+	repo.Batch(ctx, []BatchOp{
+		{Op: BatchCreate, Note: NoteDTO{Title: "parent"}},
+		{Op: BatchCreate, Note: NoteDTO{Title: "child", ParentID: &parent}},
+	}, true)
+	repo.Batch(ctx, []BatchOp{
+		{Op: BatchCreate, Note: NoteDTO{Title: "lost"}},
+		{Op: BatchDelete, ID: 1},
+	}, true)
+	repo.Close()
+
+	repo, err = OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer repo.Close()
+
+	notes, _ := repo.GetAll(ctx)
+	if got := titles(notes); !slices.Equal(got, []string{"parent", "child"}) {
+		t.Errorf("notes: expected [parent child], got %v", got)
+	}
+	if note, _ := repo.Create(ctx, NoteDTO{Title: "next"}); note.ID != 3 {
+		t.Errorf("next ID: expected 3, got %d", note.ID)
+	}
+}
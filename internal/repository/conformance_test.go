@@ -0,0 +1,25 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+	"github.com/fwhyjke/golang_test/internal/repository/repotest"
+)
+
+func TestInMemoryTenantIsolation(t *testing.T) {
+	repotest.TestTenantIsolation(t, func(t *testing.T) repository.NoteRepository {
+		return repository.NewInMemoryDataBase()
+	})
+}
+
+func TestPersistentTenantIsolation(t *testing.T) {
+	repotest.TestTenantIsolation(t, func(t *testing.T) repository.NoteRepository {
+		repo, err := repository.OpenInMemoryDataBase(t.TempDir())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t.Cleanup(func() { repo.Close() })
+		return repo
+	})
+}
@@ -0,0 +1,174 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+var ErrBlockerNotFound error = errors.New("blocking note not found")
+var ErrDependencyCycle error = errors.New("dependency would create a cycle")
+var ErrBlocked error = errors.New("note is blocked by unfinished notes")
+
+type forceKey struct{}
+
+// WithForce marks ctx so that a blocked note can still be marked as done.
+func WithForce(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceKey{}, true)
+}
+
+// Forced reports whether ctx was marked with WithForce.
+func Forced(ctx context.Context) bool {
+	force, _ := ctx.Value(forceKey{}).(bool)
+	return force
+}
+
+// blocked reports whether any blocker of n is not done. Callers must hold
+// db.mu.
+func (t *tenant) blocked(n Note) bool {
+	for _, b := range n.BlockedBy {
+		if !t.notes[b].Done {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBlockers normalizes the blockers of note id and makes sure they exist
+// and do not depend on id themselves. Callers must hold db.mu.
+func (t *tenant) checkBlockers(id uint64, blockers []uint64) ([]uint64, error) {
+	if len(blockers) == 0 {
+		return nil, nil
+	}
+
+	blockers = slices.Clone(blockers)
+	slices.Sort(blockers)
+	blockers = slices.Compact(blockers)
+
+	for _, b := range blockers {
+		if b == id {
+			return nil, ErrDependencyCycle
+		}
+		if _, ok := t.notes[b]; !ok {
+			return nil, ErrBlockerNotFound
+		}
+		if t.dependsOn(b, id, make(map[uint64]bool)) {
+			return nil, ErrDependencyCycle
+		}
+	}
+	return blockers, nil
+}
+
+func (t *tenant) dependsOn(from, to uint64, seen map[uint64]bool) bool {
+	if seen[from] {
+		return false
+	}
+	seen[from] = true
+
+	for _, b := range t.notes[from].BlockedBy {
+		if b == to || t.dependsOn(b, to, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// detachDependents drops deleted notes from the blockers of the notes that
+// stay. Callers must hold db.mu.
+func (t *tenant) detachDependents(e *logEntry, now time.Time) {
+	for _, id := range e.Delete {
+		for dependent := range t.blocks[id] {
+			if slices.Contains(e.Delete, dependent) {
+				continue
+			}
+
+			i := slices.IndexFunc(e.Put, func(n Note) bool { return n.ID == dependent })
+			if i < 0 {
+				n := t.notes[dependent]
+				n.Version++
+				n.UpdatedAt = now
+				e.Put = append(e.Put, n)
+				i = len(e.Put) - 1
+			}
+			e.Put[i].BlockedBy = slices.DeleteFunc(slices.Clone(e.Put[i].BlockedBy), func(b uint64) bool { return b == id })
+		}
+	}
+	slices.SortFunc(e.Put, func(a, b Note) int { return cmp.Compare(a.ID, b.ID) })
+}
+
+// ExecutionOrder returns unfinished notes so that every note comes after the
+// notes blocking it. Notes that are free to go at the same time are ordered
+// by ID.
+func (db *InMemoryDataBase) ExecutionOrder(ctx context.Context) ([]Note, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	pending := make(map[uint64]int)
+	var ready []uint64
+	for _, n := range t.sortedNotes() {
+		if n.Done {
+			continue
+		}
+		for _, b := range n.BlockedBy {
+			if !t.notes[b].Done {
+				pending[n.ID]++
+			}
+		}
+		if pending[n.ID] == 0 {
+			ready = append(ready, n.ID)
+		}
+	}
+
+	p := t.presenter()
+	res := []Note{}
+	for len(ready) > 0 {
+		id := ready[0]
+		ready = ready[1:]
+		res = append(res, p.present(t.notes[id]))
+
+		for dependent := range t.blocks[id] {
+			if t.notes[dependent].Done {
+				continue
+			}
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				i, _ := slices.BinarySearch(ready, dependent)
+				ready = slices.Insert(ready, i, dependent)
+			}
+		}
+	}
+	return res, nil
+}
+
+// Unblocked returns unfinished notes whose blockers are all done.
+func (db *InMemoryDataBase) Unblocked(ctx context.Context) ([]Note, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	p := t.presenter()
+	res := []Note{}
+	for _, n := range t.sortedNotes() {
+		if !n.Done && !t.blocked(n) {
+			res = append(res, p.present(n))
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// newDependencies creates notes 1..5 where 3 is blocked by 1 and 2, and 4 is
+// blocked by 3.
+func newDependencies(t *testing.T) *InMemoryDataBase {
+	t.Helper()
+
+	repo := NewInMemoryDataBase()
+	repo.Create(context.Background(), NoteDTO{Title: "t1"})
+	repo.Create(context.Background(), NoteDTO{Title: "t2"})
+	repo.Create(context.Background(), NoteDTO{Title: "t3", BlockedBy: []uint64{2, 1, 2}})
+	repo.Create(context.Background(), NoteDTO{Title: "t4", BlockedBy: []uint64{3}})
+	repo.Create(context.Background(), NoteDTO{Title: "t5"})
+	return repo
+}
+
+func TestBlockedBy(t *testing.T) {
+	done := true
+
+	testTable := []struct {
+		name   string
+		ctx    context.Context
+		id     uint64
+		patch  NotePatch
+		expErr error
+	}{
+		{
+			name:   "done while blocked",
+			ctx:    context.Background(),
+			id:     3,
+			patch:  NotePatch{Done: &done},
+			expErr: ErrBlocked,
+		},
+		{
+			name:  "forced done while blocked",
+			ctx:   WithForce(context.Background()),
+			id:    3,
+			patch: NotePatch{Done: &done},
+		},
+		{
+			name:  "done when not blocked",
+			ctx:   context.Background(),
+			id:    1,
+			patch: NotePatch{Done: &done},
+		},
+		{
+			name:   "blocked by itself",
+			ctx:    context.Background(),
+			id:     1,
+			patch:  NotePatch{BlockedBy: &[]uint64{1}},
+			expErr: ErrDependencyCycle,
+		},
+		{
+			name:   "cycle",
+			ctx:    context.Background(),
+			id:     1,
+			patch:  NotePatch{BlockedBy: &[]uint64{4}},
+			expErr: ErrDependencyCycle,
+		},
+		{
+			name:   "missing blocker",
+			ctx:    context.Background(),
+			id:     1,
+			patch:  NotePatch{BlockedBy: &[]uint64{42}},
+			expErr: ErrBlockerNotFound,
+		},
+		{
+			name:  "diamond is not a cycle",
+			ctx:   context.Background(),
+			id:    4,
+			patch: NotePatch{BlockedBy: &[]uint64{1, 3}},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := newDependencies(t)
+
+			_, err := repo.Patch(testCase.ctx, testCase.id, AnyVersion, testCase.patch)
+			if !errors.Is(err, testCase.expErr) {
+				t.Errorf("error: expected %v, got %v", testCase.expErr, err)
+			}
+		})
+	}
+
+	repo := newDependencies(t)
+	note, _ := repo.GetByID(context.Background(), 3)
+	if !slices.Equal(note.BlockedBy, []uint64{1, 2}) || !note.Blocked {
+		t.Errorf("note: expected blocked by [1 2], got %+v", note)
+	}
+	if _, err := repo.Create(context.Background(), NoteDTO{Title: "t", Done: true, BlockedBy: []uint64{1}}); !errors.Is(err, ErrBlocked) {
+		t.Errorf("create: expected %v, got %v", ErrBlocked, err)
+	}
+}
+
+func TestExecutionOrder(t *testing.T) {
+	repo := newDependencies(t)
+	repo.Patch(context.Background(), 1, AnyVersion, NotePatch{BlockedBy: &[]uint64{5}})
+
+	order, err := repo.ExecutionOrder(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := noteIDs(order); !slices.Equal(ids, []uint64{2, 5, 1, 3, 4}) {
+		t.Errorf("order: expected [2 5 1 3 4], got %v", ids)
+	}
+
+	unblocked, _ := repo.Unblocked(context.Background())
+	if ids := noteIDs(unblocked); !slices.Equal(ids, []uint64{2, 5}) {
+		t.Errorf("unblocked: expected [2 5], got %v", ids)
+	}
+
+	done := true
+	repo.Patch(context.Background(), 5, AnyVersion, NotePatch{Done: &done})
+	repo.Patch(context.Background(), 1, AnyVersion, NotePatch{Done: &done})
+
+	order, _ = repo.ExecutionOrder(context.Background())
+	if ids := noteIDs(order); !slices.Equal(ids, []uint64{2, 3, 4}) {
+		t.Errorf("order after done: expected [2 3 4], got %v", ids)
+	}
+	unblocked, _ = repo.Unblocked(context.Background())
+	if ids := noteIDs(unblocked); !slices.Equal(ids, []uint64{2}) {
+		t.Errorf("unblocked after done: expected [2], got %v", ids)
+	}
+}
+
+func TestDeleteBlocker(t *testing.T) {
+	repo := newDependencies(t)
+
+	if err := repo.Delete(context.Background(), 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	note, _ := repo.GetByID(context.Background(), 3)
+	if !slices.Equal(note.BlockedBy, []uint64{2}) || note.Version != 2 {
+		t.Errorf("note: expected blocked by [2] in version 2, got %+v", note)
+	}
+}
@@ -0,0 +1,107 @@
+package repository
+
+import "time"
+
+// EventType tells how a note changed.
+type EventType string
+
+const (
+	// NoteCreated is sent when a note appears: it is created, or restored
+	// from the trash. Before is nil.
+	NoteCreated EventType = "note.created"
+	// NoteUpdated is sent when a note changes. Both Before and After are set.
+	NoteUpdated EventType = "note.updated"
+	// NoteDeleted is sent when a note is moved to the trash. After is nil.
+	NoteDeleted EventType = "note.deleted"
+)
+
+// Event describes the change of one note. Seq is set by the publisher and
+// grows by one with every event it sends.
+type Event struct {
+	Seq    uint64    `json:"seq"`
+	Type   EventType `json:"type"`
+	Tenant string    `json:"tenant"`
+	Actor  string    `json:"actor,omitempty"`
+	At     time.Time `json:"at"`
+	NoteID uint64    `json:"note_id"`
+	Before *Note     `json:"before,omitempty"`
+	After  *Note     `json:"after,omitempty"`
+}
+
+// Publisher receives the events of every committed change, in commit order.
+// Publish is called with the database lock held and must not block.
+type Publisher interface {
+	Publish(events ...Event)
+}
+
+// WithPublisher makes the database send the events of every committed change
+// to p. Changes rolled back by a transaction or a batch are never published.
+func WithPublisher(p Publisher) Option {
+	return func(db *InMemoryDataBase) {
+		db.publisher = p
+	}
+}
+
+// track remembers the notes that e is about to change. The returned function,
+// called once e has been applied to t, tells what the change looks like.
+// Callers must hold db.mu.
+func (t *tenant) track(e logEntry) func() []Event {
+	var ids []uint64
+	for _, n := range e.Put {
+		ids = append(ids, n.ID)
+	}
+	for _, n := range e.Trash {
+		ids = append(ids, n.ID)
+	}
+	ids = append(ids, e.Delete...)
+
+	p := t.presenter()
+	before := make(map[uint64]Note, len(ids))
+	for _, id := range ids {
+		if n, ok := t.notes[id]; ok {
+			before[id] = p.present(n)
+		}
+	}
+
+	return func() []Event {
+		var events []Event
+		p := t.presenter()
+		seen := make(map[uint64]bool, len(ids))
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			ev := Event{Tenant: t.id, Actor: e.Actor, At: t.now(), NoteID: id}
+			if n, ok := before[id]; ok {
+				ev.Before = &n
+			}
+			if n, ok := t.notes[id]; ok {
+				n = p.present(n)
+				ev.After = &n
+			}
+			switch {
+			case ev.Before == nil && ev.After != nil:
+				ev.Type = NoteCreated
+			case ev.Before != nil && ev.After != nil:
+				ev.Type = NoteUpdated
+			case ev.Before != nil:
+				ev.Type = NoteDeleted
+			default:
+				continue
+			}
+			events = append(events, ev)
+		}
+		return events
+	}
+}
+
+// publish sends events to the publisher, if there is one. Callers must hold
+// db.mu.
+func (db *InMemoryDataBase) publish(events []Event) {
+	if db.publisher == nil || len(events) == 0 {
+		return
+	}
+	db.publisher.Publish(events...)
+}
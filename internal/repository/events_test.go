@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+type recorder struct {
+	events []Event
+}
+
+func (r *recorder) Publish(events ...Event) {
+	r.events = append(r.events, events...)
+}
+
+// take returns the recorded events as "type id" pairs and forgets them.
+func (r *recorder) take() []string {
+	var res []string
+	for _, ev := range r.events {
+		res = append(res, fmt.Sprintf("%s %d", ev.Type, ev.NoteID))
+	}
+	r.events = nil
+	return res
+}
+
+func TestEvents(t *testing.T) {
+	rec := &recorder{}
+	repo := NewInMemoryDataBase(WithPublisher(rec))
+	alice := WithActor(WithTenant(context.Background(), "acme"), "alice")
+	ctx := WithTenant(context.Background(), "acme")
+
+	repo.Create(alice, NoteDTO{Title: "a"})
+	if len(rec.events) != 1 {
+		t.Fatalf("create: expected 1 event, got %d", len(rec.events))
+	}
+	ev := rec.events[0]
+	if ev.Type != NoteCreated || ev.Tenant != "acme" || ev.Actor != "alice" || ev.Before != nil || ev.After.Title != "a" {
+		t.Errorf("create: unexpected event %+v", ev)
+	}
+	rec.take()
+
+	parent := uint64(1)
+	repo.Create(ctx, NoteDTO{Title: "b", ParentID: &parent})
+	repo.Update(ctx, 1, NoteDTO{Title: "a2"})
+	if got := rec.take(); !slices.Equal(got, []string{"note.created 2", "note.updated 1"}) {
+		t.Errorf("create and update: unexpected events %v", got)
+	}
+
+	repo.DeleteWithChildren(ctx, 1, AnyVersion, DeleteCascade)
+	if len(rec.events) == 2 && (rec.events[0].Before.Title != "a2" || rec.events[0].After != nil) {
+		t.Errorf("delete: unexpected event %+v", rec.events[0])
+	}
+	if got := rec.take(); !slices.Equal(got, []string{"note.deleted 1", "note.deleted 2"}) {
+		t.Errorf("delete: unexpected events %v", got)
+	}
+
+	repo.Restore(ctx, 1)
+	if got := rec.take(); !slices.Equal(got, []string{"note.created 1", "note.created 2"}) {
+		t.Errorf("restore: unexpected events %v", got)
+	}
+
+	repo.WithTx(ctx, func(tx NoteTx) error {
+		tx.Create(ctx, NoteDTO{Title: "lost"})
+		return errors.New("stop")
+	})
+	repo.Batch(ctx, []BatchOp{{Op: BatchCreate, Note: NoteDTO{Title: "lost"}}, {Op: BatchDelete, ID: 9}}, true)
+	if got := rec.take(); len(got) != 0 {
+		t.Errorf("rollback: expected no events, got %v", got)
+	}
+
+	repo.Batch(ctx, []BatchOp{{Op: BatchCreate, Note: NoteDTO{Title: "c"}}, {Op: BatchDelete, ID: 2}}, true)
+	if got := rec.take(); !slices.Equal(got, []string{"note.created 3", "note.deleted 2"}) {
+		t.Errorf("batch: unexpected events %v", got)
+	}
+}
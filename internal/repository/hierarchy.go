@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrParentNotFound error = errors.New("parent note not found")
+var ErrParentCycle error = errors.New("note cannot be nested under itself or its descendants")
+var ErrHasChildren error = errors.New("note has subtasks")
+
+// DeleteMode tells what happens to the subtasks of a deleted note.
+type DeleteMode string
+
+const (
+	// DeleteReject refuses to delete a note that has subtasks.
+	DeleteReject DeleteMode = "reject"
+	// DeleteCascade deletes the note together with all its descendants.
+	DeleteCascade DeleteMode = "cascade"
+	// DeleteOrphan deletes the note and turns its children into top-level notes.
+	DeleteOrphan DeleteMode = "orphan"
+)
+
+// Progress counts the descendants of a note and how many of them are done.
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+type NoteTree struct {
+	Note
+	Children []NoteTree `json:"children"`
+}
+
+// childIDs returns the IDs of direct children in ascending order. Callers
+// must hold db.mu.
+func (t *tenant) childIDs(id uint64) []uint64 {
+	return t.children.sorted(id)
+}
+
+// descendants returns the IDs of all notes below id, parents before their
+// children. Callers must hold db.mu.
+func (t *tenant) descendants(id uint64) []uint64 {
+	var res []uint64
+	for _, child := range t.childIDs(id) {
+		res = append(res, child)
+		res = append(res, t.descendants(child)...)
+	}
+	return res
+}
+
+// progress counts the descendants of id in one pass over its subtree. The
+// counts of every subtree visited are kept in p, so notes presented together
+// share them instead of walking the same subtrees again. Callers must hold
+// db.mu.
+func (p *presenter) progress(id uint64) Progress {
+	if res, ok := p.counts[id]; ok {
+		return res
+	}
+
+	var res Progress
+	for child := range p.t.children[id] {
+		sub := p.progress(child)
+		res.Total += 1 + sub.Total
+		res.Done += sub.Done
+		if p.t.notes[child].Done {
+			res.Done++
+		}
+	}
+	p.counts[id] = res
+	return res
+}
+
+// checkParent makes sure that id can be nested under parent. Callers must
+// hold db.mu.
+func (t *tenant) checkParent(id uint64, parent *uint64) error {
+	if parent == nil {
+		return nil
+	}
+
+	for p := parent; p != nil; p = t.notes[*p].ParentID {
+		if *p == id {
+			return ErrParentCycle
+		}
+		if _, ok := t.notes[*p]; !ok {
+			return ErrParentNotFound
+		}
+	}
+	return nil
+}
+
+func (db *InMemoryDataBase) Children(ctx context.Context, id uint64) ([]Note, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.notes[id]; !ok {
+		return nil, ErrNotFoundID
+	}
+
+	p := t.presenter()
+	res := []Note{}
+	for _, child := range t.childIDs(id) {
+		res = append(res, p.present(t.notes[child]))
+	}
+	return res, nil
+}
+
+func (db *InMemoryDataBase) Tree(ctx context.Context, id uint64) (NoteTree, error) {
+	select {
+	case <-ctx.Done():
+		return NoteTree{}, ctx.Err()
+	default:
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.notes[id]; !ok {
+		return NoteTree{}, ErrNotFoundID
+	}
+	return t.presenter().tree(id), nil
+}
+
+func (p *presenter) tree(id uint64) NoteTree {
+	node := NoteTree{Note: p.present(p.t.notes[id]), Children: []NoteTree{}}
+	for _, child := range p.t.childIDs(id) {
+		node.Children = append(node.Children, p.tree(child))
+	}
+	return node
+}
+
+// DeleteWithChildren moves a note to the trash and handles its subtasks
+// according to mode in one atomic change.
+func (db *InMemoryDataBase) DeleteWithChildren(ctx context.Context, id uint64, version uint64, mode DeleteMode) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	e, err := t.deleteEntry(id, version, mode)
+	if err != nil {
+		return err
+	}
+	return db.commit(ctx, t, e)
+}
+
+// deleteEntry returns the log entry that moves a note to the trash and
+// handles its subtasks according to mode. Callers must hold db.mu.
+func (t *tenant) deleteEntry(id uint64, version uint64, mode DeleteMode) (logEntry, error) {
+	n, ok := t.notes[id]
+	if !ok {
+		return logEntry{}, ErrNotFoundID
+	}
+	if version != AnyVersion && n.Version != version {
+		return logEntry{}, ErrVersionMismatch
+	}
+
+	now := t.now()
+	e := logEntry{IDGen: t.idGen.Load(), Delete: []uint64{id}}
+	switch mode {
+	case DeleteCascade:
+		e.Delete = append(e.Delete, t.descendants(id)...)
+	case DeleteOrphan:
+		for _, child := range t.childIDs(id) {
+			c := t.notes[child]
+			c.ParentID = nil
+			c.Version++
+			c.UpdatedAt = now
+			e.Put = append(e.Put, c)
+		}
+	default:
+		if len(t.children[id]) > 0 {
+			return logEntry{}, ErrHasChildren
+		}
+	}
+	t.detachDependents(&e, now)
+	t.moveToTrash(&e, now)
+	return e, nil
+}
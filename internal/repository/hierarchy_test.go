@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// newTree creates 1 -> 2 -> 3 and 1 -> 4, with 3 done.
+func newTree(t *testing.T) *InMemoryDataBase {
+	t.Helper()
+
+	repo := NewInMemoryDataBase()
+	root, _ := repo.Create(context.Background(), NoteDTO{Title: "root"})
+	child, _ := repo.Create(context.Background(), NoteDTO{Title: "child", ParentID: &root.ID})
+	repo.Create(context.Background(), NoteDTO{Title: "grandchild", Done: true, ParentID: &child.ID})
+	repo.Create(context.Background(), NoteDTO{Title: "second child", ParentID: &root.ID})
+	return repo
+}
+
+func TestTree(t *testing.T) {
+	repo := newTree(t)
+
+	children, err := repo.Children(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := noteIDs(children); !slices.Equal(ids, []uint64{2, 4}) {
+		t.Errorf("children: expected [2 4], got %v", ids)
+	}
+
+	tree, err := repo.Tree(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tree.Children) != 2 || tree.Children[0].ID != 2 || len(tree.Children[0].Children) != 1 || tree.Children[0].Children[0].ID != 3 {
+		t.Errorf("tree: unexpected shape %+v", tree)
+	}
+	if p := tree.Progress; p == nil || *p != (Progress{Done: 1, Total: 3}) {
+		t.Errorf("progress: expected 1 of 3, got %+v", p)
+	}
+	if p := tree.Children[1].Progress; p != nil {
+		t.Errorf("progress: leaf note has progress %+v", p)
+	}
+
+	if _, err := repo.Tree(context.Background(), 42); !errors.Is(err, ErrNotFoundID) {
+		t.Errorf("missing note: expected %v, got %v", ErrNotFoundID, err)
+	}
+}
+
+func TestProgressOfChain(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	ctx := context.Background()
+
+	// A chain of 3000 notes, every other one done, each nested in the last.
+	const depth = 3000
+	var parent *uint64
+	for i := range depth {
+		n, err := repo.Create(ctx, NoteDTO{Title: "step", Done: i%2 == 1, ParentID: parent})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		parent = &n.ID
+	}
+
+	notes, err := repo.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, n := range notes {
+		below := depth - 1 - i
+		if below == 0 {
+			if n.Progress != nil {
+				t.Errorf("leaf: expected no progress, got %+v", n.Progress)
+			}
+			continue
+		}
+		exp := Progress{Done: below / 2, Total: below}
+		if i%2 == 0 {
+			exp.Done = (below + 1) / 2
+		}
+		if n.Progress == nil || *n.Progress != exp {
+			t.Fatalf("note %d: expected %+v, got %+v", n.ID, exp, n.Progress)
+		}
+	}
+}
+
+func TestReparent(t *testing.T) {
+	testTable := []struct {
+		name   string
+		id     uint64
+		parent uint64
+		expErr error
+	}{
+		{name: "itself", id: 2, parent: 2, expErr: ErrParentCycle},
+		{name: "under own descendant", id: 1, parent: 3, expErr: ErrParentCycle},
+		{name: "missing parent", id: 2, parent: 42, expErr: ErrParentNotFound},
+		{name: "under sibling", id: 2, parent: 4},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := newTree(t)
+
+			parent := &testCase.parent
+			_, err := repo.Patch(context.Background(), testCase.id, AnyVersion, NotePatch{ParentID: &parent})
+			if !errors.Is(err, testCase.expErr) {
+				t.Fatalf("error: expected %v, got %v", testCase.expErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			children, _ := repo.Children(context.Background(), testCase.parent)
+			if !slices.Contains(noteIDs(children), testCase.id) {
+				t.Errorf("children of %d: expected %d, got %v", testCase.parent, testCase.id, noteIDs(children))
+			}
+		})
+	}
+
+	repo := newTree(t)
+	missing := uint64(42)
+	if _, err := repo.Create(context.Background(), NoteDTO{Title: "t", ParentID: &missing}); !errors.Is(err, ErrParentNotFound) {
+		t.Errorf("create: expected %v, got %v", ErrParentNotFound, err)
+	}
+}
+
+func TestDeleteWithChildren(t *testing.T) {
+	testTable := []struct {
+		name      string
+		mode      DeleteMode
+		expErr    error
+		expIDs    []uint64
+		expParent map[uint64]bool
+	}{
+		{
+			name:   "reject",
+			mode:   DeleteReject,
+			expErr: ErrHasChildren,
+			expIDs: []uint64{1, 2, 3, 4},
+		},
+		{
+			name:   "cascade",
+			mode:   DeleteCascade,
+			expIDs: []uint64{},
+		},
+		{
+			name:      "orphan",
+			mode:      DeleteOrphan,
+			expIDs:    []uint64{2, 3, 4},
+			expParent: map[uint64]bool{2: false, 3: true, 4: false},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := newTree(t)
+
+			err := repo.DeleteWithChildren(context.Background(), 1, AnyVersion, testCase.mode)
+			if !errors.Is(err, testCase.expErr) {
+				t.Fatalf("error: expected %v, got %v", testCase.expErr, err)
+			}
+
+			notes, _ := repo.GetAll(context.Background())
+			if ids := noteIDs(notes); !slices.Equal(ids, testCase.expIDs) {
+				t.Errorf("ids: expected %v, got %v", testCase.expIDs, ids)
+			}
+			for _, n := range notes {
+				if exp, ok := testCase.expParent[n.ID]; ok && (n.ParentID != nil) != exp {
+					t.Errorf("note %d: expected parent %v, got %v", n.ID, exp, n.ParentID)
+				}
+			}
+		})
+	}
+
+	repo := newTree(t)
+	if err := repo.Delete(context.Background(), 3); err != nil {
+		t.Errorf("leaf: unexpected error: %v", err)
+	}
+	if err := repo.Delete(context.Background(), 2); err != nil {
+		t.Errorf("emptied parent: unexpected error: %v", err)
+	}
+}
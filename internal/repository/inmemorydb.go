@@ -1,41 +1,229 @@
 package repository
 
 import (
+	"cmp"
 	"context"
+	"fmt"
+	"slices"
 	"sync"
-	"sync/atomic"
+	"time"
 )
 
+// InMemoryDataBase keeps a separate set of notes, tags and lists for every
+// tenant. All tenants share one lock and one write-ahead log.
 type InMemoryDataBase struct {
-	mu    sync.RWMutex
-	notes map[uint64]Note
-	idGen atomic.Uint64
+	mu      sync.RWMutex
+	tenants map[string]*tenant
+	log     *writeAheadLog
+	dir     string
+	clock   Clock
+
+	revisionLimit int
+	publisher     Publisher
 }
 
-func NewInMemoryDataBase() *InMemoryDataBase {
-	return &InMemoryDataBase{
-		notes: make(map[uint64]Note),
+type Option func(db *InMemoryDataBase)
+
+// WithClock replaces the wall clock used for note timestamps.
+func WithClock(clock Clock) Option {
+	return func(db *InMemoryDataBase) {
+		db.clock = clock
 	}
 }
 
-func (db *InMemoryDataBase) Delete(ctx context.Context, id uint64) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+func NewInMemoryDataBase(opts ...Option) *InMemoryDataBase {
+	db := &InMemoryDataBase{
+		tenants: make(map[string]*tenant),
+		clock:   systemClock{},
+
+		revisionLimit: DefaultRevisionLimit,
+	}
+	for _, opt := range opts {
+		opt(db)
+	}
+	return db
+}
+
+// OpenInMemoryDataBase restores the database from the latest snapshot and the
+// write-ahead log in dir and keeps appending every change to the log.
+func OpenInMemoryDataBase(dir string, opts ...Option) (*InMemoryDataBase, error) {
+	db := NewInMemoryDataBase(opts...)
+
+	wal, entries, err := openLog(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	snap, ok, err := loadSnapshot(dir)
+	if err != nil {
+		wal.close()
+		return nil, err
+	}
+	if ok {
+		db.restore(snap.tenantSnapshot)
+		for _, ts := range snap.Tenants {
+			db.restore(ts)
+		}
+	}
+
+	next := snap.Seq + 1
+	for _, e := range entries {
+		if e.Seq < next {
+			continue
+		}
+		if e.Seq != next {
+			wal.close()
+			return nil, fmt.Errorf("%w: entry %d is missing", ErrCorruptLog, next)
+		}
+		db.apply(e)
+		next++
 	}
 
+	wal.seq = max(wal.seq, snap.Seq)
+	db.log = wal
+	db.dir = dir
+
+	return db, nil
+}
+
+func (db *InMemoryDataBase) Close() error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	if _, ok := db.notes[id]; !ok {
-		return ErrNotFoundID
+	if db.log == nil {
+		return nil
+	}
+
+	err := db.log.close()
+	db.log = nil
+	return err
+}
+
+// label marks e as a change of tenant t made by the actor of ctx, and makes
+// t known to the database if it was not yet. Callers must hold db.mu.
+func (db *InMemoryDataBase) label(ctx context.Context, t *tenant, e logEntry) logEntry {
+	if t.id != DefaultTenant {
+		e.Tenant = t.id
+	}
+	e.Actor = ActorFrom(ctx)
+	if _, ok := db.tenants[t.id]; !ok {
+		db.tenants[t.id] = t
+	}
+	return e
+}
+
+// commit makes e durable, applies it to tenant t and publishes the events it
+// causes. Callers must hold db.mu.
+func (db *InMemoryDataBase) commit(ctx context.Context, t *tenant, e logEntry) error {
+	e = db.label(ctx, t, e)
+	if db.log != nil {
+		if err := db.log.append(&e); err != nil {
+			return err
+		}
 	}
 
-	delete(db.notes, id)
+	changed := t.track(e)
+	db.apply(e)
+	db.publish(changed())
 	return nil
 }
 
+func (db *InMemoryDataBase) apply(e logEntry) {
+	t := db.tenantByID(e.Tenant)
+
+	for _, id := range e.DeleteTags {
+		t.tags.deleteTag(id)
+	}
+	for _, tag := range e.PutTags {
+		t.tags.putTag(tag)
+	}
+	for _, l := range e.PutLists {
+		l.Notes = 0
+		t.lists[l.ID] = l
+	}
+
+	for _, n := range e.Put {
+		if old, ok := t.notes[n.ID]; ok {
+			t.unindex(old)
+		}
+		delete(t.trash, n.ID)
+		t.notes[n.ID] = n
+		t.reindex(n)
+		t.record(n, e.Actor, db.revisionLimit)
+	}
+	for _, id := range e.Delete {
+		if old, ok := t.notes[id]; ok {
+			t.unindex(old)
+		}
+		delete(t.notes, id)
+		delete(t.revisions, id)
+	}
+	for _, n := range e.Trash {
+		if old, ok := t.notes[n.ID]; ok {
+			t.unindex(old)
+		}
+		delete(t.notes, n.ID)
+		t.trash[n.ID] = n
+		t.record(n, e.Actor, db.revisionLimit)
+	}
+	for _, id := range e.Purge {
+		delete(t.trash, id)
+		delete(t.revisions, id)
+	}
+	for _, id := range e.DeleteLists {
+		delete(t.lists, id)
+	}
+
+	if e.IDGen > t.idGen.Load() {
+		t.idGen.Store(e.IDGen)
+	}
+	t.tags.idGen = max(t.tags.idGen, e.TagIDGen)
+	t.listIDGen = max(t.listIDGen, e.ListIDGen)
+
+	for _, step := range e.Steps {
+		db.apply(step)
+	}
+}
+
+// reindex adds n to every secondary index. Callers must hold db.mu.
+func (t *tenant) reindex(n Note) {
+	t.index.add(n)
+	t.tags.add(n)
+	if n.ParentID != nil {
+		t.children.add(*n.ParentID, n.ID)
+	}
+	for _, b := range n.BlockedBy {
+		t.blocks.add(b, n.ID)
+	}
+	if n.ListID != nil {
+		t.listNotes.add(*n.ListID, n.ID)
+	}
+}
+
+// unindex removes n from every secondary index. Callers must hold db.mu.
+func (t *tenant) unindex(n Note) {
+	t.index.remove(n)
+	t.tags.remove(n)
+	if n.ParentID != nil {
+		t.children.remove(*n.ParentID, n.ID)
+	}
+	for _, b := range n.BlockedBy {
+		t.blocks.remove(b, n.ID)
+	}
+	if n.ListID != nil {
+		t.listNotes.remove(*n.ListID, n.ID)
+	}
+}
+
+func (db *InMemoryDataBase) Delete(ctx context.Context, id uint64) error {
+	return db.DeleteIfMatch(ctx, id, AnyVersion)
+}
+
+// DeleteIfMatch refuses to delete a note with subtasks, see DeleteWithChildren.
+func (db *InMemoryDataBase) DeleteIfMatch(ctx context.Context, id uint64, version uint64) error {
+	return db.DeleteWithChildren(ctx, id, version, DeleteReject)
+}
+
 func (db *InMemoryDataBase) GetByID(ctx context.Context, id uint64) (Note, error) {
 	select {
 	case <-ctx.Done():
@@ -46,12 +234,14 @@ func (db *InMemoryDataBase) GetByID(ctx context.Context, id uint64) (Note, error
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
-	note, ok := db.notes[id]
+	t := db.tenant(ctx)
+
+	note, ok := t.notes[id]
 	if !ok {
 		return Note{}, ErrNotFoundID
 	}
 
-	return note, nil
+	return t.present(note), nil
 }
 
 func (db *InMemoryDataBase) GetAll(ctx context.Context) ([]Note, error) {
@@ -64,15 +254,128 @@ func (db *InMemoryDataBase) GetAll(ctx context.Context) ([]Note, error) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
-	res := make([]Note, 0, len(db.notes))
-	for _, n := range db.notes {
-		res = append(res, n)
+	t := db.tenant(ctx)
+
+	p := t.presenter()
+	notes := t.sortedNotes()
+	for i := range notes {
+		notes[i] = p.present(notes[i])
+	}
+	return notes, nil
+}
+
+func (db *InMemoryDataBase) List(ctx context.Context, q ListQuery) (NotePage, error) {
+	select {
+	case <-ctx.Done():
+		return NotePage{}, ctx.Err()
+	default:
 	}
 
-	return res, nil
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	notes := t.sortedNotes()
+	if len(q.Tags) > 0 {
+		tagged := t.tags.match(q.Tags)
+		notes = slices.DeleteFunc(notes, func(n Note) bool {
+			_, ok := tagged[n.ID]
+			return !ok
+		})
+	}
+
+	page, err := selectPage(notes, q)
+	p := t.presenter()
+	for i := range page.Notes {
+		page.Notes[i] = p.present(page.Notes[i])
+	}
+	return page, err
+}
+
+// sortedNotes returns all notes ordered by ID. Callers must hold db.mu.
+func (t *tenant) sortedNotes() []Note {
+	res := make([]Note, 0, len(t.notes))
+	for _, n := range t.notes {
+		res = append(res, n)
+	}
+	slices.SortFunc(res, func(a, b Note) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return res
 }
 
 func (db *InMemoryDataBase) Update(ctx context.Context, id uint64, dto NoteDTO) (Note, error) {
+	return db.UpdateIfMatch(ctx, id, AnyVersion, dto)
+}
+
+func (db *InMemoryDataBase) UpdateIfMatch(ctx context.Context, id uint64, version uint64, dto NoteDTO) (Note, error) {
+	return db.modify(ctx, id, version, replaceWith(dto))
+}
+
+// replaceWith returns a change that replaces the content of a note with dto.
+func replaceWith(dto NoteDTO) func(n *Note) error {
+	return func(n *Note) error {
+		if dto.Title == "" {
+			return ErrTitleNotDefined
+		}
+		n.Title = dto.Title
+		n.Description = dto.Description
+		n.Done = dto.Done
+		n.DueAt = dto.DueAt
+		n.Tags = dto.Tags
+		n.ParentID = dto.ParentID
+		n.BlockedBy = dto.BlockedBy
+		n.Recurrence = dto.Recurrence
+		n.ListID = dto.ListID
+		return nil
+	}
+}
+
+func (db *InMemoryDataBase) Patch(ctx context.Context, id uint64, version uint64, patch NotePatch) (Note, error) {
+	return db.modify(ctx, id, version, patchWith(patch))
+}
+
+// patchWith returns a change that applies patch to a note.
+func patchWith(patch NotePatch) func(n *Note) error {
+	return func(n *Note) error {
+		if patch.Title != nil {
+			if *patch.Title == "" {
+				return ErrTitleNotDefined
+			}
+			n.Title = *patch.Title
+		}
+		if patch.Description != nil {
+			n.Description = *patch.Description
+		}
+		if patch.Done != nil {
+			n.Done = *patch.Done
+		}
+		if patch.DueAt != nil {
+			n.DueAt = *patch.DueAt
+		}
+		if patch.Tags != nil {
+			n.Tags = *patch.Tags
+		}
+		if patch.ParentID != nil {
+			n.ParentID = *patch.ParentID
+		}
+		if patch.BlockedBy != nil {
+			n.BlockedBy = *patch.BlockedBy
+		}
+		if patch.Recurrence != nil {
+			n.Recurrence = *patch.Recurrence
+		}
+		if patch.ListID != nil {
+			n.ListID = *patch.ListID
+		}
+		return nil
+	}
+}
+
+// modify applies change to a copy of the note under the write lock and
+// commits the result as the next version.
+func (db *InMemoryDataBase) modify(ctx context.Context, id uint64, version uint64, change func(n *Note) error) (Note, error) {
 	select {
 	case <-ctx.Done():
 		return Note{}, ctx.Err()
@@ -82,20 +385,77 @@ func (db *InMemoryDataBase) Update(ctx context.Context, id uint64, dto NoteDTO)
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	n, ok := db.notes[id]
+	t := db.tenant(ctx)
+
+	e, err := t.modifyEntry(ctx, id, version, change)
+	if err != nil {
+		return Note{}, err
+	}
+	if err := db.commit(ctx, t, e); err != nil {
+		return Note{}, err
+	}
+	return t.present(e.Put[0]), nil
+}
+
+// modifyEntry validates the change of a note and returns the log entry that
+// stores it as the next version. Callers must hold db.mu.
+func (t *tenant) modifyEntry(ctx context.Context, id uint64, version uint64, change func(n *Note) error) (logEntry, error) {
+	n, ok := t.notes[id]
 	if !ok {
-		return Note{}, ErrNotFoundID
+		return logEntry{}, ErrNotFoundID
+	}
+	if version != AnyVersion && n.Version != version {
+		return logEntry{}, ErrVersionMismatch
 	}
 
-	if dto.Title == "" {
-		return Note{}, ErrTitleNotDefined
+	wasDone := n.Done
+	if err := change(&n); err != nil {
+		return logEntry{}, err
+	}
+	if err := t.checkParent(n.ID, n.ParentID); err != nil {
+		return logEntry{}, err
+	}
+	if err := t.checkList(n.ListID); err != nil {
+		return logEntry{}, err
+	}
+	blockers, err := t.checkBlockers(n.ID, n.BlockedBy)
+	if err != nil {
+		return logEntry{}, err
+	}
+	n.BlockedBy = blockers
+	if n.Done && !wasDone && t.blocked(n) && !Forced(ctx) {
+		return logEntry{}, ErrBlocked
+	}
+	rule, err := setRecurrence(&n)
+	if err != nil {
+		return logEntry{}, err
 	}
-	n.Title = dto.Title
-	n.Description = dto.Description
-	n.Done = dto.Done
 
-	db.notes[id] = n
-	return n, nil
+	e := logEntry{IDGen: t.idGen.Load()}
+	tags, err := t.resolveTags(&e, n.Tags)
+	if err != nil {
+		return logEntry{}, err
+	}
+	n.Tags = tags
+	n.Version++
+	n.UpdatedAt = t.now()
+	switch {
+	case n.Done && !wasDone:
+		completed := n.UpdatedAt
+		n.CompletedAt = &completed
+	case !n.Done:
+		n.CompletedAt = nil
+	}
+
+	e.Put = []Note{n}
+	if n.Done && !wasDone && rule != nil && n.NextID == nil {
+		if next, ok := t.nextOccurrence(n, *rule); ok {
+			e.IDGen = next.ID
+			e.Put[0].NextID = &next.ID
+			e.Put = append(e.Put, next)
+		}
+	}
+	return e, nil
 }
 
 func (db *InMemoryDataBase) Create(ctx context.Context, dto NoteDTO) (Note, error) {
@@ -108,17 +468,105 @@ func (db *InMemoryDataBase) Create(ctx context.Context, dto NoteDTO) (Note, erro
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	t := db.tenant(ctx)
+
+	e, err := t.createEntry(ctx, dto)
+	if err != nil {
+		return Note{}, err
+	}
+	if err := db.commit(ctx, t, e); err != nil {
+		return Note{}, err
+	}
+	return t.present(e.Put[0]), nil
+}
+
+// createEntry validates a new note and returns the log entry that stores it.
+// The note ID is taken even if the entry is never committed. Callers must
+// hold db.mu.
+func (t *tenant) createEntry(ctx context.Context, dto NoteDTO) (logEntry, error) {
 	if dto.Title == "" {
-		return Note{}, ErrTitleNotDefined
+		return logEntry{}, ErrTitleNotDefined
 	}
 
+	if err := t.checkParent(0, dto.ParentID); err != nil {
+		return logEntry{}, err
+	}
+	if err := t.checkList(dto.ListID); err != nil {
+		return logEntry{}, err
+	}
+	blockers, err := t.checkBlockers(0, dto.BlockedBy)
+	if err != nil {
+		return logEntry{}, err
+	}
+
+	var e logEntry
+	tags, err := t.resolveTags(&e, dto.Tags)
+	if err != nil {
+		return logEntry{}, err
+	}
+
+	now := t.now()
 	note := Note{
-		ID:          db.idGen.Add(1),
 		Title:       dto.Title,
 		Description: dto.Description,
 		Done:        dto.Done,
+		Version:     1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		DueAt:       dto.DueAt,
+		Tags:        tags,
+		ParentID:    dto.ParentID,
+		BlockedBy:   blockers,
+		Recurrence:  dto.Recurrence,
+		ListID:      dto.ListID,
+	}
+	rule, err := setRecurrence(&note)
+	if err != nil {
+		return logEntry{}, err
+	}
+	if note.Done && t.blocked(note) && !Forced(ctx) {
+		return logEntry{}, ErrBlocked
+	}
+	if note.Done {
+		note.CompletedAt = &now
+	}
+
+	note.ID = t.idGen.Add(1)
+	e.IDGen = note.ID
+	e.Put = []Note{note}
+	if note.Done && rule != nil {
+		if next, ok := t.nextOccurrence(note, *rule); ok {
+			e.IDGen = next.ID
+			e.Put[0].NextID = &next.ID
+			e.Put = append(e.Put, next)
+		}
 	}
+	return e, nil
+}
+
+// present fills the fields that are computed at read time and never stored.
+func (t *tenant) present(n Note) Note {
+	return t.presenter().present(n)
+}
+
+// presenter presents the notes of one read. Use one presenter for all notes
+// of a read, and a new one after the notes change.
+type presenter struct {
+	t      *tenant
+	now    time.Time
+	counts map[uint64]Progress
+}
+
+func (t *tenant) presenter() *presenter {
+	return &presenter{t: t, now: t.now(), counts: make(map[uint64]Progress)}
+}
 
-	db.notes[note.ID] = note
-	return note, nil
+func (p *presenter) present(n Note) Note {
+	n.Overdue = n.DueAt != nil && !n.Done && n.DueAt.Before(p.now)
+	n.Progress = nil
+	if progress := p.progress(n.ID); progress.Total > 0 {
+		n.Progress = &progress
+	}
+	n.Blocked = !n.Done && p.t.blocked(n)
+	return n
 }
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"slices"
 	"testing"
 	"time"
 )
@@ -241,7 +242,8 @@ func TestUpdate(t *testing.T) {
 		{
 			name: "context deadline",
 			ctx: func() context.Context {
-				ctx, _ := context.WithTimeout(context.Background(), time.Nanosecond)
+				ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+				defer cancel()
 				time.Sleep(time.Millisecond)
 				return ctx
 			}(),
@@ -325,3 +327,561 @@ func TestDelete(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateIfMatch(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	created, _ := repo.Create(context.Background(), NoteDTO{Title: "title"})
+
+	testTable := []struct {
+		name       string
+		version    uint64
+		expErr     error
+		expVersion uint64
+	}{
+		{
+			name:       "matching version",
+			version:    1,
+			expVersion: 2,
+		},
+		{
+			name:    "stale version",
+			version: 1,
+			expErr:  ErrVersionMismatch,
+		},
+		{
+			name:       "any version",
+			version:    AnyVersion,
+			expVersion: 3,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			note, err := repo.UpdateIfMatch(context.Background(), created.ID, testCase.version, NoteDTO{Title: testCase.name})
+
+			if !errors.Is(err, testCase.expErr) {
+				t.Fatalf("expected error %v, got %v", testCase.expErr, err)
+			}
+
+			if testCase.expErr != nil {
+				return
+			}
+
+			if note.Version != testCase.expVersion {
+				t.Errorf("version: expected %d, got %d", testCase.expVersion, note.Version)
+			}
+		})
+	}
+}
+
+func TestDeleteIfMatch(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	created, _ := repo.Create(context.Background(), NoteDTO{Title: "title"})
+	repo.Update(context.Background(), created.ID, NoteDTO{Title: "new title"})
+
+	testTable := []struct {
+		name    string
+		version uint64
+		expErr  error
+	}{
+		{
+			name:    "stale version",
+			version: 1,
+			expErr:  ErrVersionMismatch,
+		},
+		{
+			name:    "matching version",
+			version: 2,
+		},
+		{
+			name:    "already deleted",
+			version: 2,
+			expErr:  ErrNotFoundID,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			err := repo.DeleteIfMatch(context.Background(), created.ID, testCase.version)
+
+			if !errors.Is(err, testCase.expErr) {
+				t.Fatalf("expected error %v, got %v", testCase.expErr, err)
+			}
+		})
+	}
+}
+
+func TestPatch(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	created, _ := repo.Create(context.Background(), NoteDTO{
+		Title:       "title",
+		Description: "desc",
+	})
+
+	done := true
+	empty := ""
+	title := "new title"
+
+	testTable := []struct {
+		name     string
+		version  uint64
+		patch    NotePatch
+		expErr   error
+		expTitle string
+		expDesc  string
+		expDone  bool
+	}{
+		{
+			name:     "only done",
+			version:  AnyVersion,
+			patch:    NotePatch{Done: &done},
+			expTitle: "title",
+			expDesc:  "desc",
+			expDone:  true,
+		},
+		{
+			name:     "title and description",
+			version:  2,
+			patch:    NotePatch{Title: &title, Description: &empty},
+			expTitle: "new title",
+			expDesc:  "",
+			expDone:  true,
+		},
+		{
+			name:    "empty title",
+			version: AnyVersion,
+			patch:   NotePatch{Title: &empty},
+			expErr:  ErrTitleNotDefined,
+		},
+		{
+			name:    "stale version",
+			version: 1,
+			patch:   NotePatch{Done: &done},
+			expErr:  ErrVersionMismatch,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			note, err := repo.Patch(context.Background(), created.ID, testCase.version, testCase.patch)
+
+			if !errors.Is(err, testCase.expErr) {
+				t.Fatalf("expected error %v, got %v", testCase.expErr, err)
+			}
+
+			if testCase.expErr != nil {
+				return
+			}
+
+			if note.Title != testCase.expTitle {
+				t.Errorf("title: expected %q, got %q", testCase.expTitle, note.Title)
+			}
+			if note.Description != testCase.expDesc {
+				t.Errorf("description: expected %q, got %q", testCase.expDesc, note.Description)
+			}
+			if note.Done != testCase.expDone {
+				t.Errorf("done: expected %v, got %v", testCase.expDone, note.Done)
+			}
+		})
+	}
+}
+
+func TestList(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	for i := 0; i < 5; i++ {
+		repo.Create(context.Background(), NoteDTO{Title: "t"})
+	}
+	repo.Delete(context.Background(), 3)
+
+	var ids []uint64
+	var pages int
+	q := ListQuery{Limit: 2}
+	for {
+		page, err := repo.List(context.Background(), q)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		pages++
+		for _, n := range page.Notes {
+			ids = append(ids, n.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+
+	expIDs := []uint64{1, 2, 4, 5}
+	if !slices.Equal(ids, expIDs) {
+		t.Errorf("ids: expected %v, got %v", expIDs, ids)
+	}
+	if pages != 2 {
+		t.Errorf("pages: expected 2, got %d", pages)
+	}
+
+	testTable := []struct {
+		name   string
+		ctx    context.Context
+		q      ListQuery
+		expErr error
+		expIDs []uint64
+	}{
+		{
+			name:   "no limit",
+			ctx:    context.Background(),
+			expIDs: []uint64{1, 2, 4, 5},
+		},
+		{
+			name:   "cursor of deleted note",
+			ctx:    context.Background(),
+			q:      ListQuery{Cursor: encodeCursor([]SortKey{{Field: "id"}}, []any{uint64(3)})},
+			expIDs: []uint64{4, 5},
+		},
+		{
+			name:   "invalid cursor",
+			ctx:    context.Background(),
+			q:      ListQuery{Cursor: "!!!"},
+			expErr: ErrInvalidCursor,
+		},
+		{
+			name: "context canceled",
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			}(),
+			expErr: context.Canceled,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			page, err := repo.List(testCase.ctx, testCase.q)
+
+			if !errors.Is(err, testCase.expErr) {
+				t.Fatalf("expected error %v, got %v", testCase.expErr, err)
+			}
+
+			if testCase.expErr != nil {
+				return
+			}
+
+			var ids []uint64
+			for _, n := range page.Notes {
+				ids = append(ids, n.ID)
+			}
+			if !slices.Equal(ids, testCase.expIDs) {
+				t.Errorf("ids: expected %v, got %v", testCase.expIDs, ids)
+			}
+		})
+	}
+}
+
+func TestListFilterAndSort(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	repo.Create(context.Background(), NoteDTO{Title: "Купить молоко", Description: "магазин"})
+	repo.Create(context.Background(), NoteDTO{Title: "Позвонить", Done: true})
+	repo.Create(context.Background(), NoteDTO{Title: "купить хлеб"})
+	repo.Create(context.Background(), NoteDTO{Title: "Buy milk", Description: "МАГАЗИН у дома"})
+	repo.Create(context.Background(), NoteDTO{Title: "Позвонить", Description: "маме"})
+
+	mustFilter := func(field string, op FilterOp, raw string) Filter {
+		f, err := ParseFilter(field, field, op, raw)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return f
+	}
+
+	testTable := []struct {
+		name   string
+		q      ListQuery
+		expErr error
+		expIDs []uint64
+	}{
+		{
+			name:   "undone",
+			q:      ListQuery{Filters: []Filter{mustFilter("done", OpEq, "false")}},
+			expIDs: []uint64{1, 3, 4, 5},
+		},
+		{
+			name:   "title contains ignoring case",
+			q:      ListQuery{Filters: []Filter{mustFilter("title", OpContains, "КУПИТЬ")}},
+			expIDs: []uint64{1, 3},
+		},
+		{
+			name: "description contains and id range",
+			q: ListQuery{Filters: []Filter{
+				mustFilter("description", OpContains, "магазин"),
+				mustFilter("id", OpGt, "1"),
+			}},
+			expIDs: []uint64{4},
+		},
+		{
+			name:   "newest first",
+			q:      ListQuery{Sort: []SortKey{{Field: "id", Desc: true}}},
+			expIDs: []uint64{5, 4, 3, 2, 1},
+		},
+		{
+			name:   "title then id",
+			q:      ListQuery{Sort: []SortKey{{Field: "title"}}},
+			expIDs: []uint64{4, 1, 2, 5, 3},
+		},
+		{
+			name:   "title descending with id tiebreak",
+			q:      ListQuery{Sort: []SortKey{{Field: "title", Desc: true}}, Filters: []Filter{mustFilter("title", OpEq, "Позвонить")}},
+			expIDs: []uint64{2, 5},
+		},
+		{
+			name:   "unknown field",
+			q:      ListQuery{Filters: []Filter{{Field: "priority", Op: OpEq, Value: "1"}}},
+			expErr: ErrInvalidQuery,
+		},
+		{
+			name:   "bad operator",
+			q:      ListQuery{Filters: []Filter{{Field: "done", Op: OpGt, Value: true}}},
+			expErr: ErrInvalidQuery,
+		},
+		{
+			name:   "value of wrong type",
+			q:      ListQuery{Filters: []Filter{{Field: "id", Op: OpEq, Value: "1"}}},
+			expErr: ErrInvalidQuery,
+		},
+		{
+			name:   "unknown sort field",
+			q:      ListQuery{Sort: []SortKey{{Field: "priority"}}},
+			expErr: ErrInvalidQuery,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			page, err := repo.List(context.Background(), testCase.q)
+
+			if !errors.Is(err, testCase.expErr) {
+				t.Fatalf("expected error %v, got %v", testCase.expErr, err)
+			}
+
+			if testCase.expErr != nil {
+				return
+			}
+
+			var ids []uint64
+			for _, n := range page.Notes {
+				ids = append(ids, n.ID)
+			}
+			if !slices.Equal(ids, testCase.expIDs) {
+				t.Errorf("ids: expected %v, got %v", testCase.expIDs, ids)
+			}
+		})
+	}
+}
+
+func TestListSortedPages(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	for _, title := range []string{"b", "a", "c", "a", "b"} {
+		repo.Create(context.Background(), NoteDTO{Title: title})
+	}
+
+	sort := []SortKey{{Field: "title", Desc: true}}
+	page, err := repo.List(context.Background(), ListQuery{Sort: sort, Limit: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Deleting a note that was already returned must not shift the next page.
+	repo.Delete(context.Background(), 1)
+
+	var ids []uint64
+	for _, n := range page.Notes {
+		ids = append(ids, n.ID)
+	}
+	for page.NextCursor != "" {
+		page, err = repo.List(context.Background(), ListQuery{Sort: sort, Limit: 2, Cursor: page.NextCursor})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, n := range page.Notes {
+			ids = append(ids, n.ID)
+		}
+	}
+
+	expIDs := []uint64{3, 1, 5, 2, 4}
+	if !slices.Equal(ids, expIDs) {
+		t.Errorf("ids: expected %v, got %v", expIDs, ids)
+	}
+
+	_, err = repo.List(context.Background(), ListQuery{Cursor: encodeCursor(withIDTiebreak(sort), []any{"b", uint64(1)})})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("cursor with other sort: expected error %v, got %v", ErrInvalidCursor, err)
+	}
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestTimestamps(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	repo := NewInMemoryDataBase(WithClock(clock))
+
+	created, _ := repo.Create(context.Background(), NoteDTO{Title: "title"})
+	done := true
+	undone := false
+
+	testTable := []struct {
+		name         string
+		change       func() (Note, error)
+		expUpdated   time.Time
+		expCompleted *time.Time
+	}{
+		{
+			name: "created",
+			change: func() (Note, error) {
+				return repo.GetByID(context.Background(), created.ID)
+			},
+			expUpdated: start,
+		},
+		{
+			name: "edit keeps completion empty",
+			change: func() (Note, error) {
+				return repo.Update(context.Background(), created.ID, NoteDTO{Title: "new title"})
+			},
+			expUpdated: start.Add(time.Minute),
+		},
+		{
+			name: "done sets completion",
+			change: func() (Note, error) {
+				return repo.Patch(context.Background(), created.ID, AnyVersion, NotePatch{Done: &done})
+			},
+			expUpdated:   start.Add(2 * time.Minute),
+			expCompleted: ptr(start.Add(2 * time.Minute)),
+		},
+		{
+			name: "edit of done note keeps completion",
+			change: func() (Note, error) {
+				return repo.Update(context.Background(), created.ID, NoteDTO{Title: "title", Done: true})
+			},
+			expUpdated:   start.Add(3 * time.Minute),
+			expCompleted: ptr(start.Add(2 * time.Minute)),
+		},
+		{
+			name: "undone clears completion",
+			change: func() (Note, error) {
+				return repo.Patch(context.Background(), created.ID, AnyVersion, NotePatch{Done: &undone})
+			},
+			expUpdated: start.Add(4 * time.Minute),
+		},
+	}
+
+	for i, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			clock.now = start.Add(time.Duration(i) * time.Minute)
+
+			note, err := testCase.change()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !note.CreatedAt.Equal(start) {
+				t.Errorf("created_at: expected %v, got %v", start, note.CreatedAt)
+			}
+			if !note.UpdatedAt.Equal(testCase.expUpdated) {
+				t.Errorf("updated_at: expected %v, got %v", testCase.expUpdated, note.UpdatedAt)
+			}
+			switch {
+			case testCase.expCompleted == nil && note.CompletedAt != nil:
+				t.Errorf("completed_at: expected none, got %v", *note.CompletedAt)
+			case testCase.expCompleted != nil && (note.CompletedAt == nil || !note.CompletedAt.Equal(*testCase.expCompleted)):
+				t.Errorf("completed_at: expected %v, got %v", *testCase.expCompleted, note.CompletedAt)
+			}
+		})
+	}
+}
+
+func TestListByTimestamps(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	repo := NewInMemoryDataBase(WithClock(clock))
+
+	repo.Create(context.Background(), NoteDTO{Title: "t1"})
+	clock.Advance(time.Hour)
+	repo.Create(context.Background(), NoteDTO{Title: "t2", Done: true})
+	clock.Advance(time.Hour)
+	repo.Create(context.Background(), NoteDTO{Title: "t3"})
+	clock.Advance(time.Hour)
+	repo.Update(context.Background(), 1, NoteDTO{Title: "t1", Done: true})
+
+	mustFilter := func(field string, op FilterOp, raw string) Filter {
+		f, err := ParseFilter(field, field, op, raw)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return f
+	}
+
+	testTable := []struct {
+		name   string
+		q      ListQuery
+		expIDs []uint64
+	}{
+		{
+			name:   "recently updated first",
+			q:      ListQuery{Sort: []SortKey{{Field: "updated_at", Desc: true}}},
+			expIDs: []uint64{1, 3, 2},
+		},
+		{
+			name:   "created after",
+			q:      ListQuery{Filters: []Filter{mustFilter("created_at", OpGt, "2024-03-01T12:30:00Z")}},
+			expIDs: []uint64{2, 3},
+		},
+		{
+			name:   "completed before",
+			q:      ListQuery{Filters: []Filter{mustFilter("completed_at", OpLt, "2024-03-01T14:00:00+00:00")}},
+			expIDs: []uint64{2},
+		},
+		{
+			name:   "never completed sorts last",
+			q:      ListQuery{Sort: []SortKey{{Field: "completed_at"}}},
+			expIDs: []uint64{2, 1, 3},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			page, err := repo.List(context.Background(), testCase.q)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var ids []uint64
+			for _, n := range page.Notes {
+				ids = append(ids, n.ID)
+			}
+			if !slices.Equal(ids, testCase.expIDs) {
+				t.Errorf("ids: expected %v, got %v", testCase.expIDs, ids)
+			}
+		})
+	}
+
+	page, _ := repo.List(context.Background(), ListQuery{Sort: []SortKey{{Field: "completed_at"}}, Limit: 2})
+	page, err := repo.List(context.Background(), ListQuery{Sort: []SortKey{{Field: "completed_at"}}, Limit: 2, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("cursor over missing value: unexpected error: %v", err)
+	}
+	if len(page.Notes) != 1 || page.Notes[0].ID != 3 {
+		t.Errorf("cursor over missing value: expected note 3, got %+v", page.Notes)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+)
+
+type ListRepository interface {
+	CreateList(ctx context.Context, dto ListDTO) (List, error)
+	GetList(ctx context.Context, id uint64) (List, error)
+	GetLists(ctx context.Context) ([]List, error)
+	UpdateList(ctx context.Context, id uint64, dto ListDTO) (List, error)
+	DeleteList(ctx context.Context, id uint64, how ListDelete) error
+	MoveNote(ctx context.Context, noteID uint64, listID uint64) (Note, error)
+}
+
+// List groups notes into a project. Notes is the number of notes in the list
+// and is computed at read time.
+type List struct {
+	ID          uint64 `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Notes       int    `json:"notes"`
+}
+
+type ListDTO struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ListDelete tells what happens to the notes of a deleted list. With neither
+// field set only an empty list can be deleted.
+type ListDelete struct {
+	Cascade bool
+	MoveTo  uint64
+}
+
+var ErrListNotFound error = errors.New("list not found")
+var ErrListNameRequired error = errors.New("list must have a name")
+var ErrListNotEmpty error = errors.New("list has notes, delete them with cascade or move them with move_to")
+var ErrInvalidListDelete error = errors.New("list delete needs either cascade or a different move_to list")
+
+// checkList makes sure a note can be put into list id. Callers must hold
+// db.mu.
+func (t *tenant) checkList(id *uint64) error {
+	if id == nil {
+		return nil
+	}
+	if _, ok := t.lists[*id]; !ok {
+		return ErrListNotFound
+	}
+	return nil
+}
+
+func (t *tenant) presentList(l List) List {
+	l.Notes = len(t.listNotes[l.ID])
+	return l
+}
+
+func (db *InMemoryDataBase) CreateList(ctx context.Context, dto ListDTO) (List, error) {
+	select {
+	case <-ctx.Done():
+		return List{}, ctx.Err()
+	default:
+	}
+
+	if strings.TrimSpace(dto.Name) == "" {
+		return List{}, ErrListNameRequired
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	l := List{ID: t.listIDGen + 1, Name: dto.Name, Description: dto.Description}
+	e := logEntry{IDGen: t.idGen.Load(), ListIDGen: l.ID, PutLists: []List{l}}
+	if err := db.commit(ctx, t, e); err != nil {
+		return List{}, err
+	}
+	return l, nil
+}
+
+func (db *InMemoryDataBase) GetList(ctx context.Context, id uint64) (List, error) {
+	select {
+	case <-ctx.Done():
+		return List{}, ctx.Err()
+	default:
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	l, ok := t.lists[id]
+	if !ok {
+		return List{}, ErrListNotFound
+	}
+	return t.presentList(l), nil
+}
+
+func (db *InMemoryDataBase) GetLists(ctx context.Context) ([]List, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	res := t.sortedLists()
+	for i := range res {
+		res[i] = t.presentList(res[i])
+	}
+	return res, nil
+}
+
+// sortedLists returns all lists ordered by ID. Callers must hold db.mu.
+func (t *tenant) sortedLists() []List {
+	res := make([]List, 0, len(t.lists))
+	for _, l := range t.lists {
+		res = append(res, l)
+	}
+	slices.SortFunc(res, func(a, b List) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return res
+}
+
+func (db *InMemoryDataBase) UpdateList(ctx context.Context, id uint64, dto ListDTO) (List, error) {
+	select {
+	case <-ctx.Done():
+		return List{}, ctx.Err()
+	default:
+	}
+
+	if strings.TrimSpace(dto.Name) == "" {
+		return List{}, ErrListNameRequired
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	l, ok := t.lists[id]
+	if !ok {
+		return List{}, ErrListNotFound
+	}
+	l.Name = dto.Name
+	l.Description = dto.Description
+
+	if err := db.commit(ctx, t, logEntry{IDGen: t.idGen.Load(), PutLists: []List{l}}); err != nil {
+		return List{}, err
+	}
+	return t.presentList(l), nil
+}
+
+// DeleteList deletes a list together with its notes or moves them to another
+// list in one atomic change.
+func (db *InMemoryDataBase) DeleteList(ctx context.Context, id uint64, how ListDelete) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	if (how.Cascade && how.MoveTo != 0) || how.MoveTo == id {
+		return ErrInvalidListDelete
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.lists[id]; !ok {
+		return ErrListNotFound
+	}
+	if how.MoveTo != 0 {
+		if _, ok := t.lists[how.MoveTo]; !ok {
+			return ErrListNotFound
+		}
+	}
+
+	notes := t.listNotes.sorted(id)
+	now := t.now()
+	e := logEntry{IDGen: t.idGen.Load(), DeleteLists: []uint64{id}}
+	switch {
+	case len(notes) == 0:
+	case how.Cascade:
+		for _, noteID := range notes {
+			if !slices.Contains(e.Delete, noteID) {
+				e.Delete = append(e.Delete, noteID)
+				e.Delete = append(e.Delete, t.descendants(noteID)...)
+			}
+		}
+		slices.Sort(e.Delete)
+		e.Delete = slices.Compact(e.Delete)
+		t.detachDependents(&e, now)
+		t.moveToTrash(&e, now)
+	case how.MoveTo != 0:
+		for _, noteID := range notes {
+			n := t.notes[noteID]
+			n.ListID = &how.MoveTo
+			n.Version++
+			n.UpdatedAt = now
+			e.Put = append(e.Put, n)
+		}
+	default:
+		return ErrListNotEmpty
+	}
+
+	return db.commit(ctx, t, e)
+}
+
+// MoveNote puts a note into another list. A listID of 0 takes the note out of
+// any list.
+func (db *InMemoryDataBase) MoveNote(ctx context.Context, noteID uint64, listID uint64) (Note, error) {
+	return db.modify(ctx, noteID, AnyVersion, func(n *Note) error {
+		n.ListID = nil
+		if listID != 0 {
+			n.ListID = &listID
+		}
+		return nil
+	})
+}
@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// newLists creates lists 1 and 2, notes 1 and 2 in list 1 with 3 under note
+// 1, and note 4 outside of any list that is blocked by note 2.
+func newLists(t *testing.T) *InMemoryDataBase {
+	t.Helper()
+
+	repo := NewInMemoryDataBase()
+	work, _ := repo.CreateList(context.Background(), ListDTO{Name: "work"})
+	repo.CreateList(context.Background(), ListDTO{Name: "home"})
+	first, _ := repo.Create(context.Background(), NoteDTO{Title: "first", ListID: &work.ID})
+	second, _ := repo.Create(context.Background(), NoteDTO{Title: "second", ListID: &work.ID})
+	repo.Create(context.Background(), NoteDTO{Title: "sub", ParentID: &first.ID})
+	repo.Create(context.Background(), NoteDTO{Title: "other", BlockedBy: []uint64{second.ID}})
+	return repo
+}
+
+func TestLists(t *testing.T) {
+	repo := newLists(t)
+
+	if _, err := repo.CreateList(context.Background(), ListDTO{Name: " "}); !errors.Is(err, ErrListNameRequired) {
+		t.Errorf("create without name: expected %v, got %v", ErrListNameRequired, err)
+	}
+
+	lists, _ := repo.GetLists(context.Background())
+	exp := []List{{ID: 1, Name: "work", Notes: 2}, {ID: 2, Name: "home"}}
+	if !slices.Equal(lists, exp) {
+		t.Errorf("lists: expected %+v, got %+v", exp, lists)
+	}
+
+	missing := uint64(42)
+	if _, err := repo.Create(context.Background(), NoteDTO{Title: "lost", ListID: &missing}); !errors.Is(err, ErrListNotFound) {
+		t.Errorf("create in missing list: expected %v, got %v", ErrListNotFound, err)
+	}
+
+	note, err := repo.MoveNote(context.Background(), 1, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if note.ListID == nil || *note.ListID != 2 || note.Version != 2 {
+		t.Errorf("move: expected list 2 at version 2, got %v at version %d", note.ListID, note.Version)
+	}
+	page, _ := repo.List(context.Background(), ListQuery{Filters: []Filter{{Field: "list_id", Op: OpEq, Value: uint64(2)}}})
+	if ids := noteIDs(page.Notes); !slices.Equal(ids, []uint64{1}) {
+		t.Errorf("notes of list 2: expected [1], got %v", ids)
+	}
+
+	note, _ = repo.MoveNote(context.Background(), 1, 0)
+	if note.ListID != nil {
+		t.Errorf("move out: expected no list, got %v", *note.ListID)
+	}
+	if _, err := repo.MoveNote(context.Background(), 1, 42); !errors.Is(err, ErrListNotFound) {
+		t.Errorf("move to missing list: expected %v, got %v", ErrListNotFound, err)
+	}
+
+	list, _ := repo.UpdateList(context.Background(), 2, ListDTO{Name: "house", Description: "chores"})
+	if list != (List{ID: 2, Name: "house", Description: "chores"}) {
+		t.Errorf("update: unexpected list %+v", list)
+	}
+}
+
+func TestDeleteList(t *testing.T) {
+	testTable := []struct {
+		name     string
+		how      ListDelete
+		expErr   error
+		expNotes []uint64
+		expList  []uint64
+	}{
+		{name: "not empty", expErr: ErrListNotEmpty, expNotes: []uint64{1, 2, 3, 4}},
+		{name: "cascade", how: ListDelete{Cascade: true}, expNotes: []uint64{4}},
+		{name: "move", how: ListDelete{MoveTo: 2}, expNotes: []uint64{1, 2, 3, 4}, expList: []uint64{1, 2}},
+		{name: "move to itself", how: ListDelete{MoveTo: 1}, expErr: ErrInvalidListDelete, expNotes: []uint64{1, 2, 3, 4}},
+		{name: "move to missing", how: ListDelete{MoveTo: 42}, expErr: ErrListNotFound, expNotes: []uint64{1, 2, 3, 4}},
+		{name: "cascade and move", how: ListDelete{Cascade: true, MoveTo: 2}, expErr: ErrInvalidListDelete, expNotes: []uint64{1, 2, 3, 4}},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := newLists(t)
+
+			err := repo.DeleteList(context.Background(), 1, testCase.how)
+			if !errors.Is(err, testCase.expErr) {
+				t.Fatalf("error: expected %v, got %v", testCase.expErr, err)
+			}
+
+			notes, _ := repo.GetAll(context.Background())
+			if ids := noteIDs(notes); !slices.Equal(ids, testCase.expNotes) {
+				t.Errorf("notes: expected %v, got %v", testCase.expNotes, ids)
+			}
+
+			page, _ := repo.List(context.Background(), ListQuery{Filters: []Filter{{Field: "list_id", Op: OpEq, Value: uint64(2)}}})
+			if ids := noteIDs(page.Notes); !slices.Equal(ids, testCase.expList) {
+				t.Errorf("notes of list 2: expected %v, got %v", testCase.expList, ids)
+			}
+		})
+	}
+
+	repo := newLists(t)
+	repo.DeleteList(context.Background(), 1, ListDelete{Cascade: true})
+	other, _ := repo.GetByID(context.Background(), 4)
+	if len(other.BlockedBy) != 0 || other.Blocked {
+		t.Errorf("cascade: note 4 is still blocked by %v", other.BlockedBy)
+	}
+	if _, err := repo.GetList(context.Background(), 1); !errors.Is(err, ErrListNotFound) {
+		t.Errorf("deleted list: expected %v, got %v", ErrListNotFound, err)
+	}
+}
+
+func TestListsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	repo, err := OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	work, _ := repo.CreateList(context.Background(), ListDTO{Name: "work"})
+	repo.Create(context.Background(), NoteDTO{Title: "t1", ListID: &work.ID})
+	repo.Compact(context.Background())
+	home, _ := repo.CreateList(context.Background(), ListDTO{Name: "home"})
+	repo.MoveNote(context.Background(), 1, home.ID)
+	repo.DeleteList(context.Background(), work.ID, ListDelete{})
+	repo.Close()
+
+	repo, err = OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer repo.Close()
+
+	lists, _ := repo.GetLists(context.Background())
+	exp := []List{{ID: home.ID, Name: "home", Notes: 1}}
+	if !slices.Equal(lists, exp) {
+		t.Errorf("lists: expected %+v, got %+v", exp, lists)
+	}
+
+	created, _ := repo.CreateList(context.Background(), ListDTO{Name: "ops"})
+	if created.ID != home.ID+1 {
+		t.Errorf("id: expected %d, got %d", home.ID+1, created.ID)
+	}
+}
@@ -0,0 +1,449 @@
+package repository
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor error = errors.New("invalid cursor")
+var ErrInvalidQuery error = errors.New("invalid query")
+
+type FilterOp string
+
+const (
+	OpEq       FilterOp = "eq"
+	OpNe       FilterOp = "ne"
+	OpLt       FilterOp = "lt"
+	OpLte      FilterOp = "lte"
+	OpGt       FilterOp = "gt"
+	OpGte      FilterOp = "gte"
+	OpContains FilterOp = "contains"
+)
+
+type Filter struct {
+	Field string
+	Op    FilterOp
+	Value any
+}
+
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// ListQuery selects a page of notes. Tags holds groups of tag names: a note
+// must carry at least one tag from every group.
+type ListQuery struct {
+	Filters []Filter
+	Tags    [][]string
+	Sort    []SortKey
+	Limit   int
+	Cursor  string
+}
+
+type NotePage struct {
+	Notes      []Note
+	NextCursor string
+}
+
+// QueryError describes one bad part of a list query. Param names the query
+// parameter as the client wrote it.
+type QueryError struct {
+	Param   string `json:"param"`
+	Message string `json:"message"`
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Param, e.Message)
+}
+
+func (e *QueryError) Unwrap() error {
+	return ErrInvalidQuery
+}
+
+type fieldKind int
+
+const (
+	kindUint fieldKind = iota
+	kindBool
+	kindString
+	kindTime
+)
+
+type noteField struct {
+	kind  fieldKind
+	ops   []FilterOp
+	value func(n Note) any
+}
+
+var (
+	equalityOps = []FilterOp{OpEq, OpNe}
+	orderedOps  = []FilterOp{OpEq, OpNe, OpLt, OpLte, OpGt, OpGte}
+	textOps     = []FilterOp{OpEq, OpNe, OpContains}
+)
+
+// noteFields lists everything a list query may filter or sort on.
+var noteFields = map[string]noteField{
+	"id":           {kind: kindUint, ops: orderedOps, value: func(n Note) any { return n.ID }},
+	"title":        {kind: kindString, ops: textOps, value: func(n Note) any { return n.Title }},
+	"description":  {kind: kindString, ops: textOps, value: func(n Note) any { return n.Description }},
+	"done":         {kind: kindBool, ops: equalityOps, value: func(n Note) any { return n.Done }},
+	"created_at":   {kind: kindTime, ops: orderedOps, value: func(n Note) any { return n.CreatedAt }},
+	"updated_at":   {kind: kindTime, ops: orderedOps, value: func(n Note) any { return n.UpdatedAt }},
+	"completed_at": {kind: kindTime, ops: orderedOps, value: func(n Note) any { return optionalTime(n.CompletedAt) }},
+	"due_at":       {kind: kindTime, ops: orderedOps, value: func(n Note) any { return optionalTime(n.DueAt) }},
+	"list_id":      {kind: kindUint, ops: equalityOps, value: func(n Note) any { return optionalUint(n.ListID) }},
+	"parent_id":    {kind: kindUint, ops: equalityOps, value: func(n Note) any { return optionalUint(n.ParentID) }},
+}
+
+func optionalTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+func optionalUint(u *uint64) any {
+	if u == nil {
+		return nil
+	}
+	return *u
+}
+
+// ParseFilter validates a filter written by a client as param=raw and converts
+// raw to the type of the field.
+func ParseFilter(param, field string, op FilterOp, raw string) (Filter, error) {
+	f, err := lookupField(param, field, op)
+	if err != nil {
+		return Filter{}, err
+	}
+
+	value, err := parseFieldValue(f.kind, raw)
+	if err != nil {
+		return Filter{}, &QueryError{Param: param, Message: err.Error()}
+	}
+
+	return Filter{Field: field, Op: op, Value: value}, nil
+}
+
+func lookupField(param, field string, op FilterOp) (noteField, error) {
+	f, ok := noteFields[field]
+	if !ok {
+		return f, &QueryError{Param: param, Message: fmt.Sprintf("unknown field %q", field)}
+	}
+	if !slices.Contains(f.ops, op) {
+		return f, &QueryError{Param: param, Message: fmt.Sprintf("operator %q is not supported for field %q", op, field)}
+	}
+	return f, nil
+}
+
+// ParseSort reads a comma-separated list of fields, each optionally prefixed
+// with "-" for descending order.
+func ParseSort(param, spec string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, item := range strings.Split(spec, ",") {
+		key := SortKey{Field: strings.TrimSpace(item)}
+		if rest, ok := strings.CutPrefix(key.Field, "-"); ok {
+			key.Field, key.Desc = rest, true
+		}
+
+		if _, ok := noteFields[key.Field]; !ok {
+			return nil, &QueryError{Param: param, Message: fmt.Sprintf("unknown sort field %q", key.Field)}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func parseFieldValue(kind fieldKind, raw string) (any, error) {
+	switch kind {
+	case kindUint:
+		v, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a non-negative integer", raw)
+		}
+		return v, nil
+	case kindBool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", raw)
+		}
+		return v, nil
+	case kindTime:
+		v, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an RFC 3339 time", raw)
+		}
+		return v, nil
+	default:
+		return raw, nil
+	}
+}
+
+func validateQuery(q ListQuery) error {
+	for _, f := range q.Filters {
+		field, err := lookupField(f.Field, f.Field, f.Op)
+		if err != nil {
+			return err
+		}
+		if !field.kind.accepts(f.Value) {
+			return &QueryError{Param: f.Field, Message: fmt.Sprintf("value of type %T does not fit the field", f.Value)}
+		}
+	}
+	for _, key := range q.Sort {
+		if _, ok := noteFields[key.Field]; !ok {
+			return &QueryError{Param: "sort", Message: fmt.Sprintf("unknown sort field %q", key.Field)}
+		}
+	}
+	return nil
+}
+
+func (k fieldKind) accepts(value any) bool {
+	switch value.(type) {
+	case uint64:
+		return k == kindUint
+	case bool:
+		return k == kindBool
+	case string:
+		return k == kindString
+	case time.Time:
+		return k == kindTime
+	default:
+		return false
+	}
+}
+
+func (f Filter) match(n Note) bool {
+	actual := noteFields[f.Field].value(n)
+	if actual == nil {
+		// A missing value is different from everything and orders nowhere.
+		return f.Op == OpNe
+	}
+
+	if f.Op == OpContains {
+		return strings.Contains(strings.ToLower(actual.(string)), strings.ToLower(f.Value.(string)))
+	}
+
+	c := compareValues(actual, f.Value)
+	switch f.Op {
+	case OpEq:
+		return c == 0
+	case OpNe:
+		return c != 0
+	case OpLt:
+		return c < 0
+	case OpLte:
+		return c <= 0
+	case OpGt:
+		return c > 0
+	case OpGte:
+		return c >= 0
+	default:
+		return false
+	}
+}
+
+// compareValues orders values of the same field. Missing values (nil) sort
+// after everything else.
+func compareValues(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	switch a := a.(type) {
+	case uint64:
+		return cmp.Compare(a, b.(uint64))
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		switch {
+		case a == b.(bool):
+			return 0
+		case a:
+			return 1
+		default:
+			return -1
+		}
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	default:
+		return 0
+	}
+}
+
+// withIDTiebreak makes the sort order total, which keyset pagination needs.
+func withIDTiebreak(keys []SortKey) []SortKey {
+	for _, key := range keys {
+		if key.Field == "id" {
+			return keys
+		}
+	}
+	return append(slices.Clip(keys), SortKey{Field: "id"})
+}
+
+func sortSpec(keys []SortKey) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = key.Field
+		if key.Desc {
+			parts[i] = "-" + key.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func compareByKeys(a, b []any, keys []SortKey) int {
+	for i, key := range keys {
+		c := compareValues(a[i], b[i])
+		if key.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func sortValues(n Note, keys []SortKey) []any {
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		values[i] = noteFields[key.Field].value(n)
+	}
+	return values
+}
+
+// cursor points just past the last note of a page. It remembers the sort
+// order and the sort values of that note, so deleting or editing the note
+// does not lose the position. Clients only see it as an opaque string.
+type cursor struct {
+	Sort   string            `json:"sort"`
+	Values []json.RawMessage `json:"values"`
+}
+
+func encodeCursor(keys []SortKey, values []any) string {
+	c := cursor{Sort: sortSpec(keys)}
+	for _, v := range values {
+		raw, _ := json.Marshal(v)
+		c.Values = append(c.Values, raw)
+	}
+
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string, keys []SortKey) ([]any, error) {
+	var c cursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != sortSpec(keys) || len(c.Values) != len(keys) {
+		return nil, fmt.Errorf("%w: it was issued for a different sort order", ErrInvalidCursor)
+	}
+
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		if string(c.Values[i]) == "null" {
+			continue
+		}
+
+		var v any
+		switch noteFields[key.Field].kind {
+		case kindUint:
+			var u uint64
+			err = json.Unmarshal(c.Values[i], &u)
+			v = u
+		case kindBool:
+			var b bool
+			err = json.Unmarshal(c.Values[i], &b)
+			v = b
+		case kindTime:
+			var t time.Time
+			err = json.Unmarshal(c.Values[i], &t)
+			v = t
+		default:
+			var s string
+			err = json.Unmarshal(c.Values[i], &s)
+			v = s
+		}
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// selectPage filters, sorts and slices notes according to q.
+func selectPage(notes []Note, q ListQuery) (NotePage, error) {
+	if err := validateQuery(q); err != nil {
+		return NotePage{}, err
+	}
+
+	keys := withIDTiebreak(q.Sort)
+
+	var after []any
+	if q.Cursor != "" {
+		var err error
+		if after, err = decodeCursor(q.Cursor, keys); err != nil {
+			return NotePage{}, err
+		}
+	}
+
+	type row struct {
+		note   Note
+		values []any
+	}
+	rows := make([]row, 0, len(notes))
+	for _, n := range notes {
+		if !matchAll(n, q.Filters) {
+			continue
+		}
+		r := row{note: n, values: sortValues(n, keys)}
+		if after != nil && compareByKeys(r.values, after, keys) <= 0 {
+			continue
+		}
+		rows = append(rows, r)
+	}
+	slices.SortFunc(rows, func(a, b row) int {
+		return compareByKeys(a.values, b.values, keys)
+	})
+
+	var page NotePage
+	if q.Limit > 0 && len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+		page.NextCursor = encodeCursor(keys, rows[len(rows)-1].values)
+	}
+
+	page.Notes = make([]Note, len(rows))
+	for i, r := range rows {
+		page.Notes[i] = r.note
+	}
+	return page, nil
+}
+
+func matchAll(n Note, filters []Filter) bool {
+	for _, f := range filters {
+		if !f.match(n) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+package repository
+
+import "slices"
+
+// relation is a one-to-many reverse index between note IDs, such as parent to
+// children or list to notes.
+type relation map[uint64]map[uint64]struct{}
+
+func (r relation) add(from, to uint64) {
+	ids, ok := r[from]
+	if !ok {
+		ids = make(map[uint64]struct{})
+		r[from] = ids
+	}
+	ids[to] = struct{}{}
+}
+
+func (r relation) remove(from, to uint64) {
+	if ids, ok := r[from]; ok {
+		delete(ids, to)
+		if len(ids) == 0 {
+			delete(r, from)
+		}
+	}
+}
+
+// sorted returns the IDs related to from in ascending order.
+func (r relation) sorted(from uint64) []uint64 {
+	ids := make([]uint64, 0, len(r[from]))
+	for id := range r[from] {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 type NoteRepository interface {
@@ -11,20 +12,76 @@ type NoteRepository interface {
 	GetAll(ctx context.Context) ([]Note, error)
 	Update(ctx context.Context, id uint64, dto NoteDTO) (Note, error)
 	Delete(ctx context.Context, id uint64) error
+	UpdateIfMatch(ctx context.Context, id uint64, version uint64, dto NoteDTO) (Note, error)
+	DeleteIfMatch(ctx context.Context, id uint64, version uint64) error
+	Patch(ctx context.Context, id uint64, version uint64, patch NotePatch) (Note, error)
+	List(ctx context.Context, q ListQuery) (NotePage, error)
+	Search(ctx context.Context, q SearchQuery) ([]SearchHit, error)
+	Agenda(ctx context.Context, loc *time.Location) (Agenda, error)
+	Children(ctx context.Context, id uint64) ([]Note, error)
+	Tree(ctx context.Context, id uint64) (NoteTree, error)
+	DeleteWithChildren(ctx context.Context, id uint64, version uint64, mode DeleteMode) error
+	ExecutionOrder(ctx context.Context) ([]Note, error)
+	Unblocked(ctx context.Context) ([]Note, error)
+	Revisions(ctx context.Context, id uint64) ([]Revision, error)
+	Revision(ctx context.Context, id uint64, rev uint64) (Revision, error)
+	Revert(ctx context.Context, id uint64, version uint64, rev uint64) (Note, error)
+	Batch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error)
+	WithTx(ctx context.Context, fn func(tx NoteTx) error) error
 }
 
+// AnyVersion passed to the *IfMatch methods skips the version check.
+const AnyVersion uint64 = 0
+
 type Note struct {
-	ID          uint64 `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Done        bool   `json:"done"`
+	ID          uint64     `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Done        bool       `json:"done"`
+	Version     uint64     `json:"version"`
+	CreatedAt   time.Time  `json:"created_at,omitzero"`
+	UpdatedAt   time.Time  `json:"updated_at,omitzero"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Overdue     bool       `json:"overdue,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	ParentID    *uint64    `json:"parent_id,omitempty"`
+	Progress    *Progress  `json:"progress,omitempty"`
+	BlockedBy   []uint64   `json:"blocked_by,omitempty"`
+	Blocked     bool       `json:"blocked,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+	Occurrence  int        `json:"occurrence,omitempty"`
+	NextID      *uint64    `json:"next_id,omitempty"`
+	ListID      *uint64    `json:"list_id,omitempty"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
 }
 
 type NoteDTO struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Done        bool   `json:"done"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Done        bool       `json:"done"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	ParentID    *uint64    `json:"parent_id,omitempty"`
+	BlockedBy   []uint64   `json:"blocked_by,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`
+	ListID      *uint64    `json:"list_id,omitempty"`
+}
+
+// NotePatch holds a partial update: nil fields are left unchanged. For
+// optional fields a pointer to nil removes the value.
+type NotePatch struct {
+	Title       *string
+	Description *string
+	Done        *bool
+	DueAt       **time.Time
+	Tags        *[]string
+	ParentID    **uint64
+	BlockedBy   *[]uint64
+	Recurrence  *string
+	ListID      **uint64
 }
 
 var ErrNotFoundID error = errors.New("note by ID not found")
 var ErrTitleNotDefined error = errors.New("title is required field")
+var ErrVersionMismatch error = errors.New("note version does not match")
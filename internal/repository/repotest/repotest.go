@@ -0,0 +1,162 @@
+// Package repotest holds conformance tests that every NoteRepository
+// implementation is expected to pass.
+package repotest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+// TestTenantIsolation checks that notes written for one tenant are invisible
+// to every other tenant, including the default one, and that each tenant has
+// its own ID space. newRepo must return an empty repository.
+func TestTenantIsolation(t *testing.T, newRepo func(t *testing.T) repository.NoteRepository) {
+	alice := repository.WithTenant(context.Background(), "alice")
+	bob := repository.WithTenant(context.Background(), "bob")
+
+	// setup gives alice notes 1 <- 2 (2 is a subtask of 1 and blocked by it)
+	// and bob a single note 1.
+	setup := func(t *testing.T) repository.NoteRepository {
+		t.Helper()
+
+		repo := newRepo(t)
+		due := time.Now().Add(-time.Hour)
+		first, err := repo.Create(alice, repository.NoteDTO{Title: "alice milk", DueAt: &due, Tags: []string{"home"}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := repo.Create(alice, repository.NoteDTO{Title: "alice bread", ParentID: &first.ID, BlockedBy: []uint64{first.ID}}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := repo.Create(bob, repository.NoteDTO{Title: "bob milk"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return repo
+	}
+
+	t.Run("separate id spaces", func(t *testing.T) {
+		repo := newRepo(t)
+
+		for _, ctx := range []context.Context{alice, bob, context.Background()} {
+			note, err := repo.Create(ctx, repository.NoteDTO{Title: "first"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if note.ID != 1 {
+				t.Errorf("id of first note in %s: expected 1, got %d", repository.TenantFrom(ctx), note.ID)
+			}
+		}
+	})
+
+	t.Run("reads", func(t *testing.T) {
+		repo := setup(t)
+
+		if _, err := repo.GetByID(bob, 2); !errors.Is(err, repository.ErrNotFoundID) {
+			t.Errorf("get other tenant's note: expected %v, got %v", repository.ErrNotFoundID, err)
+		}
+		note, err := repo.GetByID(bob, 1)
+		if err != nil || note.Title != "bob milk" {
+			t.Errorf("get own note: expected %q, got %q (%v)", "bob milk", note.Title, err)
+		}
+
+		all, _ := repo.GetAll(bob)
+		if len(all) != 1 || all[0].Title != "bob milk" {
+			t.Errorf("get all: expected only bob's note, got %+v", all)
+		}
+		if all, _ := repo.GetAll(context.Background()); len(all) != 0 {
+			t.Errorf("get all for default tenant: expected nothing, got %+v", all)
+		}
+
+		page, _ := repo.List(bob, repository.ListQuery{Tags: [][]string{{"home"}}})
+		if len(page.Notes) != 0 {
+			t.Errorf("list by other tenant's tag: expected nothing, got %+v", page.Notes)
+		}
+
+		hits, _ := repo.Search(bob, repository.SearchQuery{Text: "milk"})
+		if len(hits) != 1 || hits[0].Note.Title != "bob milk" {
+			t.Errorf("search: expected only bob's note, got %+v", hits)
+		}
+
+		agenda, _ := repo.Agenda(bob, time.UTC)
+		if len(agenda.Overdue)+len(agenda.Today)+len(agenda.ThisWeek)+len(agenda.Later) != 0 {
+			t.Errorf("agenda: expected nothing, got %+v", agenda)
+		}
+
+		if children, _ := repo.Children(bob, 1); len(children) != 0 {
+			t.Errorf("children: expected nothing, got %+v", children)
+		}
+		if _, err := repo.Tree(bob, 2); !errors.Is(err, repository.ErrNotFoundID) {
+			t.Errorf("tree of other tenant's note: expected %v, got %v", repository.ErrNotFoundID, err)
+		}
+
+		order, _ := repo.ExecutionOrder(bob)
+		unblocked, _ := repo.Unblocked(bob)
+		for _, notes := range [][]repository.Note{order, unblocked} {
+			if len(notes) != 1 || notes[0].Title != "bob milk" {
+				t.Errorf("dependency view: expected only bob's note, got %+v", notes)
+			}
+		}
+	})
+
+	t.Run("writes", func(t *testing.T) {
+		repo := setup(t)
+
+		title := "stolen"
+		writes := map[string]func() error{
+			"update": func() error {
+				_, err := repo.Update(bob, 2, repository.NoteDTO{Title: title})
+				return err
+			},
+			"patch": func() error {
+				_, err := repo.Patch(bob, 2, repository.AnyVersion, repository.NotePatch{Title: &title})
+				return err
+			},
+			"delete": func() error {
+				return repo.Delete(bob, 2)
+			},
+			"delete with children": func() error {
+				return repo.DeleteWithChildren(bob, 2, repository.AnyVersion, repository.DeleteCascade)
+			},
+		}
+		for name, write := range writes {
+			if err := write(); !errors.Is(err, repository.ErrNotFoundID) {
+				t.Errorf("%s of other tenant's note: expected %v, got %v", name, repository.ErrNotFoundID, err)
+			}
+		}
+
+		note, err := repo.GetByID(alice, 2)
+		if err != nil || note.Title != "alice bread" || note.Version != 1 {
+			t.Errorf("alice's note changed: got %+v (%v)", note, err)
+		}
+
+		// Alice's note 2 cannot be referenced by bob as a parent or a blocker.
+		parent := uint64(2)
+		if _, err := repo.Create(bob, repository.NoteDTO{Title: "child", ParentID: &parent}); !errors.Is(err, repository.ErrParentNotFound) {
+			t.Errorf("parent from other tenant: expected %v, got %v", repository.ErrParentNotFound, err)
+		}
+		if _, err := repo.Create(bob, repository.NoteDTO{Title: "blocked", BlockedBy: []uint64{2}}); !errors.Is(err, repository.ErrBlockerNotFound) {
+			t.Errorf("blocker from other tenant: expected %v, got %v", repository.ErrBlockerNotFound, err)
+		}
+
+		if err := repo.Delete(bob, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		all, _ := repo.GetAll(alice)
+		if ids := noteIDs(all); !slices.Equal(ids, []uint64{1, 2}) {
+			t.Errorf("alice's notes after bob's delete: expected [1 2], got %v", ids)
+		}
+	})
+}
+
+func noteIDs(notes []repository.Note) []uint64 {
+	ids := make([]uint64, len(notes))
+	for i, n := range notes {
+		ids[i] = n.ID
+	}
+	return ids
+}
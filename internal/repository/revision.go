@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+var ErrRevisionNotFound error = errors.New("revision not found")
+
+// DefaultRevisionLimit is how many versions of a note are kept unless
+// WithRevisionLimit says otherwise.
+const DefaultRevisionLimit = 50
+
+// Revision is one version of a note. Rev equals the version of the note.
+// ChangedBy is the actor given by the caller and is not verified.
+type Revision struct {
+	Rev       uint64    `json:"rev"`
+	ChangedAt time.Time `json:"changed_at"`
+	ChangedBy string    `json:"changed_by,omitempty"`
+	Note      Note      `json:"note"`
+}
+
+// WithRevisionLimit sets how many versions of a note are kept, the current
+// one included. Older versions are dropped.
+func WithRevisionLimit(limit int) Option {
+	return func(db *InMemoryDataBase) {
+		db.revisionLimit = max(limit, 1)
+	}
+}
+
+type actorKey struct{}
+
+// WithActor names who makes the changes done with ctx. The name ends up in
+// the revision history.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set by WithActor, if any.
+func ActorFrom(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// record adds n to the history of its note, keeping at most limit versions.
+// Callers must hold db.mu.
+func (t *tenant) record(n Note, actor string, limit int) {
+	history := append(t.revisions[n.ID], Revision{Rev: n.Version, ChangedAt: n.UpdatedAt, ChangedBy: actor, Note: n})
+	if len(history) > limit {
+		history = slices.Delete(history, 0, len(history)-limit)
+	}
+	t.revisions[n.ID] = history
+}
+
+// sortedRevisions returns the history of all notes ordered by note ID and
+// revision. Callers must hold db.mu.
+func (t *tenant) sortedRevisions() []Revision {
+	var res []Revision
+	for _, history := range t.revisions {
+		res = append(res, history...)
+	}
+	slices.SortFunc(res, func(a, b Revision) int {
+		if c := cmp.Compare(a.Note.ID, b.Note.ID); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Rev, b.Rev)
+	})
+	return res
+}
+
+// Revisions returns the kept versions of a note, oldest first.
+func (db *InMemoryDataBase) Revisions(ctx context.Context, id uint64) ([]Revision, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.notes[id]; !ok {
+		return nil, ErrNotFoundID
+	}
+	return slices.Clone(t.revisions[id]), nil
+}
+
+func (db *InMemoryDataBase) Revision(ctx context.Context, id uint64, rev uint64) (Revision, error) {
+	select {
+	case <-ctx.Done():
+		return Revision{}, ctx.Err()
+	default:
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.notes[id]; !ok {
+		return Revision{}, ErrNotFoundID
+	}
+	i := slices.IndexFunc(t.revisions[id], func(r Revision) bool { return r.Rev == rev })
+	if i < 0 {
+		return Revision{}, ErrRevisionNotFound
+	}
+	return t.revisions[id][i], nil
+}
+
+// Revert sets the note back to the content it had in revision rev. The
+// result is a new version of the note, validated like any other update.
+func (db *InMemoryDataBase) Revert(ctx context.Context, id uint64, version uint64, rev uint64) (Note, error) {
+	r, err := db.Revision(ctx, id, rev)
+	if err != nil {
+		return Note{}, err
+	}
+
+	old := r.Note
+	return db.modify(ctx, id, version, func(n *Note) error {
+		n.Title = old.Title
+		n.Description = old.Description
+		n.Done = old.Done
+		n.DueAt = old.DueAt
+		n.Tags = slices.Clone(old.Tags)
+		n.ParentID = old.ParentID
+		n.BlockedBy = slices.Clone(old.BlockedBy)
+		n.Recurrence = old.Recurrence
+		n.ListID = old.ListID
+		return nil
+	})
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func revs(history []Revision) []uint64 {
+	res := make([]uint64, len(history))
+	for i, r := range history {
+		res[i] = r.Rev
+	}
+	return res
+}
+
+func TestRevisions(t *testing.T) {
+	repo := NewInMemoryDataBase(WithRevisionLimit(3))
+	alice := WithActor(context.Background(), "alice")
+
+	note, _ := repo.Create(context.Background(), NoteDTO{Title: "v1"})
+	repo.Update(alice, note.ID, NoteDTO{Title: "v2", Tags: []string{"home"}})
+	title := "v3"
+	repo.Patch(context.Background(), note.ID, AnyVersion, NotePatch{Title: &title})
+
+	history, err := repo.Revisions(context.Background(), note.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r := revs(history); !slices.Equal(r, []uint64{1, 2, 3}) {
+		t.Errorf("revisions: expected [1 2 3], got %v", r)
+	}
+	if history[1].ChangedBy != "alice" || history[1].Note.Title != "v2" {
+		t.Errorf("revision 2: expected v2 by alice, got %q by %q", history[1].Note.Title, history[1].ChangedBy)
+	}
+
+	reverted, err := repo.Revert(context.Background(), note.ID, AnyVersion, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reverted.Title != "v2" || reverted.Version != 4 || !slices.Equal(reverted.Tags, []string{"home"}) {
+		t.Errorf("revert: expected v2 with tag home at version 4, got %+v", reverted)
+	}
+
+	history, _ = repo.Revisions(context.Background(), note.ID)
+	if r := revs(history); !slices.Equal(r, []uint64{2, 3, 4}) {
+		t.Errorf("revisions after revert: expected [2 3 4], got %v", r)
+	}
+
+	if _, err := repo.Revision(context.Background(), note.ID, 1); !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("dropped revision: expected %v, got %v", ErrRevisionNotFound, err)
+	}
+	if _, err := repo.Revert(context.Background(), note.ID, 3, 2); !errors.Is(err, ErrVersionMismatch) {
+		t.Errorf("revert stale version: expected %v, got %v", ErrVersionMismatch, err)
+	}
+	if _, err := repo.Revisions(context.Background(), 42); !errors.Is(err, ErrNotFoundID) {
+		t.Errorf("missing note: expected %v, got %v", ErrNotFoundID, err)
+	}
+}
+
+func TestRevisionsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	alice := WithActor(context.Background(), "alice")
+
+	repo, err := OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	note, _ := repo.Create(context.Background(), NoteDTO{Title: "v1"})
+	repo.Update(alice, note.ID, NoteDTO{Title: "v2"})
+	repo.Compact(context.Background())
+	repo.Update(context.Background(), note.ID, NoteDTO{Title: "v3"})
+	repo.Close()
+
+	repo, err = OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer repo.Close()
+
+	history, _ := repo.Revisions(context.Background(), note.ID)
+	if r := revs(history); !slices.Equal(r, []uint64{1, 2, 3}) {
+		t.Errorf("revisions: expected [1 2 3], got %v", r)
+	}
+	if len(history) == 3 && (history[1].ChangedBy != "alice" || history[2].Note.Title != "v3") {
+		t.Errorf("revisions: unexpected %+v", history)
+	}
+}
@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRecurrence error = errors.New("invalid recurrence rule")
+var ErrRecurrenceNeedsDue error = errors.New("recurring note must have a due date")
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+)
+
+// Rule is the supported subset of an iCalendar RRULE (RFC 5545): FREQ,
+// INTERVAL, BYDAY without ordinals for weekly rules, and COUNT or UNTIL.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	ByDay    []time.Weekday
+	Count    int
+	Until    *time.Time
+}
+
+var weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+const untilLayout = "20060102T150405Z"
+
+// maxInterval bounds INTERVAL, which is far beyond any useful rule.
+const maxInterval = 1000
+
+// ParseRule parses a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR" and
+// reports the first unsupported or malformed part.
+func ParseRule(s string) (Rule, error) {
+	var r Rule
+
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	if s == "" {
+		return r, fmt.Errorf("%w: rule is empty", ErrInvalidRecurrence)
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return r, fmt.Errorf("%w: %q is not NAME=VALUE", ErrInvalidRecurrence, part)
+		}
+		if seen[name] {
+			return r, fmt.Errorf("%w: %s is given twice", ErrInvalidRecurrence, name)
+		}
+		seen[name] = true
+
+		switch name {
+		case "FREQ":
+			r.Freq = Frequency(value)
+			if !slices.Contains([]Frequency{Daily, Weekly, Monthly}, r.Freq) {
+				return r, fmt.Errorf("%w: FREQ=%s is not supported, use DAILY, WEEKLY or MONTHLY", ErrInvalidRecurrence, value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("%w: INTERVAL must be a positive integer", ErrInvalidRecurrence)
+			}
+			if n > maxInterval {
+				return r, fmt.Errorf("%w: INTERVAL must not exceed %d", ErrInvalidRecurrence, maxInterval)
+			}
+			r.Interval = n
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day := slices.Index(weekdayCodes, code)
+				if day < 0 {
+					return r, fmt.Errorf("%w: BYDAY=%s is not supported, use two-letter day codes without ordinals", ErrInvalidRecurrence, code)
+				}
+				r.ByDay = append(r.ByDay, time.Weekday(day))
+			}
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("%w: COUNT must be a positive integer", ErrInvalidRecurrence)
+			}
+			r.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return r, fmt.Errorf("%w: UNTIL must look like 20250131 or 20250131T235959Z", ErrInvalidRecurrence)
+			}
+			r.Until = &until
+		default:
+			return r, fmt.Errorf("%w: %s is not supported", ErrInvalidRecurrence, name)
+		}
+	}
+
+	switch {
+	case r.Freq == "":
+		return r, fmt.Errorf("%w: FREQ is required", ErrInvalidRecurrence)
+	case r.Count > 0 && r.Until != nil:
+		return r, fmt.Errorf("%w: COUNT and UNTIL cannot be used together", ErrInvalidRecurrence)
+	case len(r.ByDay) > 0 && r.Freq != Weekly:
+		return r, fmt.Errorf("%w: BYDAY is only supported with FREQ=WEEKLY", ErrInvalidRecurrence)
+	}
+	if r.Interval == 0 {
+		r.Interval = 1
+	}
+	slices.Sort(r.ByDay)
+	r.ByDay = slices.Compact(r.ByDay)
+
+	return r, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	if len(value) == len("20060102") {
+		// A date without time covers the whole day.
+		t, err := time.Parse("20060102", value)
+		return t.Add(24*time.Hour - time.Second), err
+	}
+	return time.Parse(untilLayout, value)
+}
+
+// String returns the rule in canonical form, which is how it is stored.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			codes[i] = weekdayCodes[day]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayout))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the occurrence that follows the one due at due, which is the
+// occurrence-th of the series. The time of day and the location of due are
+// kept. It reports false when the series is over.
+func (r Rule) Next(due time.Time, occurrence int) (time.Time, bool) {
+	if r.Count > 0 && occurrence >= r.Count {
+		return time.Time{}, false
+	}
+
+	var next time.Time
+	switch r.Freq {
+	case Daily:
+		next = due.AddDate(0, 0, r.Interval)
+	case Weekly:
+		next = r.nextWeekly(due)
+	case Monthly:
+		next = r.nextMonthly(due)
+	}
+
+	if r.Until != nil && next.After(*r.Until) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+func (r Rule) nextWeekly(due time.Time) time.Time {
+	if len(r.ByDay) == 0 {
+		return due.AddDate(0, 0, 7*r.Interval)
+	}
+
+	// Weeks start on Monday, as with the default WKST=MO. Leaving the week of
+	// due jumps straight to the week Interval weeks later, so at most two
+	// weeks are scanned.
+	next := due
+	for {
+		next = next.AddDate(0, 0, 1)
+		if next.Weekday() == time.Monday {
+			next = next.AddDate(0, 0, 7*(r.Interval-1))
+		}
+		if slices.Contains(r.ByDay, next.Weekday()) {
+			return next
+		}
+	}
+}
+
+// nextMonthly skips months that do not have the day of due, so a rule
+// started on the 31st only fires on the 31st.
+func (r Rule) nextMonthly(due time.Time) time.Time {
+	for months := r.Interval; ; months += r.Interval {
+		next := time.Date(due.Year(), due.Month()+time.Month(months), due.Day(),
+			due.Hour(), due.Minute(), due.Second(), due.Nanosecond(), due.Location())
+		if next.Day() == due.Day() {
+			return next
+		}
+	}
+}
+
+// setRecurrence validates and normalizes the rule of n and numbers its first
+// occurrence.
+func setRecurrence(n *Note) (*Rule, error) {
+	if n.Recurrence == "" {
+		n.Occurrence = 0
+		return nil, nil
+	}
+
+	rule, err := ParseRule(n.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	if n.DueAt == nil {
+		return nil, ErrRecurrenceNeedsDue
+	}
+
+	n.Recurrence = rule.String()
+	if n.Occurrence == 0 {
+		n.Occurrence = 1
+	}
+	return &rule, nil
+}
+
+// nextOccurrence builds the note that follows n in its series. Callers must
+// hold db.mu.
+func (t *tenant) nextOccurrence(n Note, rule Rule) (Note, bool) {
+	due, ok := rule.Next(*n.DueAt, n.Occurrence)
+	if !ok {
+		return Note{}, false
+	}
+
+	now := t.now()
+	return Note{
+		ID:          t.idGen.Add(1),
+		Title:       n.Title,
+		Description: n.Description,
+		Version:     1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		DueAt:       &due,
+		Tags:        n.Tags,
+		ParentID:    n.ParentID,
+		ListID:      n.ListID,
+		Recurrence:  n.Recurrence,
+		Occurrence:  n.Occurrence + 1,
+	}, true
+}
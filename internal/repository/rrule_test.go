@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRule(t *testing.T) {
+	testTable := []struct {
+		name   string
+		rule   string
+		exp    string
+		expErr string
+	}{
+		{name: "daily", rule: "FREQ=DAILY", exp: "FREQ=DAILY"},
+		{name: "prefix and case", rule: "rrule:freq=weekly;byday=fr,mo,mo;interval=2", exp: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR"},
+		{name: "count", rule: "FREQ=MONTHLY;COUNT=3;INTERVAL=1", exp: "FREQ=MONTHLY;COUNT=3"},
+		{name: "until date", rule: "FREQ=DAILY;UNTIL=20250131", exp: "FREQ=DAILY;UNTIL=20250131T235959Z"},
+		{name: "empty", rule: " ", expErr: "rule is empty"},
+		{name: "no freq", rule: "INTERVAL=2", expErr: "FREQ is required"},
+		{name: "yearly", rule: "FREQ=YEARLY", expErr: "FREQ=YEARLY is not supported, use DAILY, WEEKLY or MONTHLY"},
+		{name: "unsupported part", rule: "FREQ=MONTHLY;BYMONTHDAY=1", expErr: "BYMONTHDAY is not supported"},
+		{name: "ordinal day", rule: "FREQ=WEEKLY;BYDAY=1MO", expErr: "BYDAY=1MO is not supported, use two-letter day codes without ordinals"},
+		{name: "byday with daily", rule: "FREQ=DAILY;BYDAY=MO", expErr: "BYDAY is only supported with FREQ=WEEKLY"},
+		{name: "zero interval", rule: "FREQ=DAILY;INTERVAL=0", expErr: "INTERVAL must be a positive integer"},
+		{name: "huge interval", rule: "FREQ=WEEKLY;INTERVAL=1000000000;BYDAY=MO", expErr: "INTERVAL must not exceed 1000"},
+		{name: "count and until", rule: "FREQ=DAILY;COUNT=2;UNTIL=20250131", expErr: "COUNT and UNTIL cannot be used together"},
+		{name: "bad until", rule: "FREQ=DAILY;UNTIL=2025-01-31", expErr: "UNTIL must look like 20250131 or 20250131T235959Z"},
+		{name: "twice", rule: "FREQ=DAILY;FREQ=WEEKLY", expErr: "FREQ is given twice"},
+		{name: "malformed", rule: "FREQ=DAILY;COUNT", expErr: `"COUNT" is not NAME=VALUE`},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			rule, err := ParseRule(testCase.rule)
+			if testCase.expErr != "" {
+				if !errors.Is(err, ErrInvalidRecurrence) || !strings.HasSuffix(err.Error(), testCase.expErr) {
+					t.Errorf("error: expected %q, got %v", testCase.expErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s := rule.String(); s != testCase.exp {
+				t.Errorf("rule: expected %v, got %v", testCase.exp, s)
+			}
+		})
+	}
+}
+
+func TestRuleNext(t *testing.T) {
+	// 2025-01-31 is a Friday.
+	due := time.Date(2025, 1, 31, 9, 30, 0, 0, time.UTC)
+
+	testTable := []struct {
+		name       string
+		rule       string
+		occurrence int
+		exp        time.Time
+		expOK      bool
+	}{
+		{name: "daily", rule: "FREQ=DAILY;INTERVAL=3", occurrence: 1, exp: time.Date(2025, 2, 3, 9, 30, 0, 0, time.UTC), expOK: true},
+		{name: "weekly", rule: "FREQ=WEEKLY", occurrence: 1, exp: time.Date(2025, 2, 7, 9, 30, 0, 0, time.UTC), expOK: true},
+		{name: "weekly by day", rule: "FREQ=WEEKLY;BYDAY=MO,FR", occurrence: 1, exp: time.Date(2025, 2, 3, 9, 30, 0, 0, time.UTC), expOK: true},
+		{name: "every other week", rule: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", occurrence: 1, exp: time.Date(2025, 2, 10, 9, 30, 0, 0, time.UTC), expOK: true},
+		{name: "longest interval", rule: "FREQ=WEEKLY;INTERVAL=1000;BYDAY=TU", occurrence: 1, exp: time.Date(2025, 1, 31, 9, 30, 0, 0, time.UTC).AddDate(0, 0, 4+7*999), expOK: true},
+		{name: "monthly skips short months", rule: "FREQ=MONTHLY", occurrence: 1, exp: time.Date(2025, 3, 31, 9, 30, 0, 0, time.UTC), expOK: true},
+		{name: "count reached", rule: "FREQ=DAILY;COUNT=2", occurrence: 2},
+		{name: "count not reached", rule: "FREQ=DAILY;COUNT=2", occurrence: 1, exp: time.Date(2025, 2, 1, 9, 30, 0, 0, time.UTC), expOK: true},
+		{name: "until passed", rule: "FREQ=WEEKLY;UNTIL=20250206", occurrence: 1},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			rule, err := ParseRule(testCase.rule)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			next, ok := rule.Next(due, testCase.occurrence)
+			if ok != testCase.expOK || !next.Equal(testCase.exp) {
+				t.Errorf("next: expected %v %v, got %v %v", testCase.exp, testCase.expOK, next, ok)
+			}
+		})
+	}
+}
+
+func TestRecurringNote(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	due := time.Date(2025, 1, 31, 9, 30, 0, 0, time.UTC)
+	done := true
+
+	if _, err := repo.Create(context.Background(), NoteDTO{Title: "t", Recurrence: "FREQ=DAILY"}); !errors.Is(err, ErrRecurrenceNeedsDue) {
+		t.Errorf("create without due: expected %v, got %v", ErrRecurrenceNeedsDue, err)
+	}
+
+	first, err := repo.Create(context.Background(), NoteDTO{Title: "chores", Tags: []string{"home"}, DueAt: &due, Recurrence: "freq=weekly;count=2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.Recurrence != "FREQ=WEEKLY;COUNT=2" || first.Occurrence != 1 {
+		t.Errorf("create: expected normalized rule and first occurrence, got %+v", first)
+	}
+
+	completed, err := repo.Patch(context.Background(), first.ID, AnyVersion, NotePatch{Done: &done})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if completed.NextID == nil {
+		t.Fatalf("done: next occurrence was not created")
+	}
+	second, _ := repo.GetByID(context.Background(), *completed.NextID)
+	if second.Title != "chores" || second.Done || second.Occurrence != 2 || !second.DueAt.Equal(due.AddDate(0, 0, 7)) || len(second.Tags) != 1 {
+		t.Errorf("next occurrence: unexpected note %+v", second)
+	}
+
+	undone := false
+	repo.Patch(context.Background(), first.ID, AnyVersion, NotePatch{Done: &undone})
+	repo.Patch(context.Background(), first.ID, AnyVersion, NotePatch{Done: &done})
+	notes, _ := repo.GetAll(context.Background())
+	if len(notes) != 2 {
+		t.Errorf("done twice: expected 2 notes, got %d", len(notes))
+	}
+
+	last, _ := repo.Patch(context.Background(), second.ID, AnyVersion, NotePatch{Done: &done})
+	if last.NextID != nil {
+		t.Errorf("last occurrence: unexpected next %d", *last.NextID)
+	}
+}
@@ -0,0 +1,344 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"html"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+var ErrEmptySearch error = errors.New("search query has no words")
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+
+	snippetRadius = 6
+)
+
+type SearchQuery struct {
+	Text  string
+	Limit int
+}
+
+type SearchHit struct {
+	Note       Note              `json:"note"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into lower-cased runs of letters and digits and keeps
+// their byte offsets for highlighting. "ё" is folded into "е", as Russian
+// texts use them interchangeably.
+func tokenize(text string) []token {
+	var tokens []token
+
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{term: normalizeTerm(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{term: normalizeTerm(text[start:]), start: start, end: len(text)})
+	}
+
+	return tokens
+}
+
+var termReplacer = strings.NewReplacer("ё", "е")
+
+func normalizeTerm(s string) string {
+	return termReplacer.Replace(strings.ToLower(s))
+}
+
+// searchIndex is an inverted index over note titles and descriptions. Title
+// and description form one token stream with a gap between them, so phrases
+// never match across the two fields.
+type searchIndex struct {
+	postings map[string]map[uint64][]int
+	docLen   map[uint64]int
+	totalLen int
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[uint64][]int),
+		docLen:   make(map[uint64]int),
+	}
+}
+
+func noteTerms(n Note) []string {
+	var terms []string
+	for _, t := range tokenize(n.Title) {
+		terms = append(terms, t.term)
+	}
+	terms = append(terms, "")
+	for _, t := range tokenize(n.Description) {
+		terms = append(terms, t.term)
+	}
+	return terms
+}
+
+func (idx *searchIndex) add(n Note) {
+	terms := noteTerms(n)
+	for pos, term := range terms {
+		if term == "" {
+			continue
+		}
+		docs, ok := idx.postings[term]
+		if !ok {
+			docs = make(map[uint64][]int)
+			idx.postings[term] = docs
+		}
+		docs[n.ID] = append(docs[n.ID], pos)
+	}
+
+	idx.docLen[n.ID] = len(terms) - 1
+	idx.totalLen += len(terms) - 1
+}
+
+func (idx *searchIndex) remove(n Note) {
+	if _, ok := idx.docLen[n.ID]; !ok {
+		return
+	}
+
+	for _, term := range noteTerms(n) {
+		if docs, ok := idx.postings[term]; ok {
+			delete(docs, n.ID)
+			if len(docs) == 0 {
+				delete(idx.postings, term)
+			}
+		}
+	}
+
+	idx.totalLen -= idx.docLen[n.ID]
+	delete(idx.docLen, n.ID)
+}
+
+// searchClause is one part of a query that a document must match: a single
+// word, a word prefix (word*) or a quoted phrase.
+type searchClause struct {
+	terms  []string
+	prefix bool
+}
+
+func parseSearchQuery(text string) []searchClause {
+	var clauses []searchClause
+
+	for i, part := range strings.Split(text, `"`) {
+		if i%2 == 1 {
+			var phrase []string
+			for _, t := range tokenize(part) {
+				phrase = append(phrase, t.term)
+			}
+			if len(phrase) > 0 {
+				clauses = append(clauses, searchClause{terms: phrase})
+			}
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			prefix := strings.HasSuffix(word, "*")
+			for _, t := range tokenize(word) {
+				clauses = append(clauses, searchClause{terms: []string{t.term}})
+			}
+			if prefix && len(clauses) > 0 && len(clauses[len(clauses)-1].terms) == 1 {
+				clauses[len(clauses)-1].prefix = true
+			}
+		}
+	}
+
+	return clauses
+}
+
+func (idx *searchIndex) bm25(term string, id uint64, tf int) float64 {
+	n := float64(len(idx.docLen))
+	df := float64(len(idx.postings[term]))
+	idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+	avgLen := float64(idx.totalLen) / n
+	norm := 1 - bm25B + bm25B*float64(idx.docLen[id])/avgLen
+	return idf * float64(tf) * (bm25K1 + 1) / (float64(tf) + bm25K1*norm)
+}
+
+// match returns the score of every document matching the clause.
+func (idx *searchIndex) match(c searchClause) map[uint64]float64 {
+	scores := make(map[uint64]float64)
+
+	if c.prefix {
+		for term, docs := range idx.postings {
+			if !strings.HasPrefix(term, c.terms[0]) {
+				continue
+			}
+			for id, positions := range docs {
+				scores[id] = max(scores[id], idx.bm25(term, id, len(positions)))
+			}
+		}
+		return scores
+	}
+
+	first := idx.postings[c.terms[0]]
+	for id, positions := range first {
+		count := 0
+		for _, pos := range positions {
+			if idx.phraseAt(c.terms, id, pos) {
+				count++
+			}
+		}
+		if count == 0 {
+			continue
+		}
+
+		for _, term := range c.terms {
+			scores[id] += idx.bm25(term, id, count)
+		}
+	}
+	return scores
+}
+
+func (idx *searchIndex) phraseAt(terms []string, id uint64, pos int) bool {
+	for i, term := range terms[1:] {
+		if !slices.Contains(idx.postings[term][id], pos+i+1) {
+			return false
+		}
+	}
+	return true
+}
+
+// search ranks documents matching every clause by the sum of their BM25
+// scores.
+func (idx *searchIndex) search(clauses []searchClause) map[uint64]float64 {
+	var total map[uint64]float64
+	for _, c := range clauses {
+		scores := idx.match(c)
+		if total == nil {
+			total = scores
+			continue
+		}
+		for id := range total {
+			if s, ok := scores[id]; ok {
+				total[id] += s
+			} else {
+				delete(total, id)
+			}
+		}
+	}
+	return total
+}
+
+// highlight wraps words matching the query in <mark> and cuts long texts
+// down to a window around the first match. The rest of the text is escaped
+// as HTML. It returns an empty string when nothing matches.
+func highlight(text string, clauses []searchClause) string {
+	tokens := tokenize(text)
+
+	var marked []int
+	for i, t := range tokens {
+		for _, c := range clauses {
+			if (c.prefix && strings.HasPrefix(t.term, c.terms[0])) || (!c.prefix && slices.Contains(c.terms, t.term)) {
+				marked = append(marked, i)
+				break
+			}
+		}
+	}
+	if len(marked) == 0 {
+		return ""
+	}
+
+	from, to := 0, len(tokens)-1
+	if len(tokens) > 2*snippetRadius+1 {
+		from = max(marked[0]-snippetRadius, 0)
+		to = min(from+2*snippetRadius, len(tokens)-1)
+	}
+
+	start, end := 0, len(text)
+	var b strings.Builder
+	if from > 0 {
+		start = tokens[from].start
+		b.WriteString("…")
+	}
+	if to < len(tokens)-1 {
+		end = tokens[to].end
+	}
+
+	pos := start
+	for _, i := range marked {
+		if i < from || i > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(text[pos:tokens[i].start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[tokens[i].start:tokens[i].end]))
+		b.WriteString("</mark>")
+		pos = tokens[i].end
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
+
+func (db *InMemoryDataBase) Search(ctx context.Context, q SearchQuery) ([]SearchHit, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	clauses := parseSearchQuery(q.Text)
+	if len(clauses) == 0 {
+		return nil, ErrEmptySearch
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	scores := t.index.search(clauses)
+
+	p := t.presenter()
+	hits := make([]SearchHit, 0, len(scores))
+	for id, score := range scores {
+		n := p.present(t.notes[id])
+		hit := SearchHit{Note: n, Score: score, Highlights: make(map[string]string)}
+		if s := highlight(n.Title, clauses); s != "" {
+			hit.Highlights["title"] = s
+		}
+		if s := highlight(n.Description, clauses); s != "" {
+			hit.Highlights["description"] = s
+		}
+		hits = append(hits, hit)
+	}
+
+	slices.SortFunc(hits, func(a, b SearchHit) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Note.ID, b.Note.ID)
+	})
+	if q.Limit > 0 && len(hits) > q.Limit {
+		hits = hits[:q.Limit]
+	}
+
+	return hits, nil
+}
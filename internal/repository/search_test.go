@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	repo.Create(context.Background(), NoteDTO{Title: "Купить молоко", Description: "В магазине у дома"})
+	repo.Create(context.Background(), NoteDTO{Title: "Молоко и хлеб", Description: "молоко обязательно, хлеб по желанию"})
+	repo.Create(context.Background(), NoteDTO{Title: "Позвонить маме", Description: "Спросить про ёлку"})
+	repo.Create(context.Background(), NoteDTO{Title: "Buy milk", Description: "Milkshake <b>too</b>"})
+	repo.Create(context.Background(), NoteDTO{Title: "Разобрать почту", Description: "магазин прислал счет"})
+
+	testTable := []struct {
+		name   string
+		query  string
+		expErr error
+		expIDs []uint64
+	}{
+		{
+			name:   "single word ranked by frequency",
+			query:  "молоко",
+			expIDs: []uint64{2, 1},
+		},
+		{
+			name:   "all words must match",
+			query:  "молоко магазине",
+			expIDs: []uint64{1},
+		},
+		{
+			name:   "case and yo folding",
+			query:  "ЕЛКУ",
+			expIDs: []uint64{3},
+		},
+		{
+			name:   "prefix ranks shorter note higher",
+			query:  "магаз*",
+			expIDs: []uint64{5, 1},
+		},
+		{
+			name:   "phrase",
+			query:  `"купить молоко"`,
+			expIDs: []uint64{1},
+		},
+		{
+			name:   "phrase does not cross fields",
+			query:  `"хлеб молоко"`,
+			expIDs: []uint64{},
+		},
+		{
+			name:   "latin prefix",
+			query:  "milk*",
+			expIDs: []uint64{4},
+		},
+		{
+			name:   "no words",
+			query:  ` "" * `,
+			expErr: ErrEmptySearch,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			hits, err := repo.Search(context.Background(), SearchQuery{Text: testCase.query})
+
+			if !errors.Is(err, testCase.expErr) {
+				t.Fatalf("expected error %v, got %v", testCase.expErr, err)
+			}
+
+			if testCase.expErr != nil {
+				return
+			}
+
+			ids := []uint64{}
+			for _, hit := range hits {
+				ids = append(ids, hit.Note.ID)
+			}
+			if !slices.Equal(ids, testCase.expIDs) {
+				t.Errorf("ids: expected %v, got %v", testCase.expIDs, ids)
+			}
+		})
+	}
+}
+
+func TestSearchFollowsChanges(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	created, _ := repo.Create(context.Background(), NoteDTO{Title: "Купить молоко"})
+
+	repo.Update(context.Background(), created.ID, NoteDTO{Title: "Купить хлеб"})
+	if hits, _ := repo.Search(context.Background(), SearchQuery{Text: "молоко"}); len(hits) != 0 {
+		t.Errorf("after update: expected no hits for old word, got %d", len(hits))
+	}
+	if hits, _ := repo.Search(context.Background(), SearchQuery{Text: "хлеб"}); len(hits) != 1 {
+		t.Errorf("after update: expected 1 hit for new word, got %d", len(hits))
+	}
+
+	repo.Delete(context.Background(), created.ID)
+	if hits, _ := repo.Search(context.Background(), SearchQuery{Text: "хлеб"}); len(hits) != 0 {
+		t.Errorf("after delete: expected no hits, got %d", len(hits))
+	}
+	index := repo.tenants[DefaultTenant].index
+	if len(index.postings) != 0 || len(index.docLen) != 0 || index.totalLen != 0 {
+		t.Errorf("after delete: expected empty index, got %+v", index)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	testTable := []struct {
+		name  string
+		text  string
+		query string
+		exp   string
+	}{
+		{
+			name:  "word",
+			text:  "Купить молоко",
+			query: "молоко",
+			exp:   "Купить <mark>молоко</mark>",
+		},
+		{
+			name:  "prefix keeps original case",
+			text:  "Milkshake <b>too</b>",
+			query: "milk*",
+			exp:   "<mark>Milkshake</mark> &lt;b&gt;too&lt;/b&gt;",
+		},
+		{
+			name:  "window around first match",
+			text:  "one two three four five six seven eight nine ten eleven twelve thirteen fourteen fifteen",
+			query: "twelve",
+			exp:   "…six seven eight nine ten eleven <mark>twelve</mark> thirteen fourteen fifteen",
+		},
+		{
+			name:  "no match",
+			text:  "Купить хлеб",
+			query: "молоко",
+			exp:   "",
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			got := highlight(testCase.text, parseSearchQuery(testCase.query))
+
+			if got != testCase.exp {
+				t.Errorf("expected %q, got %q", testCase.exp, got)
+			}
+		})
+	}
+}
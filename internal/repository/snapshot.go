@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrNotPersistent error = errors.New("storage is not persistent")
+
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".json"
+
+	// keepSnapshots older snapshots stay on disk, together with the log tail
+	// after the oldest of them, so a damaged latest snapshot is not fatal.
+	keepSnapshots = 2
+)
+
+type Compactor interface {
+	Compact(ctx context.Context) error
+}
+
+// snapshot keeps the default tenant at the top level, as snapshots did before
+// tenants existed, and every other tenant in Tenants.
+type snapshot struct {
+	Seq uint64 `json:"seq"`
+	tenantSnapshot
+	Tenants []tenantSnapshot `json:"tenants,omitempty"`
+}
+
+type tenantSnapshot struct {
+	Tenant   string `json:"tenant,omitempty"`
+	IDGen    uint64 `json:"id_gen"`
+	Notes    []Note `json:"notes"`
+	TagIDGen uint64 `json:"tag_id_gen,omitempty"`
+	Tags     []Tag  `json:"tags,omitempty"`
+
+	ListIDGen uint64 `json:"list_id_gen,omitempty"`
+	Lists     []List `json:"lists,omitempty"`
+
+	Trash     []Note     `json:"trash,omitempty"`
+	Revisions []Revision `json:"revisions,omitempty"`
+}
+
+func (t *tenant) snapshot() tenantSnapshot {
+	s := tenantSnapshot{
+		IDGen: t.idGen.Load(),
+		Notes: t.sortedNotes(),
+
+		TagIDGen: t.tags.idGen,
+		Tags:     t.sortedTags(),
+
+		ListIDGen: t.listIDGen,
+		Lists:     t.sortedLists(),
+
+		Trash:     t.sortedTrash(),
+		Revisions: t.sortedRevisions(),
+	}
+	if t.id != DefaultTenant {
+		s.Tenant = t.id
+	}
+	return s
+}
+
+// entry turns the snapshot back into a log entry that restores the tenant
+// without its revision history.
+func (s tenantSnapshot) entry() logEntry {
+	return logEntry{
+		Tenant:    s.Tenant,
+		IDGen:     s.IDGen,
+		Put:       s.Notes,
+		TagIDGen:  s.TagIDGen,
+		PutTags:   s.Tags,
+		ListIDGen: s.ListIDGen,
+		PutLists:  s.Lists,
+		Trash:     s.Trash,
+	}
+}
+
+func snapshotName(seq uint64) string {
+	return fmt.Sprintf("%s%020d%s", snapshotPrefix, seq, snapshotSuffix)
+}
+
+// listSnapshots returns snapshot file names in dir, newest first.
+func listSnapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+// loadSnapshot returns the newest snapshot in dir that passes its checksum.
+func loadSnapshot(dir string) (snapshot, bool, error) {
+	names, err := listSnapshots(dir)
+	if err != nil {
+		return snapshot{}, false, err
+	}
+
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return snapshot{}, false, err
+		}
+
+		var s snapshot
+		if decodeRecord(data, &s) {
+			return s, true, nil
+		}
+	}
+
+	return snapshot{}, false, nil
+}
+
+func writeSnapshot(dir string, s snapshot) error {
+	data, err := encodeRecord(s)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, snapshotName(s.Seq))
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncDir(dir)
+}
+
+// Persistent tells whether the database keeps a log on disk, so Compact has
+// something to do.
+func (db *InMemoryDataBase) Persistent() bool {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.log != nil
+}
+
+// Compact writes a snapshot of every tenant and drops log entries that
+// are covered by every retained snapshot.
+func (db *InMemoryDataBase) Compact(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.log == nil {
+		return ErrNotPersistent
+	}
+
+	s := snapshot{Seq: db.log.seq, tenantSnapshot: db.tenantByID(DefaultTenant).snapshot()}
+	for _, t := range db.sortedTenants() {
+		if t.id != DefaultTenant {
+			s.Tenants = append(s.Tenants, t.snapshot())
+		}
+	}
+
+	if err := writeSnapshot(db.dir, s); err != nil {
+		return err
+	}
+
+	names, err := listSnapshots(db.dir)
+	if err != nil {
+		return err
+	}
+	if len(names) > keepSnapshots {
+		for _, name := range names[keepSnapshots:] {
+			if err := os.Remove(filepath.Join(db.dir, name)); err != nil {
+				return err
+			}
+		}
+		names = names[:keepSnapshots]
+	}
+
+	var oldest uint64
+	if _, err := fmt.Sscanf(names[len(names)-1], snapshotPrefix+"%d"+snapshotSuffix, &oldest); err != nil {
+		return err
+	}
+
+	return db.log.truncateBefore(db.dir, oldest)
+}
+
+// restore loads a tenant from its snapshot. Snapshots written before revisions
+// were kept start the history with the current version of every note.
+// Callers must hold db.mu.
+func (db *InMemoryDataBase) restore(s tenantSnapshot) {
+	db.apply(s.entry())
+	if len(s.Revisions) == 0 {
+		return
+	}
+
+	t := db.tenantByID(s.Tenant)
+	clear(t.revisions)
+	for _, r := range s.Revisions {
+		t.revisions[r.Note.ID] = append(t.revisions[r.Note.ID], r)
+	}
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+
+	repo, err := OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first, _ := repo.Create(context.Background(), NoteDTO{Title: "t1"})
+	second, _ := repo.Create(context.Background(), NoteDTO{Title: "t2"})
+	if err := repo.Compact(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	repo.Update(context.Background(), first.ID, NoteDTO{Title: "t1 new"})
+	repo.Delete(context.Background(), second.ID)
+	if err := repo.Compact(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	third, _ := repo.Create(context.Background(), NoteDTO{Title: "t3"})
+	if err := repo.Compact(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	repo.Delete(context.Background(), third.ID)
+	repo.Close()
+
+	names, err := listSnapshots(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(names) != keepSnapshots {
+		t.Errorf("expected %d snapshots, got %d", keepSnapshots, len(names))
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, logFileName))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	entries, _, err := readLog(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected 2 log entries after compaction, got %d", len(entries))
+	}
+
+	testTable := []struct {
+		name   string
+		damage func(t *testing.T)
+	}{
+		{
+			name:   "latest snapshot",
+			damage: func(t *testing.T) {},
+		},
+		{
+			name: "fallback to older snapshot",
+			damage: func(t *testing.T) {
+				if err := os.WriteFile(filepath.Join(dir, names[0]), []byte("garbage"), 0o644); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			testCase.damage(t)
+
+			repo, err := OpenInMemoryDataBase(dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer repo.Close()
+
+			notes, _ := repo.GetAll(context.Background())
+			if len(notes) != 1 || notes[0].Title != "t1 new" {
+				t.Fatalf("expected only updated first note, got %+v", notes)
+			}
+
+			created, _ := repo.Create(context.Background(), NoteDTO{Title: "t4"})
+			if created.ID <= third.ID {
+				t.Errorf("id: expected greater than %d, got %d", third.ID, created.ID)
+			}
+			repo.Delete(context.Background(), created.ID)
+		})
+	}
+}
+
+func TestCompactNotPersistent(t *testing.T) {
+	repo := NewInMemoryDataBase()
+
+	if err := repo.Compact(context.Background()); !errors.Is(err, ErrNotPersistent) {
+		t.Fatalf("expected error %v, got %v", ErrNotPersistent, err)
+	}
+}
+
+func TestOpenMissingLogTail(t *testing.T) {
+	dir := t.TempDir()
+
+	repo, err := OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	repo.Create(context.Background(), NoteDTO{Title: "t1"})
+	repo.Compact(context.Background())
+	repo.Create(context.Background(), NoteDTO{Title: "t2"})
+	repo.Compact(context.Background())
+	repo.Create(context.Background(), NoteDTO{Title: "t3"})
+	repo.Close()
+
+	names, _ := listSnapshots(dir)
+	for _, name := range names {
+		os.Remove(filepath.Join(dir, name))
+	}
+
+	if _, err := OpenInMemoryDataBase(dir); !errors.Is(err, ErrCorruptLog) {
+		t.Fatalf("expected error %v, got %v", ErrCorruptLog, err)
+	}
+}
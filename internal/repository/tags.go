@@ -0,0 +1,364 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+)
+
+type TagRepository interface {
+	CreateTag(ctx context.Context, name string) (Tag, error)
+	GetTag(ctx context.Context, id uint64) (Tag, error)
+	ListTags(ctx context.Context) ([]Tag, error)
+	RenameTag(ctx context.Context, id uint64, name string) (Tag, error)
+	DeleteTag(ctx context.Context, id uint64) error
+	MergeTags(ctx context.Context, from uint64, into uint64) (Tag, error)
+}
+
+// Tag is a label shared by notes. Notes refer to tags by name; Notes is the
+// number of tagged notes and is computed at read time.
+type Tag struct {
+	ID    uint64 `json:"id"`
+	Name  string `json:"name"`
+	Notes int    `json:"notes"`
+}
+
+var ErrTagNotFound error = errors.New("tag not found")
+var ErrTagExists error = errors.New("tag with this name already exists")
+var ErrInvalidTagName error = errors.New("tag name must not be empty or contain commas")
+var ErrMergeIntoItself error = errors.New("tag cannot be merged into itself")
+
+// NormalizeTagName trims and lower-cases a tag name, so "Backend" and
+// " backend" are the same tag.
+func NormalizeTagName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || strings.Contains(name, ",") {
+		return "", ErrInvalidTagName
+	}
+	return name, nil
+}
+
+// ParseTagFilter reads one tag=a,b parameter: the note must carry at least one
+// of the listed tags.
+func ParseTagFilter(param, raw string) ([]string, error) {
+	var group []string
+	for _, name := range strings.Split(raw, ",") {
+		name, err := NormalizeTagName(name)
+		if err != nil {
+			return nil, &QueryError{Param: param, Message: "tag names must not be empty"}
+		}
+		group = append(group, name)
+	}
+	return group, nil
+}
+
+// tagIndex keeps the tag collection together with a reverse index from tag
+// name to the notes carrying it.
+type tagIndex struct {
+	tags   map[uint64]Tag
+	byName map[string]uint64
+	notes  map[string]map[uint64]struct{}
+	idGen  uint64
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		tags:   make(map[uint64]Tag),
+		byName: make(map[string]uint64),
+		notes:  make(map[string]map[uint64]struct{}),
+	}
+}
+
+func (idx *tagIndex) putTag(t Tag) {
+	t.Notes = 0
+	if old, ok := idx.tags[t.ID]; ok {
+		delete(idx.byName, old.Name)
+	}
+	idx.tags[t.ID] = t
+	idx.byName[t.Name] = t.ID
+}
+
+func (idx *tagIndex) deleteTag(id uint64) {
+	if old, ok := idx.tags[id]; ok {
+		delete(idx.byName, old.Name)
+		delete(idx.tags, id)
+	}
+}
+
+func (idx *tagIndex) add(n Note) {
+	for _, name := range n.Tags {
+		ids, ok := idx.notes[name]
+		if !ok {
+			ids = make(map[uint64]struct{})
+			idx.notes[name] = ids
+		}
+		ids[n.ID] = struct{}{}
+	}
+}
+
+func (idx *tagIndex) remove(n Note) {
+	for _, name := range n.Tags {
+		if ids, ok := idx.notes[name]; ok {
+			delete(ids, n.ID)
+			if len(ids) == 0 {
+				delete(idx.notes, name)
+			}
+		}
+	}
+}
+
+func (idx *tagIndex) present(t Tag) Tag {
+	t.Notes = len(idx.notes[t.Name])
+	return t
+}
+
+// match returns the IDs of notes that carry at least one tag of every group.
+func (idx *tagIndex) match(groups [][]string) map[uint64]struct{} {
+	var res map[uint64]struct{}
+	for _, group := range groups {
+		found := make(map[uint64]struct{})
+		for _, name := range group {
+			name, _ := NormalizeTagName(name)
+			for id := range idx.notes[name] {
+				if _, ok := res[id]; res == nil || ok {
+					found[id] = struct{}{}
+				}
+			}
+		}
+		res = found
+	}
+	return res
+}
+
+// resolveTags normalizes names and adds tags that do not exist yet to e.
+// Callers must hold db.mu.
+func (t *tenant) resolveTags(e *logEntry, names []string) ([]string, error) {
+	var res []string
+	for _, name := range names {
+		name, err := NormalizeTagName(name)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, name)
+	}
+	slices.Sort(res)
+	res = slices.Compact(res)
+
+	for _, name := range res {
+		if _, ok := t.tags.byName[name]; ok {
+			continue
+		}
+		if slices.ContainsFunc(e.PutTags, func(tag Tag) bool { return tag.Name == name }) {
+			continue
+		}
+		e.TagIDGen = max(e.TagIDGen, t.tags.idGen) + 1
+		e.PutTags = append(e.PutTags, Tag{ID: e.TagIDGen, Name: name})
+	}
+	return res, nil
+}
+
+// retag replaces the tag from with to on every note carrying it, or removes
+// it when to is empty. The changed notes are added to e as new versions.
+// Callers must hold db.mu.
+func (t *tenant) retag(e *logEntry, from, to string) {
+	ids := make([]uint64, 0, len(t.tags.notes[from]))
+	for id := range t.tags.notes[from] {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	now := t.now()
+	for _, id := range ids {
+		n := t.notes[id]
+		tags := slices.DeleteFunc(slices.Clone(n.Tags), func(name string) bool { return name == from })
+		if to != "" {
+			tags = append(tags, to)
+			slices.Sort(tags)
+			tags = slices.Compact(tags)
+		}
+
+		n.Tags = tags
+		n.Version++
+		n.UpdatedAt = now
+		e.Put = append(e.Put, n)
+	}
+}
+
+func (db *InMemoryDataBase) CreateTag(ctx context.Context, name string) (Tag, error) {
+	select {
+	case <-ctx.Done():
+		return Tag{}, ctx.Err()
+	default:
+	}
+
+	name, err := NormalizeTagName(name)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.tags.byName[name]; ok {
+		return Tag{}, ErrTagExists
+	}
+
+	e := logEntry{IDGen: t.idGen.Load()}
+	t.resolveTags(&e, []string{name})
+	if err := db.commit(ctx, t, e); err != nil {
+		return Tag{}, err
+	}
+	return t.tags.present(e.PutTags[0]), nil
+}
+
+func (db *InMemoryDataBase) GetTag(ctx context.Context, id uint64) (Tag, error) {
+	select {
+	case <-ctx.Done():
+		return Tag{}, ctx.Err()
+	default:
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	tag, ok := t.tags.tags[id]
+	if !ok {
+		return Tag{}, ErrTagNotFound
+	}
+	return t.tags.present(tag), nil
+}
+
+func (db *InMemoryDataBase) ListTags(ctx context.Context) ([]Tag, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	res := t.sortedTags()
+	for i := range res {
+		res[i] = t.tags.present(res[i])
+	}
+	return res, nil
+}
+
+// sortedTags returns all tags ordered by name. Callers must hold db.mu.
+func (t *tenant) sortedTags() []Tag {
+	res := make([]Tag, 0, len(t.tags.tags))
+	for _, tag := range t.tags.tags {
+		res = append(res, tag)
+	}
+	slices.SortFunc(res, func(a, b Tag) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return res
+}
+
+// RenameTag renames the tag on every note carrying it in one atomic change.
+func (db *InMemoryDataBase) RenameTag(ctx context.Context, id uint64, name string) (Tag, error) {
+	select {
+	case <-ctx.Done():
+		return Tag{}, ctx.Err()
+	default:
+	}
+
+	name, err := NormalizeTagName(name)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	tag, ok := t.tags.tags[id]
+	if !ok {
+		return Tag{}, ErrTagNotFound
+	}
+	if tag.Name == name {
+		return t.tags.present(tag), nil
+	}
+	if _, ok := t.tags.byName[name]; ok {
+		return Tag{}, ErrTagExists
+	}
+
+	e := logEntry{IDGen: t.idGen.Load()}
+	t.retag(&e, tag.Name, name)
+	tag.Name = name
+	e.PutTags = []Tag{tag}
+	if err := db.commit(ctx, t, e); err != nil {
+		return Tag{}, err
+	}
+	return t.tags.present(tag), nil
+}
+
+// DeleteTag removes the tag and detaches it from every note in one atomic
+// change.
+func (db *InMemoryDataBase) DeleteTag(ctx context.Context, id uint64) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	tag, ok := t.tags.tags[id]
+	if !ok {
+		return ErrTagNotFound
+	}
+
+	e := logEntry{IDGen: t.idGen.Load(), DeleteTags: []uint64{id}}
+	t.retag(&e, tag.Name, "")
+	return db.commit(ctx, t, e)
+}
+
+// MergeTags moves every note from one tag to another and deletes the first
+// tag.
+func (db *InMemoryDataBase) MergeTags(ctx context.Context, from uint64, into uint64) (Tag, error) {
+	select {
+	case <-ctx.Done():
+		return Tag{}, ctx.Err()
+	default:
+	}
+
+	if from == into {
+		return Tag{}, ErrMergeIntoItself
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	src, ok := t.tags.tags[from]
+	if !ok {
+		return Tag{}, ErrTagNotFound
+	}
+	dst, ok := t.tags.tags[into]
+	if !ok {
+		return Tag{}, ErrTagNotFound
+	}
+
+	e := logEntry{IDGen: t.idGen.Load(), DeleteTags: []uint64{from}}
+	t.retag(&e, src.Name, dst.Name)
+	if err := db.commit(ctx, t, e); err != nil {
+		return Tag{}, err
+	}
+	return t.tags.present(dst), nil
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func noteIDs(notes []Note) []uint64 {
+	ids := []uint64{}
+	for _, n := range notes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func TestListByTags(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	repo.Create(context.Background(), NoteDTO{Title: "t1", Tags: []string{"Backend", " urgent"}})
+	repo.Create(context.Background(), NoteDTO{Title: "t2", Tags: []string{"backend"}})
+	repo.Create(context.Background(), NoteDTO{Title: "t3", Tags: []string{"frontend", "urgent", "urgent"}})
+	repo.Create(context.Background(), NoteDTO{Title: "t4"})
+
+	testTable := []struct {
+		name   string
+		tags   [][]string
+		expIDs []uint64
+	}{
+		{
+			name:   "single tag",
+			tags:   [][]string{{"backend"}},
+			expIDs: []uint64{1, 2},
+		},
+		{
+			name:   "all of",
+			tags:   [][]string{{"backend"}, {"urgent"}},
+			expIDs: []uint64{1},
+		},
+		{
+			name:   "any of",
+			tags:   [][]string{{"backend", "frontend"}},
+			expIDs: []uint64{1, 2, 3},
+		},
+		{
+			name:   "any of and all of",
+			tags:   [][]string{{"backend", "frontend"}, {"urgent"}},
+			expIDs: []uint64{1, 3},
+		},
+		{
+			name:   "unknown tag",
+			tags:   [][]string{{"ops"}},
+			expIDs: []uint64{},
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			page, err := repo.List(context.Background(), ListQuery{Tags: testCase.tags})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ids := noteIDs(page.Notes); !slices.Equal(ids, testCase.expIDs) {
+				t.Errorf("ids: expected %v, got %v", testCase.expIDs, ids)
+			}
+		})
+	}
+
+	note, _ := repo.GetByID(context.Background(), 3)
+	if !slices.Equal(note.Tags, []string{"frontend", "urgent"}) {
+		t.Errorf("tags: expected normalized tags, got %v", note.Tags)
+	}
+}
+
+func TestTags(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	first, _ := repo.Create(context.Background(), NoteDTO{Title: "t1", Tags: []string{"backend", "urgent"}})
+	second, _ := repo.Create(context.Background(), NoteDTO{Title: "t2", Tags: []string{"api"}})
+
+	tags, _ := repo.ListTags(context.Background())
+	if len(tags) != 3 || tags[0].Name != "api" || tags[1].Name != "backend" || tags[1].Notes != 1 {
+		t.Fatalf("tags: expected api, backend and urgent, got %+v", tags)
+	}
+	api, backend, urgent := tags[0], tags[1], tags[2]
+
+	if _, err := repo.CreateTag(context.Background(), "Urgent"); !errors.Is(err, ErrTagExists) {
+		t.Errorf("create existing: expected %v, got %v", ErrTagExists, err)
+	}
+	if _, err := repo.CreateTag(context.Background(), "a,b"); !errors.Is(err, ErrInvalidTagName) {
+		t.Errorf("create invalid: expected %v, got %v", ErrInvalidTagName, err)
+	}
+	ops, err := repo.CreateTag(context.Background(), "ops")
+	if err != nil || ops.Notes != 0 {
+		t.Fatalf("create: unexpected result %+v, %v", ops, err)
+	}
+
+	if _, err := repo.RenameTag(context.Background(), backend.ID, "ops"); !errors.Is(err, ErrTagExists) {
+		t.Errorf("rename to existing: expected %v, got %v", ErrTagExists, err)
+	}
+	renamed, err := repo.RenameTag(context.Background(), backend.ID, "server")
+	if err != nil || renamed.Name != "server" || renamed.Notes != 1 {
+		t.Fatalf("rename: unexpected result %+v, %v", renamed, err)
+	}
+	note, _ := repo.GetByID(context.Background(), first.ID)
+	if !slices.Equal(note.Tags, []string{"server", "urgent"}) || note.Version != first.Version+1 {
+		t.Errorf("rename: note was not retagged: %+v", note)
+	}
+
+	if _, err := repo.MergeTags(context.Background(), api.ID, api.ID); !errors.Is(err, ErrMergeIntoItself) {
+		t.Errorf("merge into itself: expected %v, got %v", ErrMergeIntoItself, err)
+	}
+	merged, err := repo.MergeTags(context.Background(), api.ID, renamed.ID)
+	if err != nil || merged.Notes != 2 {
+		t.Fatalf("merge: unexpected result %+v, %v", merged, err)
+	}
+	if _, err := repo.GetTag(context.Background(), api.ID); !errors.Is(err, ErrTagNotFound) {
+		t.Errorf("merge: source tag still exists: %v", err)
+	}
+	note, _ = repo.GetByID(context.Background(), second.ID)
+	if !slices.Equal(note.Tags, []string{"server"}) {
+		t.Errorf("merge: note was not retagged: %+v", note)
+	}
+
+	if err := repo.DeleteTag(context.Background(), urgent.ID); err != nil {
+		t.Fatalf("delete: unexpected error: %v", err)
+	}
+	note, _ = repo.GetByID(context.Background(), first.ID)
+	if !slices.Equal(note.Tags, []string{"server"}) {
+		t.Errorf("delete: tag was not detached: %+v", note)
+	}
+	page, _ := repo.List(context.Background(), ListQuery{Tags: [][]string{{"urgent"}}})
+	if len(page.Notes) != 0 {
+		t.Errorf("delete: reverse index still has notes %v", noteIDs(page.Notes))
+	}
+	if err := repo.DeleteTag(context.Background(), urgent.ID); !errors.Is(err, ErrTagNotFound) {
+		t.Errorf("delete missing: expected %v, got %v", ErrTagNotFound, err)
+	}
+}
+
+func TestTagsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	repo, err := OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	repo.Create(context.Background(), NoteDTO{Title: "t1", Tags: []string{"backend"}})
+	repo.Compact(context.Background())
+	urgent, _ := repo.CreateTag(context.Background(), "urgent")
+	backend, _ := repo.RenameTag(context.Background(), 1, "server")
+	repo.Close()
+
+	repo, err = OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer repo.Close()
+
+	tags, _ := repo.ListTags(context.Background())
+	exp := []Tag{{ID: backend.ID, Name: "server", Notes: 1}, {ID: urgent.ID, Name: "urgent"}}
+	if !slices.Equal(tags, exp) {
+		t.Errorf("tags: expected %+v, got %+v", exp, tags)
+	}
+
+	created, _ := repo.CreateTag(context.Background(), "ops")
+	if created.ID != urgent.ID+1 {
+		t.Errorf("id: expected %d, got %d", urgent.ID+1, created.ID)
+	}
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTenant owns everything done without an explicit tenant.
+const DefaultTenant = "default"
+
+type tenantKey struct{}
+
+// WithTenant scopes every repository call made with ctx to tenant id.
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// TenantFrom returns the tenant ctx is scoped to, DefaultTenant if none.
+func TenantFrom(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey{}).(string)
+	if id == "" {
+		return DefaultTenant
+	}
+	return id
+}
+
+// tenant holds the notes, tags and lists of one tenant together with their
+// indexes. IDs are allocated per tenant, so two tenants may both have note 1.
+type tenant struct {
+	id    string
+	notes map[uint64]Note
+	trash map[uint64]Note
+	// revisions holds the latest versions of every note, oldest first.
+	revisions map[uint64][]Revision
+	children  relation
+	blocks    relation
+
+	lists     map[uint64]List
+	listNotes relation
+	listIDGen uint64
+	idGen     atomic.Uint64
+	index     *searchIndex
+	tags      *tagIndex
+	clock     Clock
+}
+
+func newTenant(id string, clock Clock) *tenant {
+	return &tenant{
+		id:        id,
+		notes:     make(map[uint64]Note),
+		trash:     make(map[uint64]Note),
+		revisions: make(map[uint64][]Revision),
+		children:  make(relation),
+		blocks:    make(relation),
+
+		lists:     make(map[uint64]List),
+		listNotes: make(relation),
+		index:     newSearchIndex(),
+		tags:      newTagIndex(),
+		clock:     clock,
+	}
+}
+
+// tenant returns the state of the tenant ctx is scoped to. A tenant that has
+// never written anything gets an empty state, which commit keeps on the first
+// change. Callers must hold db.mu.
+func (db *InMemoryDataBase) tenant(ctx context.Context) *tenant {
+	id := TenantFrom(ctx)
+	if t, ok := db.tenants[id]; ok {
+		return t
+	}
+	return newTenant(id, db.clock)
+}
+
+// tenantByID returns the state of tenant id as named in a log entry, creating
+// it if needed. Callers must hold db.mu.
+func (db *InMemoryDataBase) tenantByID(id string) *tenant {
+	if id == "" {
+		id = DefaultTenant
+	}
+	t, ok := db.tenants[id]
+	if !ok {
+		t = newTenant(id, db.clock)
+		db.tenants[id] = t
+	}
+	return t
+}
+
+// sortedTenants returns all tenants ordered by ID. Callers must hold db.mu.
+func (db *InMemoryDataBase) sortedTenants() []*tenant {
+	res := make([]*tenant, 0, len(db.tenants))
+	for _, t := range db.tenants {
+		res = append(res, t)
+	}
+	slices.SortFunc(res, func(a, b *tenant) int {
+		return cmp.Compare(a.id, b.id)
+	})
+	return res
+}
+
+// now is truncated to microseconds so timestamps survive a round trip through
+// JSON and compare equal after a restart.
+func (t *tenant) now() time.Time {
+	return t.clock.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTenantsSurviveRestart(t *testing.T) {
+	dir := t.TempDir()
+	alice := WithTenant(context.Background(), "alice")
+
+	repo, err := OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	repo.Create(context.Background(), NoteDTO{Title: "default 1"})
+	repo.Create(alice, NoteDTO{Title: "alice 1", Tags: []string{"home"}})
+	repo.CreateList(alice, ListDTO{Name: "work"})
+	repo.Compact(context.Background())
+	repo.Create(alice, NoteDTO{Title: "alice 2"})
+	repo.Close()
+
+	repo, err = OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer repo.Close()
+
+	notes, _ := repo.GetAll(alice)
+	if ids := noteIDs(notes); !slices.Equal(ids, []uint64{1, 2}) {
+		t.Errorf("alice's notes: expected [1 2], got %v", ids)
+	}
+	tags, _ := repo.ListTags(alice)
+	if len(tags) != 1 || tags[0].Notes != 1 {
+		t.Errorf("alice's tags: expected home on 1 note, got %+v", tags)
+	}
+	if tags, _ := repo.ListTags(context.Background()); len(tags) != 0 {
+		t.Errorf("default tags: expected none, got %+v", tags)
+	}
+	if lists, _ := repo.GetLists(alice); len(lists) != 1 {
+		t.Errorf("alice's lists: expected 1, got %+v", lists)
+	}
+
+	created, _ := repo.Create(context.Background(), NoteDTO{Title: "default 2"})
+	if created.ID != 2 {
+		t.Errorf("default id: expected 2, got %d", created.ID)
+	}
+}
+
+func TestSnapshotWithoutTenants(t *testing.T) {
+	dir := t.TempDir()
+
+	// A snapshot written before tenants existed has no tenant fields at all.
+	data, err := encodeRecord(map[string]any{
+		"seq":    0,
+		"id_gen": 1,
+		"notes":  []Note{{ID: 1, Title: "old", Version: 1}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, snapshotName(0)), data, 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	repo, err := OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer repo.Close()
+
+	note, err := repo.GetByID(context.Background(), 1)
+	if err != nil || note.Title != "old" {
+		t.Errorf("default tenant: expected note %q, got %+v (%v)", "old", note, err)
+	}
+}
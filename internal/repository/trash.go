@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+)
+
+// TrashRepository manages deleted notes. Deleting a note only moves it to the
+// trash, from where it can be restored until it is purged.
+type TrashRepository interface {
+	Trash(ctx context.Context) ([]Note, error)
+	Restore(ctx context.Context, id uint64) (Note, error)
+	Purge(ctx context.Context, id uint64) error
+}
+
+// moveToTrash turns the deletes collected in e into moves to the trash, so
+// the notes keep their content and get a DeletedAt time. Callers must hold
+// db.mu.
+func (t *tenant) moveToTrash(e *logEntry, now time.Time) {
+	for _, id := range e.Delete {
+		n := t.notes[id]
+		n.Version++
+		n.UpdatedAt = now
+		n.DeletedAt = &now
+		e.Trash = append(e.Trash, n)
+	}
+	e.Delete = nil
+}
+
+// sortedTrash returns the trashed notes ordered by ID. Callers must hold
+// db.mu.
+func (t *tenant) sortedTrash() []Note {
+	res := make([]Note, 0, len(t.trash))
+	for _, n := range t.trash {
+		res = append(res, n)
+	}
+	slices.SortFunc(res, func(a, b Note) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return res
+}
+
+// trashedSubtree returns id followed by every trashed note below it.
+// Callers must hold db.mu.
+func (t *tenant) trashedSubtree(id uint64) []uint64 {
+	children := make(relation)
+	for _, n := range t.trash {
+		if n.ParentID != nil {
+			children.add(*n.ParentID, n.ID)
+		}
+	}
+
+	ids := []uint64{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children.sorted(ids[i])...)
+	}
+	return ids
+}
+
+func (db *InMemoryDataBase) Trash(ctx context.Context) ([]Note, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	t := db.tenant(ctx)
+
+	return t.sortedTrash(), nil
+}
+
+// Restore brings a note back from the trash together with its trashed
+// subtasks. Parents, blockers and lists that are gone by now are dropped
+// from the restored notes; missing tags are created again.
+func (db *InMemoryDataBase) Restore(ctx context.Context, id uint64) (Note, error) {
+	select {
+	case <-ctx.Done():
+		return Note{}, ctx.Err()
+	default:
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.trash[id]; !ok {
+		return Note{}, ErrNotFoundID
+	}
+
+	ids := t.trashedSubtree(id)
+	exists := func(other uint64) bool {
+		_, ok := t.notes[other]
+		return ok || slices.Contains(ids, other)
+	}
+
+	now := t.now()
+	e := logEntry{IDGen: t.idGen.Load()}
+	for _, noteID := range ids {
+		n := t.trash[noteID]
+		if n.ParentID != nil && !exists(*n.ParentID) {
+			n.ParentID = nil
+		}
+		n.BlockedBy = slices.DeleteFunc(slices.Clone(n.BlockedBy), func(b uint64) bool { return !exists(b) })
+		if len(n.BlockedBy) == 0 {
+			n.BlockedBy = nil
+		}
+		if n.ListID != nil && t.checkList(n.ListID) != nil {
+			n.ListID = nil
+		}
+		tags, err := t.resolveTags(&e, n.Tags)
+		if err != nil {
+			return Note{}, err
+		}
+
+		n.Tags = tags
+		n.DeletedAt = nil
+		n.Version++
+		n.UpdatedAt = now
+		e.Put = append(e.Put, n)
+	}
+
+	if err := db.commit(ctx, t, e); err != nil {
+		return Note{}, err
+	}
+	return t.present(e.Put[0]), nil
+}
+
+// Purge deletes a trashed note for good.
+func (db *InMemoryDataBase) Purge(ctx context.Context, id uint64) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.trash[id]; !ok {
+		return ErrNotFoundID
+	}
+	return db.commit(ctx, t, logEntry{IDGen: t.idGen.Load(), Purge: []uint64{id}})
+}
+
+// PurgeTrashOlderThan is PurgeTrash for the notes moved to the trash more than
+// retention ago by the clock of the database, the one DeletedAt is set by.
+func (db *InMemoryDataBase) PurgeTrashOlderThan(ctx context.Context, retention time.Duration) (int, error) {
+	return db.PurgeTrash(ctx, db.clock.Now().Add(-retention))
+}
+
+// PurgeTrash deletes every note of every tenant that was moved to the trash
+// before the given time and returns how many notes were purged.
+func (db *InMemoryDataBase) PurgeTrash(ctx context.Context, before time.Time) (int, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	purged := 0
+	for _, t := range db.sortedTenants() {
+		e := logEntry{IDGen: t.idGen.Load()}
+		for _, n := range t.sortedTrash() {
+			if n.DeletedAt.Before(before) {
+				e.Purge = append(e.Purge, n.ID)
+			}
+		}
+		if len(e.Purge) == 0 {
+			continue
+		}
+		if err := db.commit(ctx, t, e); err != nil {
+			return purged, err
+		}
+		purged += len(e.Purge)
+	}
+	return purged, nil
+}
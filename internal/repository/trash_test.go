@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	repo := newTree(t)
+	other, _ := repo.Create(context.Background(), NoteDTO{Title: "other", BlockedBy: []uint64{2}})
+
+	if err := repo.DeleteWithChildren(context.Background(), 2, AnyVersion, DeleteCascade); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	notes, _ := repo.GetAll(context.Background())
+	if ids := noteIDs(notes); !slices.Equal(ids, []uint64{1, 4, other.ID}) {
+		t.Errorf("notes: expected [1 4 %d], got %v", other.ID, ids)
+	}
+	if _, err := repo.GetByID(context.Background(), 2); !errors.Is(err, ErrNotFoundID) {
+		t.Errorf("trashed note: expected %v, got %v", ErrNotFoundID, err)
+	}
+	if hits, _ := repo.Search(context.Background(), SearchQuery{Text: "child"}); len(hits) != 1 {
+		t.Errorf("search: expected only the second child, got %d hits", len(hits))
+	}
+
+	trash, _ := repo.Trash(context.Background())
+	if ids := noteIDs(trash); !slices.Equal(ids, []uint64{2, 3}) {
+		t.Errorf("trash: expected [2 3], got %v", ids)
+	}
+	for _, n := range trash {
+		if n.DeletedAt == nil || n.Version != 2 {
+			t.Errorf("trashed note %d: expected deleted_at and version 2, got %v and %d", n.ID, n.DeletedAt, n.Version)
+		}
+	}
+
+	restored, err := repo.Restore(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.ParentID == nil || *restored.ParentID != 1 {
+		t.Errorf("restored note: unexpected %+v", restored)
+	}
+	children, _ := repo.Children(context.Background(), 2)
+	if ids := noteIDs(children); !slices.Equal(ids, []uint64{3}) {
+		t.Errorf("restored subtasks: expected [3], got %v", ids)
+	}
+	if trash, _ := repo.Trash(context.Background()); len(trash) != 0 {
+		t.Errorf("trash after restore: expected empty, got %v", noteIDs(trash))
+	}
+
+	// The dependency was dropped on delete and is not brought back.
+	if n, _ := repo.GetByID(context.Background(), other.ID); len(n.BlockedBy) != 0 {
+		t.Errorf("dependent: expected no blockers, got %v", n.BlockedBy)
+	}
+
+	if _, err := repo.Restore(context.Background(), 2); !errors.Is(err, ErrNotFoundID) {
+		t.Errorf("restore live note: expected %v, got %v", ErrNotFoundID, err)
+	}
+}
+
+func TestRestoreDropsMissingReferences(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	list, _ := repo.CreateList(context.Background(), ListDTO{Name: "work"})
+	parent, _ := repo.Create(context.Background(), NoteDTO{Title: "parent"})
+	blocker, _ := repo.Create(context.Background(), NoteDTO{Title: "blocker"})
+	note, _ := repo.Create(context.Background(), NoteDTO{Title: "note", ParentID: &parent.ID, BlockedBy: []uint64{blocker.ID}, ListID: &list.ID, Tags: []string{"home"}})
+
+	repo.Delete(context.Background(), note.ID)
+	repo.Delete(context.Background(), parent.ID)
+	repo.Delete(context.Background(), blocker.ID)
+	repo.Purge(context.Background(), blocker.ID)
+	repo.DeleteList(context.Background(), list.ID, ListDelete{})
+	repo.DeleteTag(context.Background(), 1)
+
+	restored, err := repo.Restore(context.Background(), note.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restored.ParentID != nil || restored.BlockedBy != nil || restored.ListID != nil {
+		t.Errorf("restored note: expected no parent, blockers and list, got %+v", restored)
+	}
+	tags, _ := repo.ListTags(context.Background())
+	if len(tags) != 1 || tags[0].Name != "home" || tags[0].Notes != 1 {
+		t.Errorf("tags: expected home to be created again, got %+v", tags)
+	}
+
+	if err := repo.Purge(context.Background(), blocker.ID); !errors.Is(err, ErrNotFoundID) {
+		t.Errorf("purge twice: expected %v, got %v", ErrNotFoundID, err)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	dir := t.TempDir()
+	clock := &fakeClock{now: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)}
+	alice := WithTenant(context.Background(), "alice")
+
+	repo, err := OpenInMemoryDataBase(dir, WithClock(clock))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	old, _ := repo.Create(context.Background(), NoteDTO{Title: "old"})
+	aliceOld, _ := repo.Create(alice, NoteDTO{Title: "alice old"})
+	fresh, _ := repo.Create(context.Background(), NoteDTO{Title: "fresh"})
+	repo.Delete(context.Background(), old.ID)
+	repo.Delete(alice, aliceOld.ID)
+	repo.Compact(context.Background())
+	clock.Advance(48 * time.Hour)
+	repo.Delete(context.Background(), fresh.ID)
+
+	purged, err := repo.PurgeTrashOlderThan(context.Background(), 24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if purged != 2 {
+		t.Errorf("purged: expected 2, got %d", purged)
+	}
+	repo.Close()
+
+	repo, err = OpenInMemoryDataBase(dir, WithClock(clock))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer repo.Close()
+
+	trash, _ := repo.Trash(context.Background())
+	if ids := noteIDs(trash); !slices.Equal(ids, []uint64{fresh.ID}) {
+		t.Errorf("trash: expected [%d], got %v", fresh.ID, ids)
+	}
+	if trash, _ := repo.Trash(alice); len(trash) != 0 {
+		t.Errorf("alice's trash: expected empty, got %v", noteIDs(trash))
+	}
+}
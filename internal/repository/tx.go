@@ -0,0 +1,339 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+var ErrTxDone error = errors.New("transaction has already been committed or rolled back")
+
+// NoteTx is the part of NoteRepository available inside a transaction. Every
+// call sees the changes made earlier in the same transaction; a call that
+// fails changes nothing, so the transaction may go on after it.
+//
+// The methods match those of NoteRepository, so a backend without real
+// transactions can pass itself as the NoteTx.
+type NoteTx interface {
+	Create(ctx context.Context, dto NoteDTO) (Note, error)
+	GetByID(ctx context.Context, id uint64) (Note, error)
+	GetAll(ctx context.Context) ([]Note, error)
+	UpdateIfMatch(ctx context.Context, id uint64, version uint64, dto NoteDTO) (Note, error)
+	Patch(ctx context.Context, id uint64, version uint64, patch NotePatch) (Note, error)
+	DeleteWithChildren(ctx context.Context, id uint64, version uint64, mode DeleteMode) error
+}
+
+// WithTx runs fn in a transaction of the tenant of ctx. If fn returns nil and
+// ctx is still alive, the changes are committed as one log record; otherwise,
+// or if fn panics, they are rolled back and the error is returned.
+//
+// The transaction holds the write lock of the database until fn returns, so
+// fn must go through tx only: calling db from fn deadlocks.
+func (db *InMemoryDataBase) WithTx(ctx context.Context, fn func(tx NoteTx) error) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tx := db.begin(db.tenant(ctx))
+	defer func() {
+		if !tx.done {
+			tx.rollback()
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		tx.rollback()
+		return err
+	}
+	return tx.commit(ctx)
+}
+
+// memTx stages changes by applying them to the tenant right away and keeps,
+// for every step, what it replaced, so a rollback undoes only those changes.
+type memTx struct {
+	db      *InMemoryDataBase
+	t       *tenant
+	existed bool
+	undo    []undoRecord
+	steps   []logEntry
+	events  []Event
+	done    bool
+
+	idGen, tagIDGen, listIDGen uint64
+}
+
+// undoRecord is what one step replaced: the previous state of every note,
+// tag and list the step touched.
+type undoRecord struct {
+	notes []savedNote
+	tags  []savedTag
+	lists []savedList
+}
+
+// savedNote is a note as it was in the notes and in the trash, ok telling
+// whether it was there, and its revisions.
+type savedNote struct {
+	id        uint64
+	note      Note
+	ok        bool
+	trashed   Note
+	inTrash   bool
+	revisions []Revision
+}
+
+type savedTag struct {
+	id  uint64
+	tag Tag
+	ok  bool
+}
+
+type savedList struct {
+	id   uint64
+	list List
+	ok   bool
+}
+
+// begin starts a transaction of tenant t. Callers must hold db.mu until the
+// transaction is committed or rolled back.
+func (db *InMemoryDataBase) begin(t *tenant) *memTx {
+	_, existed := db.tenants[t.id]
+	return &memTx{
+		db:      db,
+		t:       t,
+		existed: existed,
+
+		idGen:     t.idGen.Load(),
+		tagIDGen:  t.tags.idGen,
+		listIDGen: t.listIDGen,
+	}
+}
+
+// stage applies e and remembers it and its events for the commit.
+func (tx *memTx) stage(ctx context.Context, e logEntry) {
+	e = tx.db.label(ctx, tx.t, e)
+	changed := tx.t.track(e)
+	tx.undo = append(tx.undo, tx.t.save(e))
+	tx.db.apply(e)
+	tx.steps = append(tx.steps, e)
+	tx.events = append(tx.events, changed()...)
+}
+
+// commit writes the staged changes to the log as one record and publishes
+// their events. If writing fails the transaction is rolled back.
+func (tx *memTx) commit(ctx context.Context) error {
+	tx.done = true
+	if tx.db.log != nil && len(tx.steps) > 0 {
+		e := tx.db.label(ctx, tx.t, logEntry{IDGen: tx.t.idGen.Load(), Steps: tx.steps})
+		if err := tx.db.log.append(&e); err != nil {
+			tx.revert()
+			return err
+		}
+	}
+
+	tx.db.publish(tx.events)
+	return nil
+}
+
+func (tx *memTx) rollback() {
+	tx.done = true
+	tx.revert()
+}
+
+// revert undoes the staged steps, last first, and forgets the tenant if the
+// transaction was the first to write to it.
+func (tx *memTx) revert() {
+	if !tx.existed {
+		delete(tx.db.tenants, tx.t.id)
+	}
+
+	t := tx.t
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		t.restoreRecord(tx.undo[i])
+	}
+	tx.undo = nil
+	t.idGen.Store(tx.idGen)
+	t.tags.idGen = tx.tagIDGen
+	t.listIDGen = tx.listIDGen
+}
+
+// save returns what applying e would replace. Callers must hold db.mu.
+func (t *tenant) save(e logEntry) undoRecord {
+	var u undoRecord
+	t.saveEntry(&u, e)
+	return u
+}
+
+func (t *tenant) saveEntry(u *undoRecord, e logEntry) {
+	saveNote := func(id uint64) {
+		s := savedNote{id: id, revisions: slices.Clone(t.revisions[id])}
+		s.note, s.ok = t.notes[id]
+		s.trashed, s.inTrash = t.trash[id]
+		u.notes = append(u.notes, s)
+	}
+	for _, n := range e.Put {
+		saveNote(n.ID)
+	}
+	for _, id := range e.Delete {
+		saveNote(id)
+	}
+	for _, n := range e.Trash {
+		saveNote(n.ID)
+	}
+	for _, id := range e.Purge {
+		saveNote(id)
+	}
+
+	saveTag := func(id uint64) {
+		s := savedTag{id: id}
+		s.tag, s.ok = t.tags.tags[id]
+		u.tags = append(u.tags, s)
+	}
+	for _, id := range e.DeleteTags {
+		saveTag(id)
+	}
+	for _, tag := range e.PutTags {
+		saveTag(tag.ID)
+	}
+
+	saveList := func(id uint64) {
+		s := savedList{id: id}
+		s.list, s.ok = t.lists[id]
+		u.lists = append(u.lists, s)
+	}
+	for _, l := range e.PutLists {
+		saveList(l.ID)
+	}
+	for _, id := range e.DeleteLists {
+		saveList(id)
+	}
+
+	for _, step := range e.Steps {
+		t.saveEntry(u, step)
+	}
+}
+
+// restoreRecord puts back what u saved, last first, so an entry saved twice
+// ends up as it was the first time. Callers must hold db.mu.
+func (t *tenant) restoreRecord(u undoRecord) {
+	for i := len(u.notes) - 1; i >= 0; i-- {
+		s := u.notes[i]
+		if cur, ok := t.notes[s.id]; ok {
+			t.unindex(cur)
+			delete(t.notes, s.id)
+		}
+		if s.ok {
+			t.notes[s.id] = s.note
+			t.reindex(s.note)
+		}
+		delete(t.trash, s.id)
+		if s.inTrash {
+			t.trash[s.id] = s.trashed
+		}
+		delete(t.revisions, s.id)
+		if s.revisions != nil {
+			t.revisions[s.id] = s.revisions
+		}
+	}
+	for i := len(u.tags) - 1; i >= 0; i-- {
+		s := u.tags[i]
+		t.tags.deleteTag(s.id)
+		if s.ok {
+			t.tags.putTag(s.tag)
+		}
+	}
+	for i := len(u.lists) - 1; i >= 0; i-- {
+		s := u.lists[i]
+		delete(t.lists, s.id)
+		if s.ok {
+			t.lists[s.id] = s.list
+		}
+	}
+}
+
+// check tells whether the transaction can still be used.
+func (tx *memTx) check(ctx context.Context) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	return ctx.Err()
+}
+
+func (tx *memTx) Create(ctx context.Context, dto NoteDTO) (Note, error) {
+	if err := tx.check(ctx); err != nil {
+		return Note{}, err
+	}
+
+	e, err := tx.t.createEntry(ctx, dto)
+	if err != nil {
+		return Note{}, err
+	}
+	tx.stage(ctx, e)
+	return tx.t.present(e.Put[0]), nil
+}
+
+func (tx *memTx) GetByID(ctx context.Context, id uint64) (Note, error) {
+	if err := tx.check(ctx); err != nil {
+		return Note{}, err
+	}
+
+	note, ok := tx.t.notes[id]
+	if !ok {
+		return Note{}, ErrNotFoundID
+	}
+	return tx.t.present(note), nil
+}
+
+func (tx *memTx) GetAll(ctx context.Context) ([]Note, error) {
+	if err := tx.check(ctx); err != nil {
+		return nil, err
+	}
+
+	notes := tx.t.sortedNotes()
+	for i := range notes {
+		notes[i] = tx.t.present(notes[i])
+	}
+	return notes, nil
+}
+
+func (tx *memTx) UpdateIfMatch(ctx context.Context, id uint64, version uint64, dto NoteDTO) (Note, error) {
+	return tx.modify(ctx, id, version, replaceWith(dto))
+}
+
+func (tx *memTx) Patch(ctx context.Context, id uint64, version uint64, patch NotePatch) (Note, error) {
+	return tx.modify(ctx, id, version, patchWith(patch))
+}
+
+func (tx *memTx) modify(ctx context.Context, id uint64, version uint64, change func(n *Note) error) (Note, error) {
+	if err := tx.check(ctx); err != nil {
+		return Note{}, err
+	}
+
+	e, err := tx.t.modifyEntry(ctx, id, version, change)
+	if err != nil {
+		return Note{}, err
+	}
+	tx.stage(ctx, e)
+	return tx.t.present(e.Put[0]), nil
+}
+
+func (tx *memTx) DeleteWithChildren(ctx context.Context, id uint64, version uint64, mode DeleteMode) error {
+	if err := tx.check(ctx); err != nil {
+		return err
+	}
+
+	e, err := tx.t.deleteEntry(id, version, mode)
+	if err != nil {
+		return err
+	}
+	tx.stage(ctx, e)
+	return nil
+}
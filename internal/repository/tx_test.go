@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestWithTx(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	ctx := context.Background()
+	errStop := errors.New("stop")
+
+	repo.Create(ctx, NoteDTO{Title: "a"})
+
+	err := repo.WithTx(ctx, func(tx NoteTx) error {
+		note, err := tx.Create(ctx, NoteDTO{Title: "b", Tags: []string{"new"}})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.GetByID(ctx, note.ID); err != nil {
+			t.Errorf("read own write: unexpected error: %v", err)
+		}
+		if err := tx.DeleteWithChildren(ctx, 1, AnyVersion, DeleteReject); err != nil {
+			return err
+		}
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("error: expected %v, got %v", errStop, err)
+	}
+	notes, _ := repo.GetAll(ctx)
+	if got := titles(notes); !slices.Equal(got, []string{"a"}) {
+		t.Errorf("notes after rollback: expected [a], got %v", got)
+	}
+	if tags, _ := repo.ListTags(ctx); len(tags) != 0 {
+		t.Errorf("tags after rollback: expected none, got %v", tags)
+	}
+
+	var leaked NoteTx
+	err = repo.WithTx(ctx, func(tx NoteTx) error {
+		leaked = tx
+		note, err := tx.GetByID(ctx, 1)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.UpdateIfMatch(ctx, note.ID, note.Version+1, NoteDTO{Title: "stale"}); !errors.Is(err, ErrVersionMismatch) {
+			t.Errorf("stale update: expected %v, got %v", ErrVersionMismatch, err)
+		}
+		done := true
+		_, err = tx.Patch(ctx, note.ID, note.Version, NotePatch{Done: &done})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if note, _ := repo.GetByID(ctx, 1); !note.Done || note.Version != 2 {
+		t.Errorf("note after commit: expected done at version 2, got %+v", note)
+	}
+	if _, err := leaked.GetAll(ctx); !errors.Is(err, ErrTxDone) {
+		t.Errorf("finished transaction: expected %v, got %v", ErrTxDone, err)
+	}
+}
+
+func TestWithTxPanic(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	ctx := WithTenant(context.Background(), "acme")
+
+	func() {
+		defer func() { recover() }()
+		repo.WithTx(ctx, func(tx NoteTx) error {
+			tx.Create(ctx, NoteDTO{Title: "a"})
+			panic("boom")
+		})
+	}()
+
+	if notes, _ := repo.GetAll(ctx); len(notes) != 0 {
+		t.Errorf("notes after panic: expected none, got %v", titles(notes))
+	}
+	if note, _ := repo.Create(ctx, NoteDTO{Title: "b"}); note.ID != 1 {
+		t.Errorf("next ID: expected 1, got %d", note.ID)
+	}
+}
+
+func TestWithTxSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	repo, err := OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	repo.WithTx(ctx, func(tx NoteTx) error {
+		a, _ := tx.Create(ctx, NoteDTO{Title: "a"})
+		tx.Create(ctx, NoteDTO{Title: "b", BlockedBy: []uint64{a.ID}})
+		return nil
+	})
+	repo.WithTx(ctx, func(tx NoteTx) error {
+		tx.Create(ctx, NoteDTO{Title: "lost"})
+		return errors.New("stop")
+	})
+	repo.Close()
+
+	repo, err = OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer repo.Close()
+
+	notes, _ := repo.GetAll(ctx)
+	if got := titles(notes); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("notes: expected [a b], got %v", got)
+	}
+	if len(notes) == 2 && !slices.Equal(notes[1].BlockedBy, []uint64{1}) {
+		t.Errorf("blocked_by: expected [1], got %v", notes[1].BlockedBy)
+	}
+}
+
+func TestWithTxRollbackKeepsState(t *testing.T) {
+	repo := NewInMemoryDataBase()
+	ctx := context.Background()
+
+	a, _ := repo.Create(ctx, NoteDTO{Title: "a", Tags: []string{"x"}})
+	b, _ := repo.Create(ctx, NoteDTO{Title: "b"})
+	repo.DeleteIfMatch(ctx, b.ID, AnyVersion)
+
+	repo.WithTx(ctx, func(tx NoteTx) error {
+		title := "changed"
+		tx.Patch(ctx, a.ID, a.Version, NotePatch{Title: &title})
+		tx.Patch(ctx, a.ID, a.Version+1, NotePatch{Title: &title})
+		tx.Create(ctx, NoteDTO{Title: "c", Tags: []string{"y"}, ParentID: &a.ID})
+		return errors.New("stop")
+	})
+
+	if note, _ := repo.GetByID(ctx, a.ID); note.Title != "a" || note.Version != a.Version || note.Progress != nil {
+		t.Errorf("note after rollback: expected %+v, got %+v", a, note)
+	}
+	if revs, _ := repo.Revisions(ctx, a.ID); len(revs) != 1 {
+		t.Errorf("revisions after rollback: expected 1, got %d", len(revs))
+	}
+	if trash, _ := repo.Trash(ctx); len(trash) != 1 || trash[0].ID != b.ID {
+		t.Errorf("trash after rollback: expected [%d], got %v", b.ID, trash)
+	}
+	if tags, _ := repo.ListTags(ctx); len(tags) != 1 || tags[0].Name != "x" {
+		t.Errorf("tags after rollback: expected [x], got %v", tags)
+	}
+	if note, _ := repo.Create(ctx, NoteDTO{Title: "d"}); note.ID != 3 {
+		t.Errorf("next ID: expected 3, got %d", note.ID)
+	}
+}
@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var ErrCorruptLog error = errors.New("write-ahead log is corrupted")
+
+const logFileName = "notes.log"
+
+// logEntry is a single durable change. Every entry carries the full state of
+// the notes it touches, so replaying it is idempotent. An empty Tenant stands
+// for DefaultTenant.
+type logEntry struct {
+	Seq        uint64   `json:"seq"`
+	Tenant     string   `json:"tenant,omitempty"`
+	Actor      string   `json:"actor,omitempty"`
+	IDGen      uint64   `json:"id_gen"`
+	Put        []Note   `json:"put,omitempty"`
+	Delete     []uint64 `json:"delete,omitempty"`
+	TagIDGen   uint64   `json:"tag_id_gen,omitempty"`
+	PutTags    []Tag    `json:"put_tags,omitempty"`
+	DeleteTags []uint64 `json:"delete_tags,omitempty"`
+
+	ListIDGen   uint64   `json:"list_id_gen,omitempty"`
+	PutLists    []List   `json:"put_lists,omitempty"`
+	DeleteLists []uint64 `json:"delete_lists,omitempty"`
+
+	Trash []Note   `json:"trash,omitempty"`
+	Purge []uint64 `json:"purge,omitempty"`
+
+	// Steps are applied in order after the rest of the entry. They let several
+	// dependent changes be committed as one record.
+	Steps []logEntry `json:"steps,omitempty"`
+}
+
+// writeAheadLog is an append-only file of entries, one per line, each line
+// prefixed with the CRC32 of its JSON payload:
+//
+//	<crc32 hex> <json>\n
+type writeAheadLog struct {
+	f    *os.File
+	seq  uint64
+	size int64
+}
+
+func openLog(dir string) (*writeAheadLog, []logEntry, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, err
+	}
+
+	path := filepath.Join(dir, logFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := syncDir(dir); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	entries, size, err := readLog(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// A torn write at the tail is expected after a crash: everything before it
+	// was fsynced, everything after it was never acknowledged.
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	l := &writeAheadLog{f: f, size: size}
+	if len(entries) > 0 {
+		l.seq = entries[len(entries)-1].Seq
+	}
+	return l, entries, nil
+}
+
+func readLog(r io.Reader) ([]logEntry, int64, error) {
+	var entries []logEntry
+	var size int64
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// No trailing newline: the last write never completed.
+			return entries, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var e logEntry
+		if !decodeRecord(line, &e) {
+			if _, err := br.Peek(1); errors.Is(err, io.EOF) {
+				return entries, size, nil
+			}
+			return nil, 0, fmt.Errorf("%w: bad record at offset %d", ErrCorruptLog, size)
+		}
+
+		entries = append(entries, e)
+		size += int64(len(line))
+	}
+}
+
+func decodeRecord(line []byte, v any) bool {
+	sum, payload, ok := bytes.Cut(bytes.TrimSuffix(line, []byte("\n")), []byte(" "))
+	if !ok {
+		return false
+	}
+
+	var crc uint32
+	if _, err := fmt.Sscanf(string(sum), "%08x", &crc); err != nil {
+		return false
+	}
+	if crc32.ChecksumIEEE(payload) != crc {
+		return false
+	}
+
+	return json.Unmarshal(payload, v) == nil
+}
+
+func encodeRecord(v any) ([]byte, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	line := fmt.Appendf(nil, "%08x ", crc32.ChecksumIEEE(payload))
+	line = append(line, payload...)
+	return append(line, '\n'), nil
+}
+
+// append assigns the next sequence number to e and returns only after the
+// entry has reached stable storage.
+func (l *writeAheadLog) append(e *logEntry) error {
+	e.Seq = l.seq + 1
+
+	line, err := encodeRecord(*e)
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.f.Write(line); err != nil {
+		l.rewind()
+		return err
+	}
+	if err := l.f.Sync(); err != nil {
+		l.rewind()
+		return err
+	}
+
+	l.seq = e.Seq
+	l.size += int64(len(line))
+	return nil
+}
+
+// rewind drops a partially written entry so the next append does not land
+// behind garbage.
+func (l *writeAheadLog) rewind() {
+	l.f.Truncate(l.size)
+	l.f.Seek(l.size, io.SeekStart)
+}
+
+// truncateBefore rewrites the log without the entries up to and including seq.
+func (l *writeAheadLog) truncateBefore(dir string, seq uint64) error {
+	path := filepath.Join(dir, logFileName)
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	entries, _, err := readLog(bytes.NewReader(current))
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	for _, e := range entries {
+		if e.Seq <= seq {
+			continue
+		}
+		line, err := encodeRecord(e)
+		if err != nil {
+			return err
+		}
+		data = append(data, line...)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(tmp, os.O_RDWR, 0o644)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := syncDir(dir); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		return err
+	}
+
+	l.f.Close()
+	l.f = f
+	l.size = int64(len(data))
+	return nil
+}
+
+func (l *writeAheadLog) close() error {
+	return l.f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenReplaysLog(t *testing.T) {
+	dir := t.TempDir()
+
+	repo, err := OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first, _ := repo.Create(context.Background(), NoteDTO{Title: "t1"})
+	second, _ := repo.Create(context.Background(), NoteDTO{Title: "t2"})
+	third, _ := repo.Create(context.Background(), NoteDTO{Title: "t3"})
+	repo.Update(context.Background(), first.ID, NoteDTO{Title: "t1 new", Done: true})
+	repo.Delete(context.Background(), second.ID)
+	repo.Delete(context.Background(), third.ID)
+	if err := repo.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	repo, err = OpenInMemoryDataBase(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer repo.Close()
+
+	notes, _ := repo.GetAll(context.Background())
+	if len(notes) != 1 {
+		t.Fatalf("expected 1 note, got %d", len(notes))
+	}
+	if notes[0].Title != "t1 new" || !notes[0].Done {
+		t.Errorf("note: expected updated state, got %+v", notes[0])
+	}
+
+	created, _ := repo.Create(context.Background(), NoteDTO{Title: "t4"})
+	if created.ID != third.ID+1 {
+		t.Errorf("id: expected %d, got %d", third.ID+1, created.ID)
+	}
+}
+
+func TestOpenDamagedLog(t *testing.T) {
+	testTable := []struct {
+		name     string
+		damage   func(data []byte) []byte
+		expErr   error
+		expNotes int
+	}{
+		{
+			name:     "intact",
+			damage:   func(data []byte) []byte { return data },
+			expNotes: 2,
+		},
+		{
+			name: "torn tail",
+			damage: func(data []byte) []byte {
+				return data[:len(data)-5]
+			},
+			expNotes: 1,
+		},
+		{
+			name: "corrupted tail",
+			damage: func(data []byte) []byte {
+				data[len(data)-3] ^= 0xff
+				return data
+			},
+			expNotes: 1,
+		},
+		{
+			name: "corrupted middle",
+			damage: func(data []byte) []byte {
+				data[12] ^= 0xff
+				return data
+			},
+			expErr: ErrCorruptLog,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			repo, err := OpenInMemoryDataBase(dir)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			repo.Create(context.Background(), NoteDTO{Title: "t1"})
+			repo.Create(context.Background(), NoteDTO{Title: "t2"})
+			repo.Close()
+
+			path := filepath.Join(dir, logFileName)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := os.WriteFile(path, testCase.damage(data), 0o644); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			repo, err = OpenInMemoryDataBase(dir)
+			if !errors.Is(err, testCase.expErr) {
+				t.Fatalf("expected error %v, got %v", testCase.expErr, err)
+			}
+			if testCase.expErr != nil {
+				return
+			}
+			defer repo.Close()
+
+			notes, _ := repo.GetAll(context.Background())
+			if len(notes) != testCase.expNotes {
+				t.Fatalf("expected %d notes, got %d", testCase.expNotes, len(notes))
+			}
+
+			if _, err := repo.Create(context.Background(), NoteDTO{Title: "t3"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			repo.Close()
+
+			repo, err = OpenInMemoryDataBase(dir)
+			if err != nil {
+				t.Fatalf("reopen after append: unexpected error: %v", err)
+			}
+			defer repo.Close()
+
+			notes, _ = repo.GetAll(context.Background())
+			if len(notes) != testCase.expNotes+1 {
+				t.Errorf("expected %d notes after append, got %d", testCase.expNotes+1, len(notes))
+			}
+		})
+	}
+}
@@ -3,17 +3,47 @@ package router
 import (
 	"net/http"
 
+	"github.com/fwhyjke/golang_test/internal/events"
 	"github.com/fwhyjke/golang_test/internal/handler"
 	"github.com/fwhyjke/golang_test/internal/middleware"
 	"github.com/fwhyjke/golang_test/internal/repository"
+	"github.com/fwhyjke/golang_test/internal/webhooks"
 )
 
-func NewToDoServerMux(db *repository.InMemoryDataBase) *http.ServeMux {
+func NewToDoServerMux(db *repository.InMemoryDataBase, bus *events.Bus, hooks webhooks.Manager, tokens middleware.TenantTokens, adminToken string, opts ...handler.Option) *http.ServeMux {
 	mux := http.NewServeMux()
-	h := handler.NewHandler(db)
+	h := handler.NewHandler(db, opts...)
+	tags := handler.NewTagHandler(db)
+	lists := handler.NewListHandler(db, h)
+	trash := handler.NewTrashHandler(db)
+	admin := handler.NewAdminHandler(db)
+	stream := handler.NewEventsHandler(bus)
+	ws := handler.NewSyncHandler(h, bus)
+	subscriptions := handler.NewWebhookHandler(hooks)
+	tenant := middleware.TenantMiddleware(tokens)
 
-	mux.Handle("/todos", middleware.Chain(h.HandleToDo(), middleware.LoggingMiddleware, middleware.TimeoutMiddleware))
-	mux.Handle("/todos/", middleware.Chain(h.HandleToDoByID(), middleware.LoggingMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/todos", middleware.Chain(h.HandleToDo(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/todos/search", middleware.Chain(h.HandleSearch(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/todos/agenda", middleware.Chain(h.HandleAgenda(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/todos/order", middleware.Chain(h.HandleExecutionOrder(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/todos/unblocked", middleware.Chain(h.HandleUnblocked(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/todos/batch", middleware.Chain(h.HandleBatch(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/todos/events", middleware.Chain(stream.HandleEvents(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware))
+	mux.Handle("/todos/ws", middleware.Chain(ws.HandleSync(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware))
+	mux.Handle("/todos/", middleware.Chain(h.HandleToDoByID(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/tags", middleware.Chain(tags.HandleTags(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/tags/", middleware.Chain(tags.HandleTagByID(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/lists", middleware.Chain(lists.HandleLists(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/lists/", middleware.Chain(lists.HandleListByID(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/trash", middleware.Chain(trash.HandleTrash(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/trash/", middleware.Chain(trash.HandleTrashByID(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/webhooks", middleware.Chain(subscriptions.HandleWebhooks(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	mux.Handle("/webhooks/", middleware.Chain(subscriptions.HandleWebhookByID(), middleware.LoggingMiddleware, tenant, middleware.ActorMiddleware, middleware.TimeoutMiddleware))
+	// Compaction locks every tenant, so it is served only to the admin and
+	// only if there is a log to compact.
+	if adminToken != "" && db.Persistent() {
+		mux.Handle("/admin/compact", middleware.Chain(admin.HandleCompact(), middleware.LoggingMiddleware, middleware.AdminMiddleware(adminToken), middleware.TimeoutMiddleware))
+	}
 
 	return mux
 }
@@ -0,0 +1,106 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fwhyjke/golang_test/internal/events"
+	"github.com/fwhyjke/golang_test/internal/middleware"
+	"github.com/fwhyjke/golang_test/internal/repository"
+	"github.com/fwhyjke/golang_test/internal/webhooks"
+)
+
+func TestAuthentication(t *testing.T) {
+	db, err := repository.OpenInMemoryDataBase(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	bus := events.NewBus(10)
+	t.Cleanup(bus.Close)
+	hooks := webhooks.NewDispatcher(bus)
+	t.Cleanup(hooks.Close)
+
+	tokens := middleware.TenantTokens{}
+	tokens.Add("acme-token", "acme")
+	mux := NewToDoServerMux(db, bus, hooks, tokens, "admin-token")
+
+	testTable := []struct {
+		name      string
+		method    string
+		url       string
+		header    http.Header
+		expStatus int
+	}{
+		{
+			name:      "todos without token",
+			method:    http.MethodGet,
+			url:       "/todos",
+			expStatus: http.StatusUnauthorized,
+		},
+		{
+			name:      "todos with tenant header",
+			method:    http.MethodGet,
+			url:       "/todos",
+			header:    http.Header{"X-Tenant-Id": {"acme"}},
+			expStatus: http.StatusUnauthorized,
+		},
+		{
+			name:      "todos with tenant token",
+			method:    http.MethodGet,
+			url:       "/todos",
+			header:    http.Header{"Authorization": {"Bearer acme-token"}},
+			expStatus: http.StatusOK,
+		},
+		{
+			name:      "compact without token",
+			method:    http.MethodPost,
+			url:       "/admin/compact",
+			expStatus: http.StatusUnauthorized,
+		},
+		{
+			name:      "compact with tenant token",
+			method:    http.MethodPost,
+			url:       "/admin/compact",
+			header:    http.Header{"Authorization": {"Bearer acme-token"}},
+			expStatus: http.StatusUnauthorized,
+		},
+		{
+			name:      "compact with admin token",
+			method:    http.MethodPost,
+			url:       "/admin/compact",
+			header:    http.Header{"Authorization": {"Bearer admin-token"}},
+			expStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testCase.method, testCase.url, nil)
+			for name, values := range testCase.header {
+				req.Header[name] = values
+			}
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+		})
+	}
+
+	t.Run("compact without data dir", func(t *testing.T) {
+		mux := NewToDoServerMux(repository.NewInMemoryDataBase(), bus, hooks, tokens, "admin-token")
+		req := httptest.NewRequest(http.MethodPost, "/admin/compact", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		rec := httptest.NewRecorder()
+
+		mux.ServeHTTP(rec, req)
+
+		if status := rec.Code; status != http.StatusNotFound {
+			t.Errorf("status code: expected %v, got %v", http.StatusNotFound, status)
+		}
+	})
+}
@@ -0,0 +1,679 @@
+package webhooks
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/bits"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fwhyjke/golang_test/internal/events"
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a delivery is tried before it goes
+	// to the dead-letter list.
+	DefaultMaxAttempts = 5
+	// DefaultBaseDelay is the delay before the first retry; every next retry
+	// waits twice as long, up to DefaultMaxDelay.
+	DefaultBaseDelay = 10 * time.Second
+	DefaultMaxDelay  = 10 * time.Minute
+	// DefaultLogLimit is how many delivered deliveries are kept for every
+	// webhook.
+	DefaultLogLimit = 100
+	// DefaultDeadLimit is how many failed deliveries every webhook keeps in
+	// the dead-letter list; the oldest are dropped first.
+	DefaultDeadLimit = 100
+	// DefaultPendingLimit is how many deliveries of a webhook may wait for an
+	// attempt at once; newer events are not sent to it until some finish.
+	DefaultPendingLimit = 1000
+)
+
+// workers limits how many deliveries are sent at once.
+const workers = 8
+
+// requestTimeout limits one delivery attempt.
+const requestTimeout = 10 * time.Second
+
+type Option func(d *Dispatcher)
+
+// WithMaxAttempts sets how many times a delivery is tried.
+func WithMaxAttempts(n int) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = max(n, 1)
+	}
+}
+
+// WithBackoff sets the delay before the first retry and the longest delay
+// between retries.
+func WithBackoff(base time.Duration, limit time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.baseDelay = base
+		d.maxDelay = max(limit, base)
+	}
+}
+
+// WithPrivateNetworks lets webhooks point to loopback, private and
+// link-local addresses, which are refused by default.
+func WithPrivateNetworks() Option {
+	return func(d *Dispatcher) {
+		d.allowPrivate = true
+	}
+}
+
+// WithClient replaces the HTTP client the deliveries are sent with. The
+// client is used as is, without the check of the addresses it dials.
+func WithClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// Dispatcher keeps the webhooks of every tenant in memory and sends them the
+// events of a bus. Deliveries are sent concurrently, so a webhook may get
+// events out of order; Delivery.EventSeq tells the order.
+type Dispatcher struct {
+	bus         *events.Bus
+	client      *http.Client
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	logLimit    int
+	deadLimit   int
+	pendLimit   int
+
+	allowPrivate bool
+	resolver     *net.Resolver
+
+	mu      sync.Mutex
+	tenants map[string]*tenantHooks
+	closed  bool
+	sub     *events.Subscription
+
+	sem  chan struct{}
+	wg   sync.WaitGroup
+	done chan struct{}
+}
+
+// tenantHooks holds the webhooks of one tenant. IDs are given out per tenant.
+type tenantHooks struct {
+	hooks         map[uint64]*hookState
+	idGen         uint64
+	deliveryIDGen uint64
+}
+
+// hookState is a webhook with its deliveries: log holds the pending and the
+// last delivered ones, dead the failed ones.
+type hookState struct {
+	hook    Webhook
+	log     []*delivery
+	dead    []*delivery
+	pending int
+}
+
+type delivery struct {
+	Delivery
+	tenant  string
+	payload []byte
+	tries   int
+	timer   *time.Timer
+}
+
+// NewDispatcher starts sending the events published on bus from now on to the
+// registered webhooks.
+func NewDispatcher(bus *events.Bus, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		bus:         bus,
+		resolver:    net.DefaultResolver,
+		maxAttempts: DefaultMaxAttempts,
+		baseDelay:   DefaultBaseDelay,
+		maxDelay:    DefaultMaxDelay,
+		logLimit:    DefaultLogLimit,
+		deadLimit:   DefaultDeadLimit,
+		pendLimit:   DefaultPendingLimit,
+		tenants:     make(map[string]*tenantHooks),
+		sem:         make(chan struct{}, workers),
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.client == nil {
+		d.client = newClient(d.allowPrivate)
+	}
+
+	d.sub = bus.Subscribe(events.DefaultBuffer, nil)
+	go d.run()
+	return d
+}
+
+// Close stops taking events and cancels the retries that are not running yet.
+// It waits for the running attempts to finish.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	d.closed = true
+	sub := d.sub
+	for _, th := range d.tenants {
+		for _, hs := range th.hooks {
+			for _, del := range hs.log {
+				d.cancel(del)
+			}
+		}
+	}
+	d.mu.Unlock()
+
+	sub.Close()
+	<-d.done
+	d.wg.Wait()
+}
+
+// run turns the events of the bus into deliveries. If the dispatcher falls
+// behind and is dropped by the bus, it resumes from the events the bus keeps.
+func (d *Dispatcher) run() {
+	defer close(d.done)
+
+	sub := d.sub
+	var last uint64
+	for {
+		for ev := range sub.Events() {
+			d.enqueue(ev)
+			last = ev.Seq
+		}
+		if sub.Err() != events.ErrSlowConsumer {
+			return
+		}
+
+		var ok bool
+		sub, ok = d.bus.SubscribeFrom(last, events.DefaultBuffer, nil)
+		if !ok {
+			log.Printf("webhooks: events after %d were lost", last)
+		}
+
+		d.mu.Lock()
+		if d.closed {
+			d.mu.Unlock()
+			sub.Close()
+			return
+		}
+		d.sub = sub
+		d.mu.Unlock()
+	}
+}
+
+func (d *Dispatcher) enqueue(ev repository.Event) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("webhooks: event %d: %s", ev.Seq, err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	th, ok := d.tenants[ev.Tenant]
+	if !ok || d.closed {
+		return
+	}
+	for _, id := range sortedIDs(th.hooks) {
+		hs := th.hooks[id]
+		if !hs.hook.wants(ev.Type) {
+			continue
+		}
+		if hs.pending >= d.pendLimit {
+			log.Printf("webhooks: webhook %d has %d pending deliveries, event %d is not sent", id, hs.pending, ev.Seq)
+			continue
+		}
+		th.deliveryIDGen++
+		del := &delivery{
+			Delivery: Delivery{
+				ID:        th.deliveryIDGen,
+				WebhookID: id,
+				EventSeq:  ev.Seq,
+				EventType: ev.Type,
+				Status:    DeliveryPending,
+			},
+			tenant:  ev.Tenant,
+			payload: payload,
+		}
+		hs.log = append(hs.log, del)
+		hs.pending++
+		d.schedule(del, 0)
+	}
+}
+
+// finish ends the attempts of the pending del. A failed delivery moves to the
+// dead letters, which drop their oldest entries beyond deadLimit; a delivered
+// one stays in the log, which drops its oldest delivered entries beyond
+// logLimit.
+func (hs *hookState) finish(del *delivery, status DeliveryStatus, logLimit int, deadLimit int) {
+	del.Status = status
+	hs.pending--
+	if status == DeliveryFailed {
+		hs.log = slices.DeleteFunc(hs.log, func(old *delivery) bool { return old == del })
+		hs.dead = append(hs.dead, del)
+		if len(hs.dead) > deadLimit {
+			hs.dead = slices.Delete(hs.dead, 0, len(hs.dead)-deadLimit)
+		}
+		return
+	}
+
+	delivered := len(hs.log) - hs.pending
+	hs.log = slices.DeleteFunc(hs.log, func(old *delivery) bool {
+		if delivered > logLimit && old.Status == DeliveryDelivered {
+			delivered--
+			return true
+		}
+		return false
+	})
+}
+
+// find returns the delivery with the given ID from the log or the dead
+// letters.
+func (hs *hookState) find(id uint64) (*delivery, bool) {
+	for _, list := range [][]*delivery{hs.log, hs.dead} {
+		if i := slices.IndexFunc(list, func(del *delivery) bool { return del.ID == id }); i >= 0 {
+			return list[i], true
+		}
+	}
+	return nil, false
+}
+
+// schedule makes the next attempt of del after delay. Callers must hold d.mu.
+func (d *Dispatcher) schedule(del *delivery, delay time.Duration) {
+	next := time.Now().Add(delay)
+	del.NextAttemptAt = &next
+	d.wg.Add(1)
+	del.timer = time.AfterFunc(delay, func() {
+		defer d.wg.Done()
+		d.attempt(del)
+	})
+}
+
+// cancel stops the pending attempt of del, if any. Callers must hold d.mu.
+func (d *Dispatcher) cancel(del *delivery) {
+	if del.timer != nil && del.timer.Stop() {
+		d.wg.Done()
+	}
+	del.timer = nil
+}
+
+// backoff returns the delay before the retry that follows attempt n: it
+// doubles with every attempt and is spread randomly over its upper half.
+func (d *Dispatcher) backoff(n int) time.Duration {
+	if d.baseDelay <= 0 {
+		return 0
+	}
+	delay := d.maxDelay
+	if n-1 < bits.Len64(uint64(d.maxDelay/d.baseDelay)) {
+		delay = min(d.baseDelay<<(n-1), d.maxDelay)
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+func (d *Dispatcher) attempt(del *delivery) {
+	d.sem <- struct{}{}
+	defer func() { <-d.sem }()
+
+	d.mu.Lock()
+	hs, ok := d.hook(del.tenant, del.WebhookID)
+	if !ok || d.closed || del.timer == nil {
+		d.mu.Unlock()
+		return
+	}
+	target, secret := hs.hook.URL, hs.hook.Secret
+	del.timer = nil
+	d.mu.Unlock()
+
+	start := time.Now()
+	status, err := d.send(target, secret, del)
+	a := Attempt{At: start, StatusCode: status, DurationMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		a.Error = err.Error()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Only the latest maxAttempts attempts are kept, so redelivering again
+	// and again does not grow the delivery.
+	del.Attempts = append(del.Attempts, a)
+	if len(del.Attempts) > d.maxAttempts {
+		del.Attempts = slices.Delete(del.Attempts, 0, len(del.Attempts)-d.maxAttempts)
+	}
+	del.tries++
+	del.NextAttemptAt = nil
+	switch {
+	case err == nil:
+		hs.finish(del, DeliveryDelivered, d.logLimit, d.deadLimit)
+	case del.tries >= d.maxAttempts:
+		hs.finish(del, DeliveryFailed, d.logLimit, d.deadLimit)
+		log.Printf("webhooks: delivery %d to webhook %d failed after %d attempts: %s", del.ID, del.WebhookID, del.tries, err)
+	case !d.closed:
+		d.schedule(del, d.backoff(del.tries))
+	}
+}
+
+// send posts the event of del to target and returns the status code of the
+// answer. Any answer but 2xx is an error.
+func (d *Dispatcher) send(target string, secret string, del *delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(del.payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "golang_test-webhooks")
+	req.Header.Set("X-Webhook-ID", strconv.FormatUint(del.WebhookID, 10))
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(del.ID, 10))
+	req.Header.Set("X-Webhook-Event", string(del.EventType))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", Sign(secret, timestamp, del.payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+// newClient returns the client deliveries are sent with. Unless allowPrivate
+// is set, it refuses to connect to the addresses checkHost rejects, so a host
+// that resolves elsewhere after it was registered, or a redirect, cannot
+// reach the network of the server.
+func newClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network string, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || blocked(addr) {
+				return fmt.Errorf("dial %s: %w", address, ErrPrivateAddress)
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: requestTimeout, Transport: transport}
+}
+
+// checkURL checks the URL of dto before it is registered. Callers must not
+// hold d.mu, since the host may be resolved.
+func (d *Dispatcher) checkURL(ctx context.Context, dto WebhookDTO) error {
+	if err := checkWebhook(dto); err != nil {
+		return err
+	}
+	if d.allowPrivate {
+		return nil
+	}
+	return checkHost(ctx, d.resolver, dto.URL)
+}
+
+// Sign returns the X-Webhook-Signature of a delivery: the hex HMAC-SHA256 of
+// the timestamp, a dot and the body, keyed with the secret of the webhook.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// hook returns the webhook id of tenant. Callers must hold d.mu.
+func (d *Dispatcher) hook(tenant string, id uint64) (*hookState, bool) {
+	th, ok := d.tenants[tenant]
+	if !ok {
+		return nil, false
+	}
+	hs, ok := th.hooks[id]
+	return hs, ok
+}
+
+func sortedIDs(hooks map[uint64]*hookState) []uint64 {
+	ids := make([]uint64, 0, len(hooks))
+	for id := range hooks {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (d *Dispatcher) CreateWebhook(ctx context.Context, dto WebhookDTO) (Webhook, error) {
+	if err := d.checkURL(ctx, dto); err != nil {
+		return Webhook{}, err
+	}
+	if dto.Secret == "" {
+		dto.Secret = newSecret()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tenant := repository.TenantFrom(ctx)
+	th, ok := d.tenants[tenant]
+	if !ok {
+		th = &tenantHooks{hooks: make(map[uint64]*hookState)}
+		d.tenants[tenant] = th
+	}
+
+	th.idGen++
+	now := time.Now()
+	hook := Webhook{
+		ID:        th.idGen,
+		URL:       dto.URL,
+		Events:    slices.Clone(dto.Events),
+		Secret:    dto.Secret,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	th.hooks[hook.ID] = &hookState{hook: hook}
+	return hook, nil
+}
+
+func (d *Dispatcher) GetWebhook(ctx context.Context, id uint64) (Webhook, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hs, ok := d.hook(repository.TenantFrom(ctx), id)
+	if !ok {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	return hs.public(), nil
+}
+
+func (d *Dispatcher) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	res := []Webhook{}
+	th, ok := d.tenants[repository.TenantFrom(ctx)]
+	if !ok {
+		return res, nil
+	}
+	for _, id := range sortedIDs(th.hooks) {
+		res = append(res, th.hooks[id].public())
+	}
+	return res, nil
+}
+
+func (d *Dispatcher) UpdateWebhook(ctx context.Context, id uint64, dto WebhookDTO) (Webhook, error) {
+	if err := d.checkURL(ctx, dto); err != nil {
+		return Webhook{}, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hs, ok := d.hook(repository.TenantFrom(ctx), id)
+	if !ok {
+		return Webhook{}, ErrWebhookNotFound
+	}
+	hs.hook.URL = dto.URL
+	hs.hook.Events = slices.Clone(dto.Events)
+	hs.hook.UpdatedAt = time.Now()
+	if dto.Secret == "" {
+		return hs.public(), nil
+	}
+	hs.hook.Secret = dto.Secret
+	return hs.hook, nil
+}
+
+// DeleteWebhook removes a webhook together with its deliveries; their pending
+// retries are cancelled.
+func (d *Dispatcher) DeleteWebhook(ctx context.Context, id uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	tenant := repository.TenantFrom(ctx)
+	hs, ok := d.hook(tenant, id)
+	if !ok {
+		return ErrWebhookNotFound
+	}
+	for _, del := range hs.log {
+		d.cancel(del)
+	}
+	delete(d.tenants[tenant].hooks, id)
+	return nil
+}
+
+func (d *Dispatcher) Deliveries(ctx context.Context, id uint64) ([]Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hs, ok := d.hook(repository.TenantFrom(ctx), id)
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	res := make([]Delivery, 0, len(hs.log)+len(hs.dead))
+	for _, del := range slices.Concat(hs.log, hs.dead) {
+		res = append(res, del.public())
+	}
+	slices.SortFunc(res, func(a, b Delivery) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return res, nil
+}
+
+// DeadLetters returns the failed deliveries of all webhooks of the tenant.
+func (d *Dispatcher) DeadLetters(ctx context.Context) ([]Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	res := []Delivery{}
+	th, ok := d.tenants[repository.TenantFrom(ctx)]
+	if !ok {
+		return res, nil
+	}
+	for _, hs := range th.hooks {
+		for _, del := range hs.dead {
+			res = append(res, del.public())
+		}
+	}
+	slices.SortFunc(res, func(a, b Delivery) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return res, nil
+}
+
+// Redeliver sends a finished delivery again, with a fresh set of attempts.
+func (d *Dispatcher) Redeliver(ctx context.Context, id uint64, deliveryID uint64) (Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hs, ok := d.hook(repository.TenantFrom(ctx), id)
+	if !ok {
+		return Delivery{}, ErrWebhookNotFound
+	}
+	del, ok := hs.find(deliveryID)
+	if !ok {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	if del.Status == DeliveryPending {
+		return Delivery{}, ErrDeliveryPending
+	}
+	if hs.pending >= d.pendLimit {
+		return Delivery{}, ErrTooManyPending
+	}
+
+	if del.Status == DeliveryFailed {
+		hs.dead = slices.DeleteFunc(hs.dead, func(old *delivery) bool { return old == del })
+		hs.log = append(hs.log, del)
+	}
+	del.Status = DeliveryPending
+	del.tries = 0
+	hs.pending++
+	if !d.closed {
+		d.schedule(del, 0)
+	}
+	return del.public(), nil
+}
+
+// DeleteDelivery removes a finished delivery, which is how a dead letter that
+// is not going to be sent again is cleared.
+func (d *Dispatcher) DeleteDelivery(ctx context.Context, id uint64, deliveryID uint64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hs, ok := d.hook(repository.TenantFrom(ctx), id)
+	if !ok {
+		return ErrWebhookNotFound
+	}
+	del, ok := hs.find(deliveryID)
+	if !ok {
+		return ErrDeliveryNotFound
+	}
+	if del.Status == DeliveryPending {
+		return ErrDeliveryPending
+	}
+
+	remove := func(old *delivery) bool { return old == del }
+	hs.log = slices.DeleteFunc(hs.log, remove)
+	hs.dead = slices.DeleteFunc(hs.dead, remove)
+	return nil
+}
+
+// public returns the webhook without its secret.
+func (hs *hookState) public() Webhook {
+	hook := hs.hook
+	hook.Secret = ""
+	hook.Events = slices.Clone(hook.Events)
+	return hook
+}
+
+func (del *delivery) public() Delivery {
+	res := del.Delivery
+	res.Attempts = slices.Clone(res.Attempts)
+	if res.Attempts == nil {
+		res.Attempts = []Attempt{}
+	}
+	return res
+}
@@ -0,0 +1,342 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fwhyjke/golang_test/internal/events"
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+// receiver is a webhook endpoint that answers with the given status codes in
+// turn, then with 200, and checks the signature of every request.
+type receiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	statuses []int
+	got      []string
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	timestamp, err := strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+	if err != nil {
+		rc.t.Errorf("timestamp: %v", err)
+	}
+	if sig := r.Header.Get("X-Webhook-Signature"); sig != Sign(rc.secret, timestamp, body) {
+		rc.t.Errorf("signature: unexpected %v", sig)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.got = append(rc.got, r.Header.Get("X-Webhook-Event"))
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) requests() []string {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]string(nil), rc.got...)
+}
+
+// settle waits until no delivery of webhook id is pending.
+func settle(t *testing.T, d *Dispatcher, ctx context.Context, id uint64, want int) []Delivery {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := d.Deliveries(ctx, id)
+		if err != nil {
+			t.Fatalf("deliveries: %v", err)
+		}
+		done := len(deliveries) == want
+		for _, del := range deliveries {
+			done = done && del.Status != DeliveryPending
+		}
+		if done {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries: still pending: %+v", deliveries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitFor waits until the delivery of the event seq to webhook id is in the
+// log, still pending or not as asked.
+func waitFor(t *testing.T, d *Dispatcher, ctx context.Context, id uint64, seq uint64, pending bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, _ := d.Deliveries(ctx, id)
+		if slices.ContainsFunc(deliveries, func(del Delivery) bool {
+			return del.EventSeq == seq && (del.Status == DeliveryPending) == pending
+		}) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries: event %d not found: %+v", seq, deliveries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	bus := events.NewBus(0)
+	defer bus.Close()
+	d := NewDispatcher(bus, WithMaxAttempts(3), WithBackoff(time.Millisecond, 5*time.Millisecond), WithPrivateNetworks())
+	defer d.Close()
+
+	acme := repository.WithTenant(context.Background(), "acme")
+	rc := &receiver{t: t, secret: "s3cret", statuses: []int{http.StatusInternalServerError}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	hook, err := d.CreateWebhook(acme, WebhookDTO{URL: srv.URL, Events: []repository.EventType{repository.NoteCreated}, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := d.CreateWebhook(acme, WebhookDTO{URL: "ftp://example.com"}); !errors.Is(err, ErrInvalidURL) {
+		t.Errorf("create: expected %v, got %v", ErrInvalidURL, err)
+	}
+	if got, _ := d.GetWebhook(acme, hook.ID); got.Secret != "" {
+		t.Errorf("get: expected the secret to be hidden")
+	}
+	if _, err := d.GetWebhook(context.Background(), hook.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("other tenant: expected %v, got %v", ErrWebhookNotFound, err)
+	}
+
+	bus.Publish(
+		repository.Event{Type: repository.NoteCreated, Tenant: "acme", NoteID: 1},
+		repository.Event{Type: repository.NoteUpdated, Tenant: "acme", NoteID: 1},
+		repository.Event{Type: repository.NoteCreated, Tenant: repository.DefaultTenant, NoteID: 1},
+	)
+
+	deliveries := settle(t, d, acme, hook.ID, 1)
+	if del := deliveries[0]; del.Status != DeliveryDelivered || len(del.Attempts) != 2 || del.EventSeq != 1 {
+		t.Errorf("retry: expected delivered on the second attempt, got %+v", del)
+	}
+	if del := deliveries[0]; del.Attempts[0].StatusCode != http.StatusInternalServerError || del.Attempts[0].Error == "" {
+		t.Errorf("retry: expected the failed attempt to be logged, got %+v", del.Attempts[0])
+	}
+
+	rc.mu.Lock()
+	rc.statuses = []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}
+	rc.mu.Unlock()
+	bus.Publish(repository.Event{Type: repository.NoteCreated, Tenant: "acme", NoteID: 2})
+
+	deliveries = settle(t, d, acme, hook.ID, 2)
+	dead, _ := d.DeadLetters(acme)
+	if len(dead) != 1 || dead[0].ID != deliveries[1].ID || len(dead[0].Attempts) != 3 {
+		t.Fatalf("dead letters: expected delivery %d after 3 attempts, got %+v", deliveries[1].ID, dead)
+	}
+
+	if _, err := d.Redeliver(acme, hook.ID, dead[0].ID); err != nil {
+		t.Fatalf("redeliver: %v", err)
+	}
+	deliveries = settle(t, d, acme, hook.ID, 2)
+	if del := deliveries[1]; del.Status != DeliveryDelivered || len(del.Attempts) != 3 || del.Attempts[2].StatusCode != http.StatusOK {
+		t.Errorf("redeliver: expected delivered on the fourth attempt with the last 3 attempts kept, got %+v", del)
+	}
+	if dead, _ := d.DeadLetters(acme); len(dead) != 0 {
+		t.Errorf("dead letters: expected none after redelivery, got %+v", dead)
+	}
+	if _, err := d.Redeliver(acme, hook.ID, 99); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("redeliver: expected %v, got %v", ErrDeliveryNotFound, err)
+	}
+
+	if got := rc.requests(); len(got) != 6 {
+		t.Errorf("requests: expected 6 note.created, got %v", got)
+	}
+
+	if err := d.DeleteWebhook(acme, hook.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := d.Deliveries(acme, hook.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("deleted: expected %v, got %v", ErrWebhookNotFound, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{baseDelay: time.Second, maxDelay: 10 * time.Second}
+	defaults := &Dispatcher{baseDelay: DefaultBaseDelay, maxDelay: DefaultMaxDelay}
+
+	testTable := []struct {
+		attempt int
+		min     time.Duration
+		max     time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{4, 4 * time.Second, 8 * time.Second},
+		{5, 5 * time.Second, 10 * time.Second},
+		{100, 5 * time.Second, 10 * time.Second},
+	}
+
+	for _, testCase := range testTable {
+		for range 20 {
+			if delay := d.backoff(testCase.attempt); delay < testCase.min || delay > testCase.max {
+				t.Errorf("attempt %d: expected a delay in [%v, %v], got %v", testCase.attempt, testCase.min, testCase.max, delay)
+			}
+		}
+	}
+
+	for n := 1; n <= 100; n++ {
+		if delay := defaults.backoff(n); delay < DefaultBaseDelay/2 || delay > DefaultMaxDelay {
+			t.Errorf("default attempt %d: expected a delay in [%v, %v], got %v", n, DefaultBaseDelay/2, DefaultMaxDelay, delay)
+		}
+	}
+}
+
+func TestDeliveryLimits(t *testing.T) {
+	bus := events.NewBus(0)
+	defer bus.Close()
+	d := NewDispatcher(bus, WithMaxAttempts(1), WithBackoff(time.Millisecond, time.Millisecond), WithPrivateNetworks())
+	defer d.Close()
+	d.logLimit = 2
+	d.pendLimit = 1
+
+	ctx := context.Background()
+	rc := &receiver{t: t, secret: "s3cret", statuses: []int{http.StatusInternalServerError}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+	hook, err := d.CreateWebhook(ctx, WebhookDTO{URL: srv.URL, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	for i := range 4 {
+		bus.Publish(repository.Event{Type: repository.NoteCreated, Tenant: repository.DefaultTenant, NoteID: uint64(i + 1)})
+		waitFor(t, d, ctx, hook.ID, uint64(i+1), false)
+	}
+
+	deliveries, _ := d.Deliveries(ctx, hook.ID)
+	if len(deliveries) != 3 || deliveries[0].Status != DeliveryFailed || deliveries[1].ID != 3 || deliveries[2].ID != 4 {
+		t.Errorf("log: expected the dead letter and the last 2 delivered, got %+v", deliveries)
+	}
+	dead, _ := d.DeadLetters(ctx)
+	if len(dead) != 1 || dead[0].ID != 1 {
+		t.Fatalf("dead letters: expected delivery 1 to outlive the log limit, got %+v", dead)
+	}
+
+	if err := d.DeleteDelivery(ctx, hook.ID, 1); err != nil {
+		t.Fatalf("delete delivery: %v", err)
+	}
+	if dead, _ := d.DeadLetters(ctx); len(dead) != 0 {
+		t.Errorf("dead letters: expected none after delete, got %+v", dead)
+	}
+
+	release := make(chan struct{})
+	blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer blocked.Close()
+	defer close(release)
+	if _, err := d.UpdateWebhook(ctx, hook.ID, WebhookDTO{URL: blocked.URL}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	bus.Publish(
+		repository.Event{Type: repository.NoteCreated, Tenant: repository.DefaultTenant, NoteID: 5},
+		repository.Event{Type: repository.NoteCreated, Tenant: repository.DefaultTenant, NoteID: 6},
+	)
+	waitFor(t, d, ctx, hook.ID, 5, true)
+	time.Sleep(20 * time.Millisecond)
+	deliveries, _ = d.Deliveries(ctx, hook.ID)
+	if len(deliveries) != 3 || deliveries[2].EventSeq != 5 || deliveries[2].Status != DeliveryPending {
+		t.Errorf("pending limit: expected only the event 5 to wait, got %+v", deliveries)
+	}
+	if err := d.DeleteDelivery(ctx, hook.ID, deliveries[2].ID); !errors.Is(err, ErrDeliveryPending) {
+		t.Errorf("delete pending: expected %v, got %v", ErrDeliveryPending, err)
+	}
+}
+
+func TestDeadLetterLimit(t *testing.T) {
+	bus := events.NewBus(0)
+	defer bus.Close()
+	d := NewDispatcher(bus, WithMaxAttempts(2), WithBackoff(time.Millisecond, time.Millisecond), WithPrivateNetworks())
+	defer d.Close()
+	d.deadLimit = 2
+
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	hook, err := d.CreateWebhook(ctx, WebhookDTO{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	for i := range 3 {
+		bus.Publish(repository.Event{Type: repository.NoteCreated, Tenant: repository.DefaultTenant, NoteID: uint64(i + 1)})
+		waitFor(t, d, ctx, hook.ID, uint64(i+1), false)
+	}
+	dead, _ := d.DeadLetters(ctx)
+	if len(dead) != 2 || dead[0].ID != 2 || dead[1].ID != 3 {
+		t.Fatalf("dead letters: expected the last 2, got %+v", dead)
+	}
+
+	for range 3 {
+		if _, err := d.Redeliver(ctx, hook.ID, 3); err != nil {
+			t.Fatalf("redeliver: %v", err)
+		}
+		waitFor(t, d, ctx, hook.ID, 3, false)
+	}
+	dead, _ = d.DeadLetters(ctx)
+	if len(dead) != 2 || dead[1].ID != 3 || len(dead[1].Attempts) != 2 {
+		t.Errorf("redelivered dead letter: expected 2 attempts kept, got %+v", dead)
+	}
+}
+
+func TestPrivateAddresses(t *testing.T) {
+	bus := events.NewBus(0)
+	defer bus.Close()
+	d := NewDispatcher(bus)
+	defer d.Close()
+
+	testTable := []struct {
+		url    string
+		expErr error
+	}{
+		{url: "http://127.0.0.1:8080/hook", expErr: ErrPrivateAddress},
+		{url: "http://localhost/hook", expErr: ErrPrivateAddress},
+		{url: "http://169.254.169.254/latest/meta-data", expErr: ErrPrivateAddress},
+		{url: "http://10.1.2.3/", expErr: ErrPrivateAddress},
+		{url: "http://192.168.0.1/", expErr: ErrPrivateAddress},
+		{url: "http://0.0.0.0/", expErr: ErrPrivateAddress},
+		{url: "http://[::1]/", expErr: ErrPrivateAddress},
+		{url: "http://[::ffff:10.0.0.1]/", expErr: ErrPrivateAddress},
+		{url: "http://[fe80::1]/", expErr: ErrPrivateAddress},
+		{url: "https://93.184.216.34/hook"},
+	}
+
+	ctx := context.Background()
+	for _, testCase := range testTable {
+		_, err := d.CreateWebhook(ctx, WebhookDTO{URL: testCase.url})
+		if !errors.Is(err, testCase.expErr) {
+			t.Errorf("%s: expected %v, got %v", testCase.url, testCase.expErr, err)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	if _, err := newClient(false).Get(srv.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("dial: expected %v, got %v", ErrPrivateAddress, err)
+	}
+	if _, err := newClient(true).Get(srv.URL); err != nil {
+		t.Errorf("dial with private networks: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package webhooks posts the change events of the repository to the URLs
+// registered by every tenant, retrying failed deliveries.
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/fwhyjke/golang_test/internal/repository"
+)
+
+var ErrWebhookNotFound error = errors.New("webhook not found")
+var ErrDeliveryNotFound error = errors.New("delivery not found")
+var ErrInvalidURL error = errors.New("url must be an absolute http or https URL")
+var ErrPrivateAddress error = errors.New("url must not point to a loopback, private, link-local or unspecified address")
+var ErrInvalidEventType error = errors.New("unknown event type")
+var ErrDeliveryPending error = errors.New("delivery is still in progress")
+var ErrTooManyPending error = errors.New("webhook has too many pending deliveries")
+
+// Manager registers webhooks and reports their deliveries. Every method works
+// on the webhooks of the tenant of ctx.
+type Manager interface {
+	CreateWebhook(ctx context.Context, dto WebhookDTO) (Webhook, error)
+	GetWebhook(ctx context.Context, id uint64) (Webhook, error)
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	UpdateWebhook(ctx context.Context, id uint64, dto WebhookDTO) (Webhook, error)
+	DeleteWebhook(ctx context.Context, id uint64) error
+	Deliveries(ctx context.Context, id uint64) ([]Delivery, error)
+	DeadLetters(ctx context.Context) ([]Delivery, error)
+	Redeliver(ctx context.Context, id uint64, deliveryID uint64) (Delivery, error)
+	DeleteDelivery(ctx context.Context, id uint64, deliveryID uint64) error
+}
+
+// Webhook is a URL that gets the events of the types in Events, or of all
+// types if Events is empty. Secret is only shown when it is set.
+type Webhook struct {
+	ID        uint64                 `json:"id"`
+	URL       string                 `json:"url"`
+	Events    []repository.EventType `json:"events,omitempty"`
+	Secret    string                 `json:"secret,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+// WebhookDTO registers or changes a webhook. An empty Secret makes a new
+// random one on create and keeps the old one on update.
+type WebhookDTO struct {
+	URL    string                 `json:"url"`
+	Events []repository.EventType `json:"events,omitempty"`
+	Secret string                 `json:"secret,omitempty"`
+}
+
+// DeliveryStatus tells where a delivery is in its life.
+type DeliveryStatus string
+
+const (
+	// DeliveryPending is waiting for its next attempt.
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliveryDelivered got a 2xx answer.
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryFailed ran out of attempts and is in the dead-letter list.
+	DeliveryFailed DeliveryStatus = "failed"
+)
+
+// Attempt is one try to deliver an event. StatusCode is zero if no answer
+// came back.
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// Delivery is the sending of one event to one webhook.
+type Delivery struct {
+	ID            uint64               `json:"id"`
+	WebhookID     uint64               `json:"webhook_id"`
+	EventSeq      uint64               `json:"event_seq"`
+	EventType     repository.EventType `json:"event_type"`
+	Status        DeliveryStatus       `json:"status"`
+	Attempts      []Attempt            `json:"attempts"`
+	NextAttemptAt *time.Time           `json:"next_attempt_at,omitempty"`
+}
+
+var eventTypes = []repository.EventType{repository.NoteCreated, repository.NoteUpdated, repository.NoteDeleted}
+
+func checkWebhook(dto WebhookDTO) error {
+	u, err := url.Parse(dto.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrInvalidURL
+	}
+	for _, t := range dto.Events {
+		if !slices.Contains(eventTypes, t) {
+			return ErrInvalidEventType
+		}
+	}
+	return nil
+}
+
+// checkHost rejects a URL whose host is, or resolves to, an address inside
+// the network of the server.
+func checkHost(ctx context.Context, resolver *net.Resolver, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ErrInvalidURL
+	}
+	host := u.Hostname()
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if blocked(addr) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+
+	addrs, err := resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: host %s does not resolve", ErrInvalidURL, host)
+	}
+	for _, addr := range addrs {
+		if blocked(addr) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which is as
+// internal as the private ranges.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// blocked tells whether webhooks may not be sent to addr.
+func blocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || sharedAddressSpace.Contains(addr)
+}
+
+// wants tells whether w is interested in events of type t.
+func (w *Webhook) wants(t repository.EventType) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, t)
+}
+
+func newSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,208 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoServer echoes every message back until the client closes.
+func echoServer(t *testing.T) string {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.Close(CloseNormal, "")
+
+		for {
+			op, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(op, msg)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string) *Conn {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := Dial(ctx, url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.SetReadTimeout(5 * time.Second)
+	t.Cleanup(func() { conn.Close(CloseNormal, "") })
+	return conn
+}
+
+// rawFrame builds a frame by hand, masked with a zero key if masked is set.
+func rawFrame(fin bool, op Opcode, masked bool, payload string) []byte {
+	b0 := byte(op)
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0, byte(len(payload))}
+	if masked {
+		frame[1] |= 0x80
+		frame = append(frame, 0, 0, 0, 0)
+	}
+	return append(frame, payload...)
+}
+
+func TestEcho(t *testing.T) {
+	conn := dial(t, echoServer(t))
+
+	messages := []struct {
+		op   Opcode
+		data []byte
+	}{
+		{OpText, []byte("hello")},
+		{OpBinary, []byte{0, 1, 2}},
+		{OpText, bytes.Repeat([]byte("a"), 300)},
+		{OpText, bytes.Repeat([]byte("b"), 70000)},
+	}
+	for _, m := range messages {
+		if err := conn.WriteMessage(m.op, m.data); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if err := conn.Ping(); err != nil {
+			t.Fatalf("ping: %v", err)
+		}
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if op != m.op || !bytes.Equal(data, m.data) {
+			t.Errorf("echo: expected %d bytes of op %d, got %d bytes of op %d", len(m.data), m.op, len(data), op)
+		}
+	}
+}
+
+func TestFrames(t *testing.T) {
+	testTable := []struct {
+		name    string
+		frames  [][]byte
+		expMsg  string
+		expCode int
+	}{
+		{
+			name:   "fragmented message",
+			frames: [][]byte{rawFrame(false, OpText, true, "hel"), rawFrame(true, OpPing, true, ""), rawFrame(true, OpContinuation, true, "lo")},
+			expMsg: "hello",
+		},
+		{
+			name:    "unmasked client frame",
+			frames:  [][]byte{rawFrame(true, OpText, false, "hello")},
+			expCode: CloseProtocolError,
+		},
+		{
+			name:    "continuation without start",
+			frames:  [][]byte{rawFrame(true, OpContinuation, true, "lo")},
+			expCode: CloseProtocolError,
+		},
+		{
+			name:    "invalid utf-8",
+			frames:  [][]byte{rawFrame(true, OpText, true, "\xff")},
+			expCode: CloseInvalidPayload,
+		},
+		{
+			name:    "close with 1-byte payload",
+			frames:  [][]byte{rawFrame(true, OpClose, true, "\x03")},
+			expCode: CloseProtocolError,
+		},
+		{
+			name:    "client closes",
+			frames:  [][]byte{rawFrame(true, OpClose, true, "\x03\xe8bye")},
+			expCode: CloseNormal,
+		},
+	}
+
+	url := echoServer(t)
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			conn := dial(t, url)
+			for _, frame := range testCase.frames {
+				conn.conn.Write(frame)
+			}
+
+			_, msg, err := conn.ReadMessage()
+			var closeErr *CloseError
+			switch {
+			case testCase.expCode != 0 && !errors.As(err, &closeErr):
+				t.Errorf("error: expected close code %d, got %v", testCase.expCode, err)
+			case testCase.expCode != 0 && closeErr.Code != testCase.expCode:
+				t.Errorf("close code: expected %d, got %d", testCase.expCode, closeErr.Code)
+			case testCase.expCode == 0 && string(msg) != testCase.expMsg:
+				t.Errorf("message: expected %q, got %q (%v)", testCase.expMsg, msg, err)
+			}
+		})
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	testTable := []struct {
+		name      string
+		header    http.Header
+		expStatus int
+	}{
+		{
+			name:      "plain request",
+			header:    http.Header{},
+			expStatus: http.StatusUpgradeRequired,
+		},
+		{
+			name:      "old version",
+			header:    http.Header{"Connection": {"keep-alive, Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"8"}},
+			expStatus: http.StatusUpgradeRequired,
+		},
+		{
+			name:      "invalid key",
+			header:    http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"13"}, "Sec-Websocket-Key": {"abc"}},
+			expStatus: http.StatusBadRequest,
+		},
+		{
+			name:      "cross-origin page",
+			header:    http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}, "Sec-Websocket-Version": {"13"}, "Sec-Websocket-Key": {"dGhlIHNhbXBsZSBub25jZQ=="}, "Origin": {"https://evil.test"}},
+			expStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header = testCase.header
+			rec := httptest.NewRecorder()
+
+			if _, err := Upgrade(rec, req, "https://app.test"); !errors.Is(err, ErrBadHandshake) {
+				t.Errorf("error: expected %v, got %v", ErrBadHandshake, err)
+			}
+			if status := rec.Code; status != testCase.expStatus {
+				t.Errorf("status code: expected %v, got %v", testCase.expStatus, status)
+			}
+		})
+	}
+
+	for origin, exp := range map[string]bool{"": true, "http://example.com": true, "https://APP.test": true, "https://evil.test": false, "http://example.com.evil.test": false} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if got := checkOrigin(req, []string{"https://app.test"}); got != exp {
+			t.Errorf("origin %q: expected allowed %v, got %v", origin, exp, got)
+		}
+	}
+
+	if key := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); key != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("accept key: expected the RFC 6455 example, got %v", key)
+	}
+}